@@ -0,0 +1,125 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"publisher/pkg/asyncapi"
+	"publisher/pkg/parser"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// eventTypes maps the values of the CloudEvent `type` attribute
+// to the protobuf message carried by events of that type.
+var eventTypes map[string]string
+
+// documentTitle stores the title of the generated document.
+var documentTitle string
+
+// documentVersion stores the version of the generated document.
+var documentVersion string
+
+// definition of the command that generates an AsyncAPI document
+// describing the CloudEvents emitted by the publisher. The
+// generation is delegated to the `asyncapi` package.
+var asyncapiCmd = &cobra.Command{
+	Use:   "asyncapi",
+	Short: "Generates an AsyncAPI document describing the CloudEvents carrying protobuf messages",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		registry, err := parser.LoadRegistry(schemaURI)
+		if err != nil {
+			fmt.Println("Error while loading schema: " + err.Error())
+			os.Exit(1)
+		}
+
+		events, err := resolveEvents(registry, eventTypes)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		document, err := asyncapi.Generate(events, asyncapi.Info{
+			Title:     documentTitle,
+			Version:   documentVersion,
+			SchemaURI: schemaURI,
+		})
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		if len(targetPath) > 0 {
+
+			err = writeToTarget(targetPath, document)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				os.Exit(1)
+			}
+
+		} else {
+
+			data, _ := json.MarshalIndent(document, "", "  ")
+			fmt.Println(string(data))
+		}
+	},
+}
+
+// resolveEvents resolves the message descriptors of the given mapping
+// of event types to message types. If the mapping is empty, each top
+// level message of the package identified by `FullNameFormat` is mapped
+// to an event type equal to its simple name, which is the convention
+// used by the `emit` command.
+func resolveEvents(registry *protoregistry.Files, mapping map[string]string) ([]asyncapi.Event, error) {
+
+	if len(mapping) == 0 {
+		mapping = map[string]string{}
+		pkg := parser.QualifiedName("_").Parent()
+		registry.RangeFilesByPackage(pkg, func(fd protoreflect.FileDescriptor) bool {
+			for i := 0; i < fd.Messages().Len(); i++ {
+				name := string(fd.Messages().Get(i).Name())
+				mapping[name] = name
+			}
+			return true
+		})
+	}
+
+	types := make([]string, 0, len(mapping))
+	for eventType := range mapping {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+
+	events := []asyncapi.Event{}
+	for _, eventType := range types {
+
+		name := parser.QualifiedName(mapping[eventType])
+		descriptor, err := registry.FindDescriptorByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve message %s for event type '%s': %v", name, eventType, err)
+		}
+		md, isMessage := descriptor.(protoreflect.MessageDescriptor)
+		if !isMessage {
+			return nil, fmt.Errorf("%s is not a message", name)
+		}
+		events = append(events, asyncapi.Event{Type: eventType, Message: md})
+	}
+	return events, nil
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(asyncapiCmd)
+	asyncapiCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor set referenced by the events")
+	asyncapiCmd.Flags().StringToStringVarP(&eventTypes, "event", "e", nil, "Mapping of event type to message type (e.g. com.example.created=SimpleMessage), all messages are mapped by simple name if omitted")
+	asyncapiCmd.Flags().StringVarP(&documentTitle, "title", "T", "publisher", "Title of the application described by the document")
+	asyncapiCmd.Flags().StringVarP(&documentVersion, "version", "V", "1.0.0", "Version of the application described by the document")
+	asyncapiCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the document (existing files will be overwritten)")
+	asyncapiCmd.MarkFlagRequired("schema_uri")
+}
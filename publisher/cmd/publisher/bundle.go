@@ -0,0 +1,93 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"publisher/pkg/bundle"
+	"publisher/pkg/export"
+	"publisher/pkg/parser"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// bundleFormat stores the format used to render the size
+// report of the bundle (text or json).
+var bundleFormat string
+
+// definition of the command that extracts from a file descriptor
+// set the minimal set of files and types required to decode the
+// messages of a root type. The pruning of the descriptors is
+// delegated to the `bundle` package.
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Writes the minimal protobuf file descriptor set required by a root message",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		registry, err := parser.LoadRegistry(schemaURI)
+		if err != nil {
+			fmt.Println("Error while loading schema: " + err.Error())
+			os.Exit(1)
+		}
+
+		name := parser.QualifiedName(messageType)
+		descriptor, err := registry.FindDescriptorByName(name)
+		if err != nil {
+			fmt.Printf("Error: no message matching type: %s\n", name)
+			os.Exit(1)
+		}
+		root, isMessage := descriptor.(protoreflect.MessageDescriptor)
+		if !isMessage {
+			fmt.Printf("Error: %s is not a message\n", name)
+			os.Exit(1)
+		}
+
+		set, err := bundle.Build(root)
+		if err != nil {
+			fmt.Println("Error while bundling schema: " + err.Error())
+			os.Exit(1)
+		}
+		data, err := export.Marshal(set)
+		if err != nil {
+			fmt.Println("Error while bundling schema: " + err.Error())
+			os.Exit(1)
+		}
+		err = os.WriteFile(targetPath, data, 0644)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		report := bundle.Report{Root: name}
+		report.Original, err = bundle.Measure(bundle.FileDescriptorSet(registry))
+		if err == nil {
+			report.Bundled, err = bundle.Measure(set)
+		}
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		if bundleFormat == "json" {
+			data, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			fmt.Println(report.String())
+		}
+	},
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor set the bundle is extracted from")
+	bundleCmd.Flags().StringVarP(&messageType, "type", "m", "", "Name of the root message of the bundle")
+	bundleCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the bundle (existing files will be overwritten)")
+	bundleCmd.Flags().StringVarP(&bundleFormat, "format", "f", "text", "Format of the size report (text or json)")
+	bundleCmd.MarkFlagRequired("schema_uri")
+	bundleCmd.MarkFlagRequired("type")
+	bundleCmd.MarkFlagRequired("target_path")
+}
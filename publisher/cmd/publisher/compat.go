@@ -0,0 +1,90 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"publisher/pkg/compat"
+	"publisher/pkg/parser"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// previousSchemaURI points to the file descriptor set containing
+// the version of the schema currently used by consumers.
+var previousSchemaURI string
+
+// currentSchemaURI points to the file descriptor set containing
+// the version of the schema about to be deployed.
+var currentSchemaURI string
+
+// compatMode stores the compatibility mode to verify.
+var compatMode string
+
+// compatFormat stores the format used to render the report
+// of the command (text or json).
+var compatFormat string
+
+// definition of the command that verifies the compatibility of
+// two versions of a schema, expressed as file descriptor sets.
+// The comparison is delegated to the `compat` package.
+var compatCmd = &cobra.Command{
+	Use:   "compat",
+	Short: "Verifies the compatibility between two versions of a protobuf file descriptor set",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		mode, err := compat.ParseMode(compatMode)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		previous, err := parser.LoadRegistry(previousSchemaURI)
+		if err != nil {
+			fmt.Println("Error while loading previous schema: " + err.Error())
+			os.Exit(1)
+		}
+		current, err := parser.LoadRegistry(currentSchemaURI)
+		if err != nil {
+			fmt.Println("Error while loading current schema: " + err.Error())
+			os.Exit(1)
+		}
+
+		var root protoreflect.FullName
+		if len(messageType) > 0 {
+			root = parser.QualifiedName(messageType)
+		}
+
+		report, err := compat.Compare(previous, current, root, mode)
+		if err != nil {
+			fmt.Println("Error while comparing schemas: " + err.Error())
+			os.Exit(1)
+		}
+
+		if compatFormat == "json" {
+			data, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			fmt.Println(report.String())
+		}
+
+		if report.HasErrors() {
+			os.Exit(1)
+		}
+	},
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(compatCmd)
+	compatCmd.Flags().StringVarP(&previousSchemaURI, "previous", "p", "", "URI of the file descriptor set used by the existing consumers")
+	compatCmd.Flags().StringVarP(&currentSchemaURI, "current", "c", "", "URI of the file descriptor set to verify")
+	compatCmd.Flags().StringVarP(&messageType, "type", "m", "", "Name of the root message to compare (all messages are compared if omitted)")
+	compatCmd.Flags().StringVarP(&compatMode, "mode", "M", "full", "Compatibility mode to verify (backward, forward or full)")
+	compatCmd.Flags().StringVarP(&compatFormat, "format", "f", "text", "Format of the report (text or json)")
+	compatCmd.MarkFlagRequired("previous")
+	compatCmd.MarkFlagRequired("current")
+}
@@ -0,0 +1,66 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"publisher/pkg/describe"
+	"publisher/pkg/parser"
+
+	"github.com/spf13/cobra"
+)
+
+// describeFormat stores the format used to render the
+// description (text or json).
+var describeFormat string
+
+// definition of the command that introspects the content of a
+// file descriptor set. The descriptor set is loaded via the
+// `parser` package and described by the `describe` package.
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Describes the content of a protobuf file descriptor set",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		registry, err := parser.LoadRegistry(schemaURI)
+		if err != nil {
+			fmt.Println("Error while loading schema: " + err.Error())
+			os.Exit(1)
+		}
+
+		var description interface{}
+		if len(messageType) > 0 {
+			description, err = describe.Type(registry, parser.QualifiedName(messageType))
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				os.Exit(1)
+			}
+		} else {
+			description = describe.Files(registry)
+		}
+
+		if describeFormat == "json" {
+			data, _ := json.MarshalIndent(description, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		switch d := description.(type) {
+		case []describe.File:
+			fmt.Print(describe.FilesText(d))
+		case fmt.Stringer:
+			fmt.Print(d.String())
+		}
+	},
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(describeCmd)
+	describeCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor set to describe")
+	describeCmd.Flags().StringVarP(&messageType, "type", "m", "", "Name of the message, enum or service to describe (all files are summarised if omitted)")
+	describeCmd.Flags().StringVarP(&describeFormat, "format", "f", "text", "Format of the description (text or json)")
+	describeCmd.MarkFlagRequired("schema_uri")
+}
@@ -0,0 +1,96 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"publisher/pkg/diff"
+	"publisher/pkg/parser"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// leftPath points to the file containing the first message
+// to compare.
+var leftPath string
+
+// rightPath points to the file containing the second message
+// to compare.
+var rightPath string
+
+// floatTolerance stores the maximum difference between two
+// floating point values that are considered equal.
+var floatTolerance float64
+
+// diffFormat stores the format used to render the
+// differences (text or json).
+var diffFormat string
+
+// definition of the command that decodes two messages of the
+// same type and reports their field-level differences. The
+// decoding is delegated to the `parser` package, while the
+// comparison is implemented by the `diff` package.
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compares two protobuf messages (optionally wrapped into CloudEvents) field by field",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		left, err := decodeMessage(leftPath)
+		if err != nil {
+			fmt.Println("Error while parsing left message: " + err.Error())
+			os.Exit(1)
+		}
+		right, err := decodeMessage(rightPath)
+		if err != nil {
+			fmt.Println("Error while parsing right message: " + err.Error())
+			os.Exit(1)
+		}
+
+		differences, err := diff.Compare(left, right, diff.Options{FloatTolerance: floatTolerance})
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		if diffFormat == "json" {
+			data, _ := json.MarshalIndent(differences, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			for _, difference := range differences {
+				fmt.Println(difference.String())
+			}
+			fmt.Printf("%d difference(s)\n", len(differences))
+		}
+
+		if len(differences) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// decodeMessage decodes the message stored in the given file
+// according to the envelope specified for the command.
+func decodeMessage(path string) (*dynamicpb.Message, error) {
+
+	if isRaw {
+		return parser.DecodeRaw(path, schemaURI, isDynamic)
+	}
+	return parser.DecodeCloudEvent(path, isDynamic)
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolVarP(&isDynamic, "dynamic", "d", true, "Uses dynamic type resolution to deserialise protobuf binary")
+	diffCmd.Flags().BoolVarP(&isRaw, "raw", "r", false, "Determine whether the messages are raw protobuf binaries or wrapped in a CloudEvent structure (default)")
+	diffCmd.Flags().StringVarP(&leftPath, "left_path", "a", "", "Path to the file containing the first message or CloudEvent")
+	diffCmd.Flags().StringVarP(&rightPath, "right_path", "b", "", "Path to the file containing the second message or CloudEvent")
+	diffCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor providing type information about raw messages")
+	diffCmd.Flags().Float64VarP(&floatTolerance, "tolerance", "e", 0, "Maximum absolute difference between float and double values considered equal")
+	diffCmd.Flags().StringVarP(&diffFormat, "format", "f", "text", "Format of the differences (text or json)")
+	diffCmd.MarkFlagRequired("left_path")
+	diffCmd.MarkFlagRequired("right_path")
+}
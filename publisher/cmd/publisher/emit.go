@@ -4,23 +4,81 @@ import (
 	"fmt"
 	"os"
 	emitter "publisher/pkg/emitter"
+	"publisher/pkg/envelope"
+	"publisher/pkg/parser"
+	"publisher/pkg/pubsub"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-// emitters is a map of callbacks that is used to map
-// the specified type of message to emit to the
-// corresponding function that will emit and persist
-// the message according to the given parameters.
-var emitters = map[string]func(string, string, bool) error{
-	"SimpleMessage":   emitter.SerializeSimpleMessage,
-	"ComplexMessage":  emitter.SerializeComplexMessage,
-	"ComposedMessage": emitter.SerializeComposedMessage,
-	"ImportMessage":   emitter.SerializeImportMessage,
-	"EnumMessage":     emitter.SerializeEnumMessage,
-	"NestedMessage":   emitter.SerializeNestedMessage,
+// templatePath points to the template used to render the
+// content of the messages to emit.
+var templatePath string
+
+// emissionOptions stores the flags controlling the content
+// of the messages emitted, which each emitting command binds
+// to its own instance.
+type emissionOptions struct {
+	// seed initialises the generation of random content.
+	seed int64
+	// count is the number of messages to create.
+	count int
+	// isDeterministic determines whether the emitter should
+	// produce the same output for the same inputs.
+	isDeterministic bool
+	// fixedTime is the time used by the emitter in
+	// deterministic mode.
+	fixedTime string
 }
 
+// emitOptions stores the emission flags of the emit command.
+var emitOptions emissionOptions
+
+// sinkType stores the type of destination of the messages
+// emitted (file, stdout, dir or http).
+var sinkType string
+
+// endpoint stores the URL the HTTP sink posts the events to.
+var endpoint string
+
+// httpMode stores the mode used by the HTTP sink to send
+// the cloud events (structured or binary).
+var httpMode string
+
+// retries stores the number of retries of failed requests.
+var retries int
+
+// maxCount stores the maximum number of messages written
+// to a file by the directory sink.
+var maxCount int
+
+// maxSize stores the maximum size of a file written by
+// the directory sink.
+var maxSize int64
+
+// confluentSchemaID stores the identifier of the schema in
+// the Schema Registry used to frame the messages emitted.
+var confluentSchemaID int64
+
+// pubsubSchema stores the name, revision and encoding of the
+// Pub/Sub schema of the messages emitted.
+var pubsubSchema pubsub.Schema
+
+// embedSchema determines whether the messages emitted embed
+// the bundle of their schema.
+var embedSchema bool
+
+// pinSchema determines whether the digest of the schema is
+// added to the schema URI referenced by the messages.
+var pinSchema bool
+
+// listTypes determines whether the types that can be emitted
+// are listed instead of emitting a message.
+var listTypes bool
+
 // definition of the command that emits the cloud event
 // based on the given parameters. The implementation of
 // the event generation and persistence to file is then
@@ -31,29 +89,202 @@ var emitCmd = &cobra.Command{
 	Args:  cobra.OnlyValidArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		var err error = nil
-		emitter, isPresent := emitters[messageType]
-		if !isPresent {
-			err = fmt.Errorf("unknown message type: '%s'", messageType)
+		if listTypes {
+			fmt.Println(emitter.FormatCatalog(emitter.Catalog()))
+			return
+		}
+		if len(messageType) == 0 || len(schemaURI) == 0 {
+			fmt.Println("Error: the type and the schema URI are required unless the types are listed")
+			os.Exit(1)
+		}
+
+		emitter.ConfluentSchemaID = confluentSchemaID
+		emitter.PubSubSchema = pubsubSchema
+		emitter.EmbedSchema = embedSchema
+		err := emitOptions.configure(cmd)
+		if err == nil && pinSchema {
+			schemaURI, err = parser.PinSchemaURI(schemaURI)
+		}
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		if sinkType != "file" {
+			err = emitToSink()
+		} else if len(targetPath) == 0 {
+			err = fmt.Errorf("the file sink requires a target path")
+		} else if len(templatePath) > 0 || len(pubsubSchema.Name) > 0 || len(envelopeName) > 0 || embedSchema {
+			err = emitToFile()
 		} else {
-			err = emitter(targetPath, schemaURI, isRaw)
+			var message protoreflect.ProtoMessage
+			message, err = emitter.NewMessage(messageType)
+			if err == nil {
+				err = emitter.SerializeMessage(targetPath, messageType, schemaURI, message, isRaw)
+			}
 		}
 
 		if err != nil {
+			fmt.Println("Error: " + err.Error())
 			os.Exit(1)
 		}
 	},
 }
 
+// configure configures the emitter according to the flags of the
+// given command controlling determinism. In deterministic mode the
+// clock of the emitter is fixed to `fixedTime` and the seed keeps
+// its value (0 unless specified), otherwise a seed that has not
+// been specified is derived from the current time.
+func (o *emissionOptions) configure(cmd *cobra.Command) error {
+
+	if !o.isDeterministic {
+		if !cmd.Flags().Changed("seed") {
+			o.seed = time.Now().UnixNano()
+		}
+		return nil
+	}
+
+	fixed, err := time.Parse(time.RFC3339Nano, o.fixedTime)
+	if err != nil {
+		return err
+	}
+	emitter.EnableDeterministicMode(fixed)
+	return nil
+}
+
+// emitToFile creates the messages (either rendered from the template
+// or the sample instance of the type) and saves them to the target
+// path, in the format selected by the flags.
+func emitToFile() error {
+
+	messages, err := createMessages()
+	if err != nil {
+		return err
+	}
+	return emitter.SerializeMessages(targetPath, messageType, schemaURI, messages, emissionFormat())
+}
+
+// emitToSink creates the messages (either rendered from the template
+// or the sample instance of the type) and delivers them to the sink
+// selected by `sinkType`.
+func emitToSink() error {
+
+	messages, err := createMessages()
+	if err != nil {
+		return err
+	}
+
+	format := emissionFormat()
+	var sink emitter.Sink
+	switch sinkType {
+	case "stdout":
+		sink = emitter.NewStdoutSink()
+	case "dir":
+		if len(targetPath) == 0 {
+			return fmt.Errorf("the directory sink requires a target path")
+		}
+		extension := ".bin"
+		if format == emitter.FormatCloudEvent || format == emitter.FormatPubSub {
+			extension = ".json"
+		}
+		sink, err = emitter.NewDirectorySink(targetPath, messageType, extension, maxCount, maxSize)
+	case "http":
+		sink, err = emitter.NewHTTPSink(endpoint, httpMode, retries)
+	default:
+		err = fmt.Errorf("unknown sink: '%s' (expected file, stdout, dir or http)", sinkType)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = emitter.Emit(sink, messageType, schemaURI, messages, format)
+	closeErr := sink.Close()
+	if httpSink, isHTTP := sink.(*emitter.HTTPSink); isHTTP {
+		for i, delivery := range httpSink.Deliveries {
+			fmt.Printf("message %d: status %d (%d attempt(s))\n", i+1, delivery.Status, delivery.Attempts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// emissionFormat returns the format of the messages emitted.
+func emissionFormat() string {
+
+	if len(envelopeName) > 0 {
+		return envelopeName
+	}
+	if len(pubsubSchema.Name) > 0 {
+		return emitter.FormatPubSub
+	}
+	if isRaw && embedSchema {
+		return envelope.SelfDescribing
+	}
+	if isRaw {
+		return emitter.FormatRaw
+	}
+	return emitter.FormatCloudEvent
+}
+
+// createMessages renders the messages from the template, when given,
+// or creates the sample instance of the type.
+func createMessages() ([]protoreflect.ProtoMessage, error) {
+
+	if len(templatePath) > 0 {
+		return renderTemplate()
+	}
+	message, err := emitter.NewMessage(messageType)
+	if err != nil {
+		return nil, err
+	}
+	return []protoreflect.ProtoMessage{message}, nil
+}
+
+// renderTemplate renders the template pointed by `templatePath`
+// into as many messages of the type resolved from the schema as
+// requested by the emission flags.
+func renderTemplate() ([]protoreflect.ProtoMessage, error) {
+
+	descriptor, err := parser.ResolveDescriptor(fmt.Sprintf("%s#%s", schemaURI, messageType), true)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := emitter.LoadTemplate(templatePath, emitOptions.seed)
+	if err != nil {
+		return nil, err
+	}
+	return template.RenderMessages(descriptor, emitOptions.count)
+}
+
 // init initialises the command with the required flags
 // and adds it to the root command.
 func init() {
 	rootCmd.AddCommand(emitCmd)
 	emitCmd.Flags().BoolVarP(&isRaw, "raw", "r", false, "Determine whether to emit the message as a raw protobuf binary (default) or wrapped in a CloudEvent structure")
-	emitCmd.Flags().StringVarP(&messageType, "type", "m", "", "Type of the message to emit (SimpleMessage, ComplexMessage, ComposedMessage, ImportMessage)")
-	emitCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the message (existing files will be overwritten)")
+	emitCmd.Flags().StringVarP(&messageType, "type", "m", "", "Type of the message to emit: simple name of a sample type (e.g. SimpleMessage), fully qualified name of any linked type (see --list), or any type defined in the schema when using a template")
+	emitCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the message (existing files will be overwritten), or directory used by the dir sink")
 	emitCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor providing type information about the message payload")
-	emitCmd.MarkFlagRequired("type")
-	emitCmd.MarkFlagRequired("target_path")
-	emitCmd.MarkFlagRequired("schema_uri")
+	emitCmd.Flags().StringVarP(&templatePath, "template", "T", "", "Path to a template (.json or prototext) rendering the content of messages of any type defined in the schema")
+	emitCmd.Flags().IntVarP(&emitOptions.count, "count", "n", 1, "Number of messages to render from the template")
+	emitCmd.Flags().Int64Var(&emitOptions.seed, "seed", 0, "Seed for the random choices made by the template (random if omitted)")
+	emitCmd.Flags().BoolVar(&emitOptions.isDeterministic, "deterministic", false, "Produces byte-identical output for the same inputs (fixed time, sequential identifiers and deterministic marshalling)")
+	emitCmd.Flags().StringVar(&emitOptions.fixedTime, "fixed_time", "1970-01-01T00:00:00Z", "Time (RFC 3339) used for events and timestamps in deterministic mode")
+	emitCmd.Flags().StringVarP(&sinkType, "sink", "s", "file", "Destination of the messages: file, stdout, dir (rotating files in target_path) or http (POST to endpoint)")
+	emitCmd.Flags().StringVar(&endpoint, "endpoint", "", "URL the http sink posts the messages to")
+	emitCmd.Flags().StringVar(&httpMode, "http_mode", emitter.ModeStructured, "Mode used by the http sink to send cloud events (structured or binary)")
+	emitCmd.Flags().IntVar(&retries, "retries", 3, "Number of retries of failed requests for the http sink")
+	emitCmd.Flags().IntVar(&maxCount, "max_count", 0, "Maximum number of messages per file for the dir sink (unlimited if zero)")
+	emitCmd.Flags().Int64Var(&maxSize, "max_size", 0, "Maximum size in bytes of a file for the dir sink (unlimited if zero)")
+	emitCmd.Flags().Int64Var(&confluentSchemaID, "confluent_id", -1, "Identifier of the schema in the Schema Registry, frames the messages according to the Confluent wire format (disabled if negative)")
+	emitCmd.Flags().StringVar(&envelopeName, "envelope", "", "Envelope wrapping the messages ("+strings.Join(envelope.Names(), ", ")+"), overrides --raw")
+	emitCmd.Flags().StringVar(&pubsubSchema.Name, "pubsub_schema", "", "Name of the Pub/Sub schema (projects/<project>/schemas/<schema>), wraps the messages into Pub/Sub messages")
+	emitCmd.Flags().StringVar(&pubsubSchema.RevisionID, "pubsub_revision", "", "Revision of the Pub/Sub schema of the messages")
+	emitCmd.Flags().StringVar(&pubsubSchema.Encoding, "pubsub_encoding", pubsub.EncodingBinary, "Encoding of the data of the Pub/Sub messages (BINARY or JSON)")
+	emitCmd.Flags().BoolVar(&embedSchema, "embed_schema", false, "Embeds the bundle of the schema (with its digest) in the messages: as extension attributes of cloud events, or in a self-describing wrapper (envelope "+envelope.SelfDescribing+") for raw messages")
+	emitCmd.Flags().BoolVar(&pinSchema, "pin_schema", false, "Pins the content of the schema by adding its SHA-256 digest to the schema URI (?"+parser.IntegrityParameter+"=...), which parsers verify")
+	emitCmd.Flags().BoolVar(&listTypes, "list", false, "Lists the types that can be emitted without a template, and whether their sample instance is a fixture or generated")
 }
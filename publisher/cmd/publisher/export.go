@@ -0,0 +1,72 @@
+package publisher
+
+import (
+	"fmt"
+	"os"
+	"publisher/pkg/export"
+	"publisher/pkg/parser"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// exportTypes stores the names of the types whose schema is
+// exported.
+var exportTypes []string
+
+// withSourceInfo determines whether the source code information
+// of the files is kept, when available.
+var withSourceInfo bool
+
+// definition of the command that exports the schema of the types
+// linked in the executable as a file descriptor set, so that the
+// producers can publish the exact schema they were built with.
+// The collection of the files is delegated to the `export` package.
+var exportSchemaCmd = &cobra.Command{
+	Use:   "export-schema",
+	Short: "Exports the schema of the linked types as a protobuf file descriptor set",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		names := []protoreflect.FullName{}
+		for _, exportType := range exportTypes {
+			names = append(names, parser.QualifiedName(exportType))
+		}
+
+		set, err := export.FileDescriptorSet(protoregistry.GlobalFiles, names, export.Options{SourceInfo: withSourceInfo})
+		if err != nil {
+			fmt.Println("Error while exporting schema: " + err.Error())
+			os.Exit(1)
+		}
+		data, err := export.Marshal(set)
+		if err != nil {
+			fmt.Println("Error while exporting schema: " + err.Error())
+			os.Exit(1)
+		}
+
+		if len(targetPath) == 0 {
+			os.Stdout.Write(data)
+			return
+		}
+		err = os.WriteFile(targetPath, data, 0644)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+		for _, file := range set.File {
+			fmt.Println(file.GetName())
+		}
+		fmt.Printf("exported %d file(s) (%d bytes) to %s\n", len(set.File), len(data), targetPath)
+	},
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(exportSchemaCmd)
+	exportSchemaCmd.Flags().StringSliceVarP(&exportTypes, "type", "m", nil, "Names of the linked types (simple names of sample types or fully qualified names, see emit --list) whose files are exported with their imports")
+	exportSchemaCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the file descriptor set (written to the standard output if omitted)")
+	exportSchemaCmd.Flags().BoolVar(&withSourceInfo, "source_info", false, "Keeps the source code information (comments and locations) of the files that carry it")
+	exportSchemaCmd.MarkFlagRequired("type")
+}
@@ -0,0 +1,76 @@
+package publisher
+
+import (
+	"fmt"
+	"os"
+	emitter "publisher/pkg/emitter"
+	"publisher/pkg/parser"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// generateOptions stores the emission flags of the generate
+// command (seed, number of messages and determinism).
+var generateOptions emissionOptions
+
+// generateFormat stores the output format of the messages
+// generated.
+var generateFormat string
+
+// maxDepth stores the maximum nesting of generated messages.
+var maxDepth int
+
+// definition of the command that generates messages of any type
+// defined in a file descriptor set, with random content. The
+// generation and persistence of the messages is delegated to the
+// `emitter` package.
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generates protobuf messages of any type with random content (optionally wrapped into CloudEvents)",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		descriptor, err := parser.ResolveDescriptor(fmt.Sprintf("%s#%s", schemaURI, messageType), true)
+		if err != nil {
+			fmt.Println("Error while resolving message type: " + err.Error())
+			os.Exit(1)
+		}
+
+		err = generateOptions.configure(cmd)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+		generator := emitter.NewGenerator(generateOptions.seed, maxDepth)
+
+		messages := []protoreflect.ProtoMessage{}
+		for i := 0; i < generateOptions.count; i++ {
+			messages = append(messages, generator.Generate(descriptor))
+		}
+
+		err = emitter.SerializeMessages(targetPath, messageType, schemaURI, messages, generateFormat)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(generateCmd)
+	generateCmd.Flags().StringVarP(&messageType, "type", "m", "", "Type of the message to generate (simple or fully qualified name)")
+	generateCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor set defining the message type")
+	generateCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the messages (existing files will be overwritten)")
+	generateCmd.Flags().StringVarP(&generateFormat, "format", "f", emitter.FormatCloudEvent, "Output format (raw, cloudevent or delimited)")
+	generateCmd.Flags().Int64Var(&generateOptions.seed, "seed", 0, "Seed for the random content, the same seed produces the same messages (random if omitted)")
+	generateCmd.Flags().IntVarP(&generateOptions.count, "count", "n", 1, "Number of messages to generate")
+	generateCmd.Flags().IntVar(&maxDepth, "max_depth", emitter.DefaultMaxDepth, "Maximum nesting of messages for recursive types")
+	generateCmd.Flags().BoolVar(&generateOptions.isDeterministic, "deterministic", false, "Produces byte-identical output for the same inputs (fixed time, sequential identifiers and deterministic marshalling)")
+	generateCmd.Flags().StringVar(&generateOptions.fixedTime, "fixed_time", "1970-01-01T00:00:00Z", "Time (RFC 3339) used for events and timestamps in deterministic mode")
+	generateCmd.MarkFlagRequired("type")
+	generateCmd.MarkFlagRequired("target_path")
+	generateCmd.MarkFlagRequired("schema_uri")
+}
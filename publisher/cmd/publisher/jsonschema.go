@@ -0,0 +1,55 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"publisher/pkg/jsonschema"
+	"publisher/pkg/parser"
+
+	"github.com/spf13/cobra"
+)
+
+// definition of the command that generates the JSON Schema of
+// the JSON documents produced by the `parse` command for a given
+// message type. The generation is delegated to the `jsonschema`
+// package.
+var jsonschemaCmd = &cobra.Command{
+	Use:   "jsonschema",
+	Short: "Generates the JSON Schema (draft 2020-12) of the JSON representation of a protobuf message",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		descriptor, err := parser.ResolveDescriptor(schemaURI, isDynamic)
+		if err != nil {
+			fmt.Println("Error while resolving message type: " + err.Error())
+			os.Exit(1)
+		}
+
+		schema := jsonschema.Generate(descriptor)
+
+		if len(targetPath) > 0 {
+
+			err = writeToTarget(targetPath, schema)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				os.Exit(1)
+			}
+
+		} else {
+
+			data, _ := json.MarshalIndent(schema, "", "  ")
+			fmt.Println(string(data))
+		}
+	},
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(jsonschemaCmd)
+	jsonschemaCmd.Flags().BoolVarP(&isDynamic, "dynamic", "d", true, "Uses dynamic type resolution to resolve the message descriptor")
+	jsonschemaCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor, whose fragment is the type of the message")
+	jsonschemaCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the JSON Schema (existing files will be overwritten)")
+	jsonschemaCmd.MarkFlagRequired("schema_uri")
+}
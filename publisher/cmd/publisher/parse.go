@@ -4,11 +4,83 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"publisher/pkg/batch"
+	"publisher/pkg/confluent"
+	"publisher/pkg/envelope"
+	"publisher/pkg/grpcframe"
 	"publisher/pkg/parser"
+	"publisher/pkg/pubsub"
 
 	"github.com/spf13/cobra"
 )
 
+// registryURL stores the base URL of the Schema Registry
+// used to resolve messages in the Confluent wire format.
+var registryURL string
+
+// isPubSub determines whether the input is a Pub/Sub message.
+var isPubSub bool
+
+// schemaDirectory points to the directory storing the schemas
+// of Pub/Sub messages.
+var schemaDirectory string
+
+// envelopeName stores the name of the envelope wrapping the
+// messages, or `auto` to detect it from the input.
+var envelopeName string
+
+// inputEncoding stores the encoding of the content of the
+// source file (e.g. base64 text copied from logs).
+var inputEncoding string
+
+// grpcMethod stores the gRPC method (/package.Service/Method)
+// whose messages are carried by the source file.
+var grpcMethod string
+
+// grpcMaxMessageSize stores the maximum size of the gRPC
+// messages once decompressed.
+var grpcMaxMessageSize int64
+
+// direction stores whether the source file carries the
+// requests or the responses of the gRPC method.
+var direction string
+
+// workers stores the number of files parsed at the same
+// time when the source path is a directory or a pattern.
+var workers int
+
+// outputDirectory points to the directory where the outputs
+// of a batch are written, mirroring the tree of the inputs.
+var outputDirectory string
+
+// resolution stores the strategy of resolution of the message
+// descriptors (static, dynamic or hybrid), overriding --dynamic.
+var resolution string
+
+// driftPolicy stores how the differences between linked types
+// and schemas are handled in hybrid resolution.
+var driftPolicy string
+
+// trustedDigests stores the SHA-256 digests of the schemas
+// that can be used, any schema can be used if empty.
+var trustedDigests []string
+
+// schemaPolicy stores the schemes, hosts and path prefixes allowed
+// in schema URIs, and the root directory schema files must be in.
+var schemaPolicy parser.Policy
+
+// schemaRegistry is the Schema Registry client shared by
+// all the messages parsed.
+var schemaRegistry *confluent.Registry
+
+// pubsubSchemas is the lookup of Pub/Sub schemas shared by
+// all the messages parsed.
+var pubsubSchemas *pubsub.SchemaDirectory
+
 // definition of the command that parses the content of a given
 // file to verify the serialisation of a protobuf message. The
 // actual parsing capability is delegated to the `parser` package.
@@ -18,15 +90,23 @@ var parseCmd = &cobra.Command{
 	Args:  cobra.OnlyValidArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 
+		parser.InputEncoding = inputEncoding
+		grpcframe.MaxMessageSize = grpcMaxMessageSize
+		configureResolver()
+		if len(registryURL) > 0 {
+			schemaRegistry = confluent.NewRegistry(registryURL)
+			parser.StripFraming = true
+		}
+		pubsubSchemas = pubsub.NewSchemaDirectory(schemaDirectory, parser.CheckSchemaFile)
+
+		if batch.IsPattern(sourcePath) {
+			parseBatch()
+			return
+		}
+
 		// parse the content based on the parameters passed to
 		// the command.
-		var result map[string]interface{}
-		var err error
-		if isRaw {
-			result, err = parser.ParseRaw(sourcePath, schemaURI, isDynamic)
-		} else {
-			result, err = parser.ParseCloudEvent(sourcePath, schemaURI, isDynamic)
-		}
+		result, err := parseSource(sourcePath)
 		if err != nil {
 			fmt.Println("Error while parsing message:" + err.Error())
 			os.Exit(1)
@@ -49,6 +129,74 @@ var parseCmd = &cobra.Command{
 	},
 }
 
+// parseSource parses the content of the given file according to
+// the flags of the command.
+func parseSource(path string) (interface{}, error) {
+
+	if isPubSub {
+		return parser.ParsePubSub(path, pubsubSchemas)
+	} else if isRaw && schemaRegistry != nil {
+		return parser.ParseConfluent(path, schemaRegistry)
+	} else if len(envelopeName) > 0 {
+		return parser.ParseEnvelope(path, envelopeName, schemaURI, isDynamic)
+	} else if len(schemaURI) == 0 {
+		return nil, fmt.Errorf("the schema URI is required unless a schema registry or Pub/Sub messages are used")
+	} else if len(grpcMethod) > 0 {
+		return parser.ParseGRPC(path, schemaURI, grpcMethod, direction)
+	} else if isRaw {
+		return parser.TranscodeRaw(path, schemaURI, isDynamic)
+	}
+	return parser.ParseCloudEvent(path, schemaURI, isDynamic)
+}
+
+// parseBatch parses the files in the directory or matching the
+// glob pattern given as source path, with a pool of workers that
+// share the descriptors of the schemas, and prints a summary.
+func parseBatch() {
+
+	inputs, err := batch.Expand(outputDirectory, sourcePath)
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		os.Exit(1)
+	}
+	if len(inputs) == 0 {
+		fmt.Println("Error: no file matches " + sourcePath)
+		os.Exit(1)
+	}
+
+	parser.EnableRegistryCache()
+	summary := batch.Run(inputs, parseSource, batch.Options{Workers: workers, OutputDirectory: outputDirectory})
+
+	for _, failure := range summary.Failures {
+		fmt.Printf("failed: %s: %s\n", failure.Path, strings.TrimSpace(failure.Err.Error()))
+	}
+	fmt.Printf("parsed %d file(s): %d succeeded, %d failed in %v (%.1f files/s)\n",
+		len(inputs), summary.Succeeded, summary.Failed, summary.Elapsed.Round(time.Millisecond), summary.Throughput())
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// configureResolver validates the strategy of resolution, the
+// drift policy, the trusted digests and the schema URI policy,
+// and applies them to the parser.
+func configureResolver() {
+
+	err := parser.CheckResolution(resolution, driftPolicy)
+	if err == nil {
+		err = parser.TrustDigests(trustedDigests)
+	}
+	if err == nil && (len(schemaPolicy.AllowedSchemes) > 0 || len(schemaPolicy.AllowedHosts) > 0 || len(schemaPolicy.AllowedPaths) > 0 || len(schemaPolicy.SandboxRoot) > 0) {
+		err = parser.SetPolicy(&schemaPolicy)
+	}
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		os.Exit(1)
+	}
+	parser.Resolution = resolution
+	parser.DriftPolicy = driftPolicy
+}
+
 // writeToTarget marshals the given content to a JSON string and
 // then writes it to the specified file.
 func writeToTarget(targetPath string, content interface{}) error {
@@ -80,10 +228,26 @@ func init() {
 	rootCmd.AddCommand(parseCmd)
 	parseCmd.Flags().BoolVarP(&isDynamic, "dynamic", "d", true, "Uses dynamic type resolution to deserialise protobuf binary")
 	parseCmd.Flags().BoolVarP(&isRaw, "raw", "r", false, "Determine whether to emit the message as a raw protobuf binary (default) or wrapped in a CloudEvent structure")
-	parseCmd.Flags().StringVarP(&sourcePath, "source_path", "s", "", "Path to the file where to read the message or CloudEvent from")
+	parseCmd.Flags().StringVarP(&sourcePath, "source_path", "s", "", "Path to the file where to read the message or CloudEvent from (- for the standard input), or directory or glob pattern of the files to parse in batch")
 	parseCmd.Flags().StringVarP(&targetPath, "target_path", "t", "", "Path to the file where to store the message (existing files will be overwritten)")
 	parseCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the protobuf file descriptor providing type information about the message payload")
 	parseCmd.Flags().StringVarP(&messageType, "type", "m", "", "Simple name of the protobuf message to parse")
+	parseCmd.Flags().StringVar(&registryURL, "registry_url", "", "Base URL of the Schema Registry resolving raw messages framed according to the Confluent wire format")
+	parseCmd.Flags().BoolVar(&isPubSub, "pubsub", false, "Interprets the input as a Pub/Sub message (JSON) whose schema is identified by the googclient_schema* attributes")
+	parseCmd.Flags().StringVar(&schemaDirectory, "schema_dir", ".", "Directory storing the Pub/Sub schemas (<schema>/<revision>.proto|.pb or <schema>.proto|.pb)")
+	parseCmd.Flags().StringVar(&envelopeName, "envelope", "", "Envelope of the input (auto, "+strings.Join(envelope.Names(), ", ")+"), overrides --raw; messages that do not reference a schema use schema_uri")
+	parseCmd.Flags().StringVar(&inputEncoding, "input-encoding", parser.InputBinary, "Encoding of the source content (binary, base64, base64url, hex or auto), white spaces and line breaks are ignored")
+	parseCmd.Flags().StringVar(&grpcMethod, "grpc-method", "", "gRPC method (/package.Service/Method) whose length-prefixed frames (gRPC or gRPC-Web) are carried by the source, resolved through schema_uri")
+	parseCmd.Flags().Int64Var(&grpcMaxMessageSize, "grpc-max-message-size", grpcframe.DefaultMaxMessageSize, "Maximum size in bytes of a gRPC message once decompressed, larger messages are rejected")
+	parseCmd.Flags().StringVar(&direction, "direction", parser.DirectionRequest, "Direction of the gRPC messages (request or response)")
+	parseCmd.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "Number of files parsed at the same time in batch mode")
+	parseCmd.Flags().StringVar(&outputDirectory, "output_dir", "", "Directory where batch outputs are written mirroring the tree of the inputs (next to the inputs, with the .json extension appended, if omitted)")
+	parseCmd.Flags().StringVar(&resolution, "resolution", "", "Resolution of the message types ("+strings.Join(parser.Resolutions(), ", ")+"), overrides --dynamic; hybrid prefers the linked types and falls back to the schema")
+	parseCmd.Flags().StringVar(&driftPolicy, "drift", parser.DriftWarn, "Handling of the differences between linked types and schemas in hybrid resolution ("+strings.Join(parser.DriftPolicies(), ", ")+")")
+	parseCmd.Flags().StringSliceVar(&trustedDigests, "trusted_digest", nil, "SHA-256 digests (hexadecimal, optionally prefixed by sha256:) of the only schemas, loaded or embedded, that can be used")
+	parseCmd.Flags().StringSliceVar(&schemaPolicy.AllowedSchemes, "allowed_scheme", nil, "Schemes allowed in schema URIs (e.g. file, grpc+reflect), URIs without scheme being files; any scheme if omitted")
+	parseCmd.Flags().StringSliceVar(&schemaPolicy.AllowedHosts, "allowed_host", nil, "Hosts (name, or name and port) allowed in schema URIs; any host if omitted")
+	parseCmd.Flags().StringSliceVar(&schemaPolicy.AllowedPaths, "allowed_path", nil, "Path prefixes allowed in schema URIs; any path if omitted")
+	parseCmd.Flags().StringVar(&schemaPolicy.SandboxRoot, "schema_root", "", "Directory the schema files must be in, rejecting paths that traverse it or escape it through symbolic links")
 	parseCmd.MarkFlagRequired("source_path")
-	parseCmd.MarkFlagRequired("schema_uri")
 }
@@ -0,0 +1,128 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"publisher/pkg/confluent"
+	"publisher/pkg/parser"
+	"publisher/pkg/server"
+
+	"github.com/spf13/cobra"
+)
+
+// address stores the address the server listens on.
+var address string
+
+// forwardURL stores the endpoint the decoded messages
+// are forwarded to.
+var forwardURL string
+
+// maxBodySize stores the maximum size of the requests.
+var maxBodySize int64
+
+// maxConcurrency stores the maximum number of requests
+// decoded at the same time.
+var maxConcurrency int
+
+// shutdownTimeout stores the time granted to the requests
+// in flight when the server shuts down.
+var shutdownTimeout time.Duration
+
+// readHeaderTimeout stores the time granted to clients
+// to send the headers of a request.
+var readHeaderTimeout time.Duration
+
+// readTimeout stores the time granted to clients to send
+// a whole request.
+var readTimeout time.Duration
+
+// definition of the command that runs the parser as an HTTP
+// endpoint, which decodes the messages received and replies
+// with (or forwards) their JSON form. The implementation of
+// the endpoint is delegated to the `server` package.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves an HTTP endpoint decoding CloudEvents and raw protobuf messages into JSON",
+	Args:  cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		configureResolver()
+		err := checkServePolicy()
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		var registry *confluent.Registry
+		if len(registryURL) > 0 {
+			registry = confluent.NewRegistry(registryURL)
+			parser.StripFraming = true
+		}
+
+		s := server.New(server.Options{
+			Address:           address,
+			IsDynamic:         isDynamic,
+			SchemaURI:         schemaURI,
+			Registry:          registry,
+			ForwardURL:        forwardURL,
+			MaxBodySize:       maxBodySize,
+			MaxConcurrency:    maxConcurrency,
+			ShutdownTimeout:   shutdownTimeout,
+			ReadHeaderTimeout: readHeaderTimeout,
+			ReadTimeout:       readTimeout,
+		})
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = s.Run(ctx)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// checkServePolicy verifies that the schema files the server can
+// read are confined by the schema URI policy, as the schema URI
+// of a request (its `dataschema` or the X-Schema-URI header) is
+// chosen by the caller. Static resolution never reads the files.
+func checkServePolicy() error {
+
+	if resolution == parser.ResolutionStatic || (len(resolution) == 0 && !isDynamic) {
+		return nil
+	}
+	if !schemaPolicy.ConfinesFiles() {
+		return fmt.Errorf("the schema files must be confined with --schema_root or --allowed_path, or file URIs denied with --allowed_scheme, as requests choose their schema URI")
+	}
+	return nil
+}
+
+// init initialises the command with the required flags
+// and adds it to the root command.
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVarP(&address, "address", "a", ":8080", "Address the server listens on")
+	serveCmd.Flags().BoolVarP(&isDynamic, "dynamic", "d", true, "Uses dynamic type resolution to deserialise protobuf binary")
+	serveCmd.Flags().StringVar(&resolution, "resolution", "", "Resolution of the message types ("+strings.Join(parser.Resolutions(), ", ")+"), overrides --dynamic; hybrid prefers the linked types and falls back to the schema")
+	serveCmd.Flags().StringVar(&driftPolicy, "drift", parser.DriftWarn, "Handling of the differences between linked types and schemas in hybrid resolution ("+strings.Join(parser.DriftPolicies(), ", ")+")")
+	serveCmd.Flags().StringSliceVar(&trustedDigests, "trusted_digest", nil, "SHA-256 digests (hexadecimal, optionally prefixed by sha256:) of the only schemas, loaded or embedded, that can be used")
+	serveCmd.Flags().StringSliceVar(&schemaPolicy.AllowedSchemes, "allowed_scheme", nil, "Schemes allowed in schema URIs (e.g. file, grpc+reflect), URIs without scheme being files; any scheme if omitted")
+	serveCmd.Flags().StringSliceVar(&schemaPolicy.AllowedHosts, "allowed_host", nil, "Hosts (name, or name and port) allowed in schema URIs; any host if omitted")
+	serveCmd.Flags().StringSliceVar(&schemaPolicy.AllowedPaths, "allowed_path", nil, "Path prefixes allowed in schema URIs; any path if omitted")
+	serveCmd.Flags().StringVar(&schemaPolicy.SandboxRoot, "schema_root", "", "Directory the schema files must be in, rejecting paths that traverse it or escape it through symbolic links")
+	serveCmd.Flags().StringVarP(&schemaURI, "schema_uri", "u", "", "URI of the schema (with the message type as fragment) of raw protobuf requests without the "+server.SchemaHeader+" header")
+	serveCmd.Flags().StringVar(&registryURL, "registry_url", "", "Base URL of the Schema Registry resolving raw messages framed according to the Confluent wire format")
+	serveCmd.Flags().StringVar(&forwardURL, "forward_url", "", "Endpoint the JSON form of the messages is posted to (replied to the caller if omitted)")
+	serveCmd.Flags().Int64Var(&maxBodySize, "max_body_size", server.DefaultMaxBodySize, "Maximum size in bytes of a request body")
+	serveCmd.Flags().IntVar(&maxConcurrency, "max_concurrency", server.DefaultMaxConcurrency, "Maximum number of requests decoded at the same time")
+	serveCmd.Flags().DurationVar(&shutdownTimeout, "shutdown_timeout", server.DefaultShutdownTimeout, "Time granted to the requests in flight when the server shuts down")
+	serveCmd.Flags().DurationVar(&readHeaderTimeout, "read_header_timeout", server.DefaultReadHeaderTimeout, "Time granted to clients to send the headers of a request")
+	serveCmd.Flags().DurationVar(&readTimeout, "read_timeout", server.DefaultReadTimeout, "Time granted to clients to send a whole request, including its body")
+}
@@ -0,0 +1,297 @@
+package asyncapi
+
+import (
+	"fmt"
+	"regexp"
+
+	"publisher/pkg/jsonschema"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoprint"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Version is the version of the AsyncAPI specification implemented
+// by the documents generated.
+const Version = "3.0.0"
+
+// CloudEventContentType is the content type of CloudEvents encoded in
+// structured mode, as emitted by the publisher.
+const CloudEventContentType = "application/cloudevents+json"
+
+// ProtobufContentType is the content type of the protobuf binary that
+// is carried as payload of the events.
+const ProtobufContentType = "application/protobuf"
+
+// ProtobufSchemaFormat is the AsyncAPI schema format of the payloads that
+// are described by a protobuf definition rather than a JSON Schema.
+const ProtobufSchemaFormat = "application/vnd.google.protobuf;version=3"
+
+// componentKeyPattern matches the characters that are not allowed in the
+// keys of the components and channels of the document.
+var componentKeyPattern = regexp.MustCompile(`[^A-Za-z0-9_.\-]`)
+
+// Document is the generic representation of an AsyncAPI document.
+type Document = map[string]interface{}
+
+// Event maps the value of the CloudEvent `type` attribute to the message
+// descriptor of the protobuf payload carried by events of that type.
+type Event struct {
+	Type    string
+	Message protoreflect.MessageDescriptor
+}
+
+// Info contains the general information about the application that is
+// described by the document.
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+	// SchemaURI is the location of the file descriptor set that is set
+	// (with the message type as fragment) in the `dataschema` attribute.
+	SchemaURI string
+}
+
+// Generate produces an AsyncAPI document describing the CloudEvents that
+// carry the given events. Each event is described by a channel and a send
+// operation, and by two messages: one for the CloudEvent encoded in
+// structured mode, whose `data_base64` attribute carries the protobuf
+// binary, and one for the CloudEvent encoded in binary mode, where the
+// attributes are transported as headers and the body is the protobuf
+// binary. The body of the latter is described by a multi format schema
+// carrying the protobuf definition of the message. The schemas of the
+// protobuf messages under `components/schemas` describe their JSON
+// representation. All the payloads are annotated with `x-protobuf-message`,
+// which is the full name of the message. An error is returned when two
+// event types map to the same component key, or when the definition of a
+// message cannot be rendered.
+func Generate(events []Event, info Info) (Document, error) {
+
+	schemas := jsonschema.Schema{
+		"CloudEvent": cloudEventSchema(),
+	}
+	channels := Document{}
+	operations := Document{}
+	messages := Document{}
+	eventTypes := map[string]string{}
+	wrapped := map[string]*desc.FileDescriptor{}
+
+	for _, event := range events {
+
+		key := componentKey(event.Type)
+		if other, isPresent := eventTypes[key]; isPresent {
+			return nil, fmt.Errorf("event types '%s' and '%s' both map to component key '%s'", other, event.Type, key)
+		}
+		eventTypes[key] = event.Type
+
+		_, definitions := jsonschema.Definitions(event.Message, "#/components/schemas/")
+		for name, definition := range definitions {
+			schemas[name] = definition
+		}
+		definition, err := messageDefinition(event.Message, wrapped)
+		if err != nil {
+			return nil, err
+		}
+
+		messages[key] = Document{
+			"name":        key,
+			"title":       fmt.Sprintf("%s (structured mode)", event.Type),
+			"summary":     fmt.Sprintf("CloudEvent of type '%s' carrying a %s protobuf binary", event.Type, event.Message.FullName()),
+			"contentType": CloudEventContentType,
+			"payload":     structuredPayload(event, info),
+		}
+		messages[key+".binary"] = Document{
+			"name":        key + ".binary",
+			"title":       fmt.Sprintf("%s (binary mode)", event.Type),
+			"summary":     fmt.Sprintf("CloudEvent of type '%s' carrying a %s protobuf binary as body", event.Type, event.Message.FullName()),
+			"contentType": ProtobufContentType,
+			"headers":     binaryHeaders(event, info),
+			"payload": withProtobufType(jsonschema.Schema{
+				"schemaFormat": ProtobufSchemaFormat,
+				"schema":       definition,
+			}, event.Message),
+		}
+
+		channels[key] = Document{
+			"description": fmt.Sprintf("Channel transporting CloudEvents of type '%s'", event.Type),
+			"messages": Document{
+				"structured": Document{"$ref": "#/components/messages/" + key},
+				"binary":     Document{"$ref": "#/components/messages/" + key + ".binary"},
+			},
+		}
+		operations["send"+key] = Document{
+			"action":  "send",
+			"channel": Document{"$ref": "#/channels/" + key},
+			"messages": []interface{}{
+				Document{"$ref": "#/channels/" + key + "/messages/structured"},
+				Document{"$ref": "#/channels/" + key + "/messages/binary"},
+			},
+		}
+	}
+
+	title := info.Title
+	if len(title) == 0 {
+		title = "publisher"
+	}
+	version := info.Version
+	if len(version) == 0 {
+		version = "1.0.0"
+	}
+	infoSection := Document{"title": title, "version": version}
+	if len(info.Description) > 0 {
+		infoSection["description"] = info.Description
+	}
+
+	return Document{
+		"asyncapi":           Version,
+		"info":               infoSection,
+		"defaultContentType": CloudEventContentType,
+		"channels":           channels,
+		"operations":         operations,
+		"components": Document{
+			"messages": messages,
+			"schemas":  schemas,
+		},
+	}, nil
+}
+
+// cloudEventSchema produces the schema of the CloudEvent envelope encoded
+// in structured mode, with the payload carried as base64 protobuf binary.
+func cloudEventSchema() jsonschema.Schema {
+
+	return jsonschema.Schema{
+		"type":  "object",
+		"title": "CloudEvent",
+		"properties": jsonschema.Schema{
+			"specversion":     jsonschema.Schema{"type": "string", "const": "1.0"},
+			"id":              jsonschema.Schema{"type": "string"},
+			"source":          jsonschema.Schema{"type": "string", "format": "uri-reference"},
+			"type":            jsonschema.Schema{"type": "string"},
+			"subject":         jsonschema.Schema{"type": "string"},
+			"time":            jsonschema.Schema{"type": "string", "format": "date-time"},
+			"datacontenttype": jsonschema.Schema{"type": "string", "const": ProtobufContentType},
+			"dataschema":      jsonschema.Schema{"type": "string", "format": "uri"},
+			"data_base64": jsonschema.Schema{
+				"type":             "string",
+				"contentEncoding":  "base64",
+				"contentMediaType": ProtobufContentType,
+			},
+		},
+		"required": []string{"specversion", "id", "source", "type"},
+	}
+}
+
+// structuredPayload produces the schema of the CloudEvent carrying the
+// given event in structured mode.
+func structuredPayload(event Event, info Info) jsonschema.Schema {
+
+	return jsonschema.Schema{
+		"allOf": []interface{}{
+			jsonschema.Schema{"$ref": "#/components/schemas/CloudEvent"},
+			jsonschema.Schema{
+				"properties": jsonschema.Schema{
+					"type":        jsonschema.Schema{"const": event.Type},
+					"dataschema":  dataSchema(event, info),
+					"data_base64": withProtobufType(jsonschema.Schema{"description": fmt.Sprintf("Base64 protobuf binary of %s", event.Message.FullName())}, event.Message),
+				},
+				"required": []string{"datacontenttype", "dataschema", "data_base64"},
+			},
+		},
+	}
+}
+
+// binaryHeaders produces the schema of the headers that carry the
+// attributes of the CloudEvent when encoded in binary mode.
+func binaryHeaders(event Event, info Info) jsonschema.Schema {
+
+	return jsonschema.Schema{
+		"type": "object",
+		"properties": jsonschema.Schema{
+			"ce-specversion": jsonschema.Schema{"type": "string", "const": "1.0"},
+			"ce-id":          jsonschema.Schema{"type": "string"},
+			"ce-source":      jsonschema.Schema{"type": "string", "format": "uri-reference"},
+			"ce-type":        jsonschema.Schema{"type": "string", "const": event.Type},
+			"ce-subject":     jsonschema.Schema{"type": "string"},
+			"ce-time":        jsonschema.Schema{"type": "string", "format": "date-time"},
+			"ce-dataschema":  dataSchema(event, info),
+			"content-type":   jsonschema.Schema{"type": "string", "const": ProtobufContentType},
+		},
+		"required": []string{"ce-specversion", "ce-id", "ce-source", "ce-type", "ce-dataschema"},
+	}
+}
+
+// dataSchema produces the schema of the `dataschema` attribute, which
+// points to the file descriptor set and has the message type as fragment.
+func dataSchema(event Event, info Info) jsonschema.Schema {
+
+	schema := jsonschema.Schema{
+		"type":    "string",
+		"format":  "uri",
+		"pattern": fmt.Sprintf("#(%s|%s)$", regexp.QuoteMeta(string(event.Message.Name())), regexp.QuoteMeta(string(event.Message.FullName()))),
+	}
+	if len(info.SchemaURI) > 0 {
+		schema["examples"] = []string{fmt.Sprintf("%s#%s", info.SchemaURI, event.Message.Name())}
+	}
+	return schema
+}
+
+// withProtobufType annotates the schema of a payload with the full name
+// of the protobuf message it represents.
+func withProtobufType(schema jsonschema.Schema, md protoreflect.MessageDescriptor) jsonschema.Schema {
+
+	annotated := jsonschema.Schema{"x-protobuf-message": string(md.FullName())}
+	for key, value := range schema {
+		annotated[key] = value
+	}
+	return annotated
+}
+
+// messageDefinition renders the protobuf definition of the given message,
+// as it would appear in its .proto file. The files converted to render the
+// definitions are cached in `wrapped`, indexed by their path.
+func messageDefinition(md protoreflect.MessageDescriptor, wrapped map[string]*desc.FileDescriptor) (string, error) {
+
+	file, err := wrapFile(md.ParentFile(), wrapped)
+	if err != nil {
+		return "", fmt.Errorf("cannot render the definition of %s: %v", md.FullName(), err)
+	}
+	message := file.FindMessage(string(md.FullName()))
+	if message == nil {
+		return "", fmt.Errorf("cannot render the definition of %s: message not found", md.FullName())
+	}
+	printer := protoprint.Printer{Compact: true}
+	return printer.PrintProtoToString(message)
+}
+
+// wrapFile converts the given file, and the files it imports, into the
+// descriptors used by the protoprint package.
+func wrapFile(fd protoreflect.FileDescriptor, wrapped map[string]*desc.FileDescriptor) (*desc.FileDescriptor, error) {
+
+	if file, isPresent := wrapped[fd.Path()]; isPresent {
+		return file, nil
+	}
+	dependencies := []*desc.FileDescriptor{}
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		dependency, err := wrapFile(imports.Get(i).FileDescriptor, wrapped)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	file, err := desc.CreateFileDescriptor(protodesc.ToFileDescriptorProto(fd), dependencies...)
+	if err != nil {
+		return nil, err
+	}
+	wrapped[fd.Path()] = file
+	return file, nil
+}
+
+// componentKey converts an event type into a key that is valid for the
+// components and channels of the document. Distinct event types may map
+// to the same key (e.g. `a/b` and `a_b`), which the caller must detect.
+func componentKey(eventType string) string {
+
+	return componentKeyPattern.ReplaceAllString(eventType, "_")
+}
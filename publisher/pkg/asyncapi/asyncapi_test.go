@@ -0,0 +1,128 @@
+package asyncapi
+
+import (
+	"strings"
+	"testing"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// descriptorOf returns the descriptor of the given sample message.
+func descriptorOf(message proto.Message) protoreflect.MessageDescriptor {
+
+	return message.ProtoReflect().Descriptor()
+}
+
+// component returns the document found under the given path of keys.
+func component(t *testing.T, document Document, keys ...string) Document {
+
+	t.Helper()
+	current := document
+	for _, key := range keys {
+		next, isPresent := current[key].(Document)
+		if !isPresent {
+			t.Fatalf("missing %s in %v", strings.Join(keys, "/"), current)
+		}
+		current = next
+	}
+	return current
+}
+
+func TestGenerate(t *testing.T) {
+
+	document, err := Generate([]Event{
+		{Type: "com.example/simple", Message: descriptorOf(&events.SimpleMessage{})},
+		{Type: "import", Message: descriptorOf(&events.ImportMessage{})},
+	}, Info{Title: "samples", SchemaURI: "root.pb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if document["asyncapi"] != Version || component(t, document, "info")["title"] != "samples" || component(t, document, "info")["version"] != "1.0.0" {
+		t.Errorf("unexpected document: %v", document)
+	}
+
+	// the event type is sanitised in the keys.
+	channel := component(t, document, "channels", "com.example_simple")
+	if component(t, channel, "messages", "binary")["$ref"] != "#/components/messages/com.example_simple.binary" {
+		t.Errorf("unexpected channel: %v", channel)
+	}
+	operation := component(t, document, "operations", "sendcom.example_simple")
+	if operation["action"] != "send" || component(t, operation, "channel")["$ref"] != "#/channels/com.example_simple" {
+		t.Errorf("unexpected operation: %v", operation)
+	}
+
+	structured := component(t, document, "components", "messages", "com.example_simple")
+	if structured["contentType"] != CloudEventContentType {
+		t.Errorf("unexpected message: %v", structured)
+	}
+	dataschema := component(t, structured["payload"].(Document)["allOf"].([]interface{})[1].(Document), "properties", "dataschema")
+	if examples := dataschema["examples"].([]string); len(examples) != 1 || examples[0] != "root.pb#SimpleMessage" {
+		t.Errorf("unexpected dataschema: %v", dataschema)
+	}
+
+	// the JSON representation of the messages is described too, well
+	// known types included.
+	schemas := component(t, document, "components", "schemas")
+	for _, name := range []string{"CloudEvent", "hyp0th3rmi4.protobuf.sample.SimpleMessage", "hyp0th3rmi4.protobuf.sample.ImportMessage", "hyp0th3rmi4.protobuf.sample.SubMessage"} {
+		if _, isPresent := schemas[name]; !isPresent {
+			t.Errorf("missing schema %s", name)
+		}
+	}
+}
+
+func TestGenerateBinaryPayload(t *testing.T) {
+
+	document, err := Generate([]Event{{Type: "import", Message: descriptorOf(&events.ImportMessage{})}}, Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := component(t, document, "components", "messages", "import.binary")
+	if binary["contentType"] != ProtobufContentType || component(t, binary, "headers", "properties", "ce-type")["const"] != "import" {
+		t.Errorf("unexpected message: %v", binary)
+	}
+
+	// the body is described by the protobuf definition of the message.
+	payload := component(t, binary, "payload")
+	if payload["schemaFormat"] != ProtobufSchemaFormat || payload["x-protobuf-message"] != "hyp0th3rmi4.protobuf.sample.ImportMessage" {
+		t.Errorf("unexpected payload: %v", payload)
+	}
+	expected := strings.Join([]string{
+		"message ImportMessage {",
+		"  google.protobuf.Timestamp param_01 = 1;",
+		"  SubMessage param_02 = 2;",
+		"}",
+		"",
+	}, "\n")
+	if payload["schema"] != expected {
+		t.Errorf("unexpected definition:\n%v", payload["schema"])
+	}
+}
+
+func TestGenerateRejectsKeyCollisions(t *testing.T) {
+
+	_, err := Generate([]Event{
+		{Type: "a/b", Message: descriptorOf(&events.SimpleMessage{})},
+		{Type: "a_b", Message: descriptorOf(&events.ComplexMessage{})},
+	}, Info{})
+	if err == nil || !strings.Contains(err.Error(), "'a/b' and 'a_b' both map to component key 'a_b'") {
+		t.Errorf("expected the collision to be rejected, got: %v", err)
+	}
+}
+
+func TestComponentKey(t *testing.T) {
+
+	for eventType, expected := range map[string]string{
+		"SimpleMessage":           "SimpleMessage",
+		"com.example.simple-v1":   "com.example.simple-v1",
+		"com.example/simple:v1 x": "com.example_simple_v1_x",
+	} {
+		if actual := componentKey(eventType); actual != expected {
+			t.Errorf("unexpected key of %s: %s", eventType, actual)
+		}
+	}
+}
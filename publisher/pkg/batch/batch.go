@@ -0,0 +1,274 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"publisher/pkg/logging"
+)
+
+// OutputExtension is the extension appended to the path of the inputs to
+// obtain the path of the JSON outputs (e.g. `event.bin` becomes
+// `event.bin.json`).
+const OutputExtension = ".json"
+
+// Input is a file to parse, together with the root of the directory or glob
+// it has been found through, which is used to mirror the tree of the inputs
+// into the output directory.
+type Input struct {
+	Path string
+	Root string
+}
+
+// ParseFunc parses the file with the given path and returns the value to be
+// written, as JSON, to the output.
+type ParseFunc func(path string) (interface{}, error)
+
+// Options configures the execution of a batch.
+type Options struct {
+	// Workers is the maximum number of files parsed at the same time,
+	// values lower than one are replaced by one.
+	Workers int
+	// OutputDirectory is the root of the tree where outputs are written,
+	// mirroring the tree of the inputs. When empty, the outputs are
+	// written next to the inputs.
+	OutputDirectory string
+}
+
+// Failure records the input that could not be parsed or written.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// Summary reports the outcome of a batch.
+type Summary struct {
+	Succeeded int
+	Failed    int
+	// Failures lists the failed inputs in lexical order of path.
+	Failures []Failure
+	Elapsed  time.Duration
+}
+
+// Throughput returns the number of files processed per second.
+func (s Summary) Throughput() float64 {
+
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Succeeded+s.Failed) / s.Elapsed.Seconds()
+}
+
+// IsPattern determines whether the given source refers to multiple files,
+// being either a directory or a glob pattern.
+func IsPattern(source string) bool {
+
+	if strings.ContainsAny(source, "*?[") {
+		return true
+	}
+	info, err := os.Stat(source)
+	return err == nil && info.IsDir()
+}
+
+// Expand resolves the given sources into the files to parse. Directories are
+// walked recursively, glob patterns (as supported by filepath.Match) are
+// matched, and any other source is a file. Outputs of previous runs found
+// in directories or matched by patterns (files named after another file with
+// the OutputExtension appended) are skipped, as well as the outputs written
+// to an output directory nested in the tree of the inputs, whose files are
+// not matched nor walked. Files matched by several sources are returned once.
+func Expand(outputDirectory string, sources ...string) ([]Input, error) {
+
+	excluded := ""
+	if len(outputDirectory) > 0 {
+		var err error
+		excluded, err = filepath.Abs(outputDirectory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// isNestedOutput determines whether the path is in the output directory
+	// while the root of the inputs is not.
+	isNestedOutput := func(path string, root string) bool {
+		return isWithin(excluded, path) && !isWithin(excluded, root)
+	}
+
+	inputs := []Input{}
+	seen := map[string]bool{}
+	add := func(path string, root string) {
+		if !seen[path] {
+			seen[path] = true
+			inputs = append(inputs, Input{Path: path, Root: root})
+		}
+	}
+
+	for _, source := range sources {
+
+		if strings.ContainsAny(source, "*?[") {
+			matches, err := filepath.Glob(source)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", source, err)
+			}
+			root := globRoot(source)
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() && !isOutput(match) && !isNestedOutput(match, root) {
+					add(match, root)
+				}
+			}
+			continue
+		}
+
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(source, filepath.Dir(source))
+			continue
+		}
+		err = filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() && isNestedOutput(path, source) {
+				return filepath.SkipDir
+			}
+			if entry.Type().IsRegular() && !isOutput(path) {
+				add(path, source)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].Path < inputs[j].Path })
+	return inputs, nil
+}
+
+// Run parses the given inputs with a pool of workers, and writes the JSON
+// form of each result to the output path of the input (see OutputPath).
+// Failures do not stop the batch, and are reported by the summary.
+func Run(inputs []Input, parse ParseFunc, options Options) Summary {
+
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	start := time.Now()
+	queue := make(chan Input)
+	failures := make(chan Failure, len(inputs))
+
+	var wait sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for input := range queue {
+				err := process(input, parse, options.OutputDirectory)
+				if err != nil {
+					logging.SugarLog.Infof("Could not parse file (path: %s): %v", input.Path, err)
+					failures <- Failure{Path: input.Path, Err: err}
+				}
+			}
+		}()
+	}
+
+	for _, input := range inputs {
+		queue <- input
+	}
+	close(queue)
+	wait.Wait()
+	close(failures)
+
+	summary := Summary{Failures: []Failure{}}
+	for failure := range failures {
+		summary.Failures = append(summary.Failures, failure)
+	}
+	sort.Slice(summary.Failures, func(i, j int) bool { return summary.Failures[i].Path < summary.Failures[j].Path })
+	summary.Failed = len(summary.Failures)
+	summary.Succeeded = len(inputs) - summary.Failed
+	summary.Elapsed = time.Since(start)
+	return summary
+}
+
+// OutputPath returns the path of the output of the given input: next to the
+// input when the output directory is empty, or in the output directory at
+// the path of the input relative to its root otherwise.
+func OutputPath(input Input, outputDirectory string) (string, error) {
+
+	if len(outputDirectory) == 0 {
+		return input.Path + OutputExtension, nil
+	}
+	relative, err := filepath.Rel(input.Root, input.Path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(outputDirectory, relative) + OutputExtension, nil
+}
+
+// process parses a single input and writes its output.
+func process(input Input, parse ParseFunc, outputDirectory string) error {
+
+	result, err := parse(input.Path)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	target, err := OutputPath(input, outputDirectory)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0644)
+}
+
+// isOutput determines whether the file with the given path is the output of
+// another file.
+func isOutput(path string) bool {
+
+	if !strings.HasSuffix(path, OutputExtension) {
+		return false
+	}
+	info, err := os.Stat(strings.TrimSuffix(path, OutputExtension))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isWithin determines whether the given path is the directory, whose path
+// is absolute, or is located under it. No path is within an empty directory.
+func isWithin(directory string, path string) bool {
+
+	if len(directory) == 0 {
+		return false
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	relative, err := filepath.Rel(directory, absolute)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// globRoot returns the directory preceding the first element of the pattern
+// that contains meta characters.
+func globRoot(pattern string) string {
+
+	index := strings.IndexAny(pattern, "*?[")
+	return filepath.Dir(pattern[:index+1])
+}
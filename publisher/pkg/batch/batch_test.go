@@ -0,0 +1,317 @@
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTree creates the given files (with their path relative to the root)
+// and returns the root.
+func newTree(t *testing.T, files ...string) string {
+
+	t.Helper()
+	root := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// relativePaths returns the paths of the inputs relative to the root, in
+// slash-separated form.
+func relativePaths(t *testing.T, root string, inputs []Input) string {
+
+	t.Helper()
+	paths := []string{}
+	for _, input := range inputs {
+		relative, err := filepath.Rel(root, input.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(relative))
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestExpandDirectory(t *testing.T) {
+
+	root := newTree(t, "a.bin", "a.bin.json", "orphan.json", "sub/b.bin", "sub/b.bin.json", "sub/deeper/c.bin")
+
+	inputs, err := Expand("", root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the outputs of previous runs are skipped, other JSON files are not.
+	if paths := relativePaths(t, root, inputs); paths != "a.bin,orphan.json,sub/b.bin,sub/deeper/c.bin" {
+		t.Errorf("unexpected inputs: %s", paths)
+	}
+	for _, input := range inputs {
+		if input.Root != root {
+			t.Errorf("unexpected root of %s: %s", input.Path, input.Root)
+		}
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+
+	root := newTree(t, "a.bin", "a.bin.json", "b.txt", "sub/b.bin", "sub/c.bin", "sub/c.bin.json", "other/d.bin")
+
+	inputs, err := Expand("", filepath.Join(root, "sub", "*"), filepath.Join(root, "*.bin"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths := relativePaths(t, root, inputs); paths != "a.bin,sub/b.bin,sub/c.bin" {
+		t.Errorf("unexpected inputs: %s", paths)
+	}
+	// the root of a glob is the directory preceding its first pattern.
+	for _, input := range inputs {
+		if input.Root != filepath.Dir(input.Path) {
+			t.Errorf("unexpected root of %s: %s", input.Path, input.Root)
+		}
+	}
+
+	inputs, err = Expand("", filepath.Join(root, "*", "*.bin"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths := relativePaths(t, root, inputs); paths != "other/d.bin,sub/b.bin,sub/c.bin" {
+		t.Errorf("unexpected inputs: %s", paths)
+	}
+	if inputs[0].Root != root {
+		t.Errorf("unexpected root: %s", inputs[0].Root)
+	}
+}
+
+func TestExpandDeduplicates(t *testing.T) {
+
+	root := newTree(t, "a.bin", "sub/b.bin")
+
+	inputs, err := Expand("", root, filepath.Join(root, "a.bin"), filepath.Join(root, "*", "*.bin"), root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths := relativePaths(t, root, inputs); paths != "a.bin,sub/b.bin" {
+		t.Errorf("unexpected inputs: %s", paths)
+	}
+	// the first source finding a file gives its root.
+	if inputs[1].Root != root {
+		t.Errorf("unexpected root: %s", inputs[1].Root)
+	}
+}
+
+func TestExpandSkipsNestedOutputDirectory(t *testing.T) {
+
+	// the outputs of a previous run with --output_dir out, which do not
+	// have an input next to them.
+	root := newTree(t, "a.bin", "sub/b.bin", "out/a.bin.json", "out/sub/b.bin.json")
+	output := filepath.Join(root, "out")
+
+	inputs, err := Expand(output, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths := relativePaths(t, root, inputs); paths != "a.bin,sub/b.bin" {
+		t.Errorf("unexpected inputs: %s", paths)
+	}
+
+	inputs, err = Expand(output, filepath.Join(root, "*", "*"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths := relativePaths(t, root, inputs); paths != "sub/b.bin" {
+		t.Errorf("unexpected inputs: %s", paths)
+	}
+
+	// a relative output directory is the same directory.
+	working, _ := os.Getwd()
+	defer os.Chdir(working)
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	inputs, err = Expand("out", ".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths := relativePaths(t, ".", inputs); paths != "a.bin,sub/b.bin" {
+		t.Errorf("unexpected inputs: %s", paths)
+	}
+}
+
+func TestExpandOutputDirectoryContainingInputs(t *testing.T) {
+
+	root := newTree(t, "in/a.bin", "in/a.bin.json", "in/sub/b.bin")
+
+	// the output directory is the tree of the inputs, or contains it.
+	for _, output := range []string{filepath.Join(root, "in"), root} {
+		inputs, err := Expand(output, filepath.Join(root, "in"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if paths := relativePaths(t, root, inputs); paths != "in/a.bin,in/sub/b.bin" {
+			t.Errorf("unexpected inputs (output: %s): %s", output, paths)
+		}
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+
+	root := newTree(t, "a.bin")
+
+	if _, err := Expand("", filepath.Join(root, "missing.bin")); err == nil {
+		t.Errorf("expected a missing file to be reported")
+	}
+	if _, err := Expand("", filepath.Join(root, "[")); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("expected the pattern to be rejected, got: %v", err)
+	}
+	inputs, err := Expand("", filepath.Join(root, "*.proto"))
+	if err != nil || len(inputs) != 0 {
+		t.Errorf("expected no inputs, got: %v (%v)", inputs, err)
+	}
+}
+
+// parseContent returns the content of the file, and fails for the files
+// whose name contains `fail`.
+func parseContent(path string) (interface{}, error) {
+
+	if strings.Contains(filepath.Base(path), "fail") {
+		return nil, errors.New("could not parse " + filepath.Base(path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"content": string(data)}, nil
+}
+
+// expectOutput fails the test if the output at the given path is not the
+// result of parseContent for the given content.
+func expectOutput(t *testing.T, path string, content string) {
+
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing output: %v", err)
+	}
+	output := map[string]string{}
+	if err := json.Unmarshal(data, &output); err != nil || output["content"] != content {
+		t.Errorf("unexpected output %s: %s", path, data)
+	}
+}
+
+func TestRunWritesNextToInputs(t *testing.T) {
+
+	root := newTree(t, "a.bin", "sub/b.bin", "sub/fail.bin", "fail.bin")
+	inputs, err := Expand("", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := Run(inputs, parseContent, Options{Workers: 3})
+	if summary.Succeeded != 2 || summary.Failed != 2 || len(summary.Failures) != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	// the failures are aggregated in lexical order of path.
+	if summary.Failures[0].Path != filepath.Join(root, "fail.bin") || summary.Failures[1].Path != filepath.Join(root, "sub", "fail.bin") {
+		t.Errorf("unexpected failures: %+v", summary.Failures)
+	}
+	if !strings.Contains(summary.Failures[1].Err.Error(), "could not parse fail.bin") {
+		t.Errorf("unexpected error: %v", summary.Failures[1].Err)
+	}
+
+	expectOutput(t, filepath.Join(root, "a.bin.json"), "a.bin")
+	expectOutput(t, filepath.Join(root, "sub", "b.bin.json"), "sub/b.bin")
+	if _, err := os.Stat(filepath.Join(root, "fail.bin.json")); !os.IsNotExist(err) {
+		t.Errorf("unexpected output of a failure: %v", err)
+	}
+
+	// the outputs are skipped by the next run.
+	inputs, err = Expand("", root)
+	if err != nil || len(inputs) != 4 {
+		t.Errorf("unexpected inputs of the next run: %d (%v)", len(inputs), err)
+	}
+}
+
+func TestRunMirrorsTreeInOutputDirectory(t *testing.T) {
+
+	root := newTree(t, "in/a.bin", "in/sub/b.bin", "in/sub/deeper/c.bin")
+	output := filepath.Join(root, "in", "out")
+	inputs, err := Expand(output, filepath.Join(root, "in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := Run(inputs, parseContent, Options{OutputDirectory: output})
+	if summary.Succeeded != 3 || summary.Failed != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	expectOutput(t, filepath.Join(output, "a.bin.json"), "in/a.bin")
+	expectOutput(t, filepath.Join(output, "sub", "b.bin.json"), "in/sub/b.bin")
+	expectOutput(t, filepath.Join(output, "sub", "deeper", "c.bin.json"), "in/sub/deeper/c.bin")
+
+	// the outputs, nested in the tree of the inputs, are not parsed again.
+	inputs, err = Expand(output, filepath.Join(root, "in"))
+	if err != nil || len(inputs) != 3 {
+		t.Errorf("unexpected inputs of the next run: %v (%v)", inputs, err)
+	}
+}
+
+func TestRunReportsWriteFailures(t *testing.T) {
+
+	root := newTree(t, "a.bin", "b.bin")
+	inputs, err := Expand("", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a file in place of the output directory.
+	output := filepath.Join(root, "a.bin")
+
+	summary := Run(inputs, parseContent, Options{OutputDirectory: output})
+	if summary.Failed != 2 || summary.Succeeded != 0 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	unmarshalable := func(path string) (interface{}, error) { return make(chan int), nil }
+	summary = Run(inputs, unmarshalable, Options{})
+	if summary.Failed != 2 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+
+	input := Input{Path: filepath.Join("data", "sub", "event.bin"), Root: "data"}
+
+	if path, err := OutputPath(input, ""); err != nil || path != filepath.Join("data", "sub", "event.bin.json") {
+		t.Errorf("unexpected path: %s (%v)", path, err)
+	}
+	if path, err := OutputPath(input, "out"); err != nil || path != filepath.Join("out", "sub", "event.bin.json") {
+		t.Errorf("unexpected path: %s (%v)", path, err)
+	}
+}
+
+func TestIsPattern(t *testing.T) {
+
+	root := newTree(t, "a.bin")
+	for source, expected := range map[string]bool{
+		root:                            true,
+		filepath.Join(root, "*.bin"):    true,
+		filepath.Join(root, "a.bi?"):    true,
+		filepath.Join(root, "[ab].bin"): true,
+		filepath.Join(root, "a.bin"):    false,
+		filepath.Join(root, "missing"):  false,
+	} {
+		if IsPattern(source) != expected {
+			t.Errorf("unexpected result for %s: %t", source, !expected)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package bundle
+
+import (
+	"fmt"
+	"sort"
+
+	"publisher/pkg/export"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Stats measures the content of a file descriptor set.
+type Stats struct {
+	Files int `json:"files"`
+	Types int `json:"types"`
+	Bytes int `json:"bytes"`
+}
+
+// Report compares the file descriptor set a bundle is extracted from with
+// the bundle itself.
+type Report struct {
+	Root     protoreflect.FullName `json:"root"`
+	Original Stats                 `json:"original"`
+	Bundled  Stats                 `json:"bundled"`
+}
+
+// Reduction returns the percentage of bytes saved by the bundle.
+func (r Report) Reduction() float64 {
+
+	if r.Original.Bytes == 0 {
+		return 0
+	}
+	return 100 * float64(r.Original.Bytes-r.Bundled.Bytes) / float64(r.Original.Bytes)
+}
+
+// String renders the report as human readable text.
+func (r Report) String() string {
+
+	return fmt.Sprintf("bundle of %s\n  files: %d -> %d\n  types: %d -> %d\n  bytes: %d -> %d (%.1f%% smaller)",
+		r.Root, r.Original.Files, r.Bundled.Files, r.Original.Types, r.Bundled.Types, r.Original.Bytes, r.Bundled.Bytes, r.Reduction())
+}
+
+// Build computes the minimal file descriptor set required to decode messages
+// of the given root type. The set contains the messages and enums reachable
+// from the fields of the root message, transitively, together with the
+// messages enclosing them (which are kept whole, along with the types their
+// fields need), and only the files declaring them. Services, extensions,
+// unused types and the imports that are no longer needed are dropped, as is
+// the source code information, whose locations would not match the pruned
+// files. Custom options are kept as they are, even when the file declaring
+// them is dropped. The files follow their dependencies, and the set is the
+// same for the same root type, regardless of the order in which the files
+// of the original schema were defined.
+func Build(root protoreflect.MessageDescriptor) (*descriptorpb.FileDescriptorSet, error) {
+
+	b := &builder{types: map[protoreflect.FullName]bool{}, files: map[string]protoreflect.FileDescriptor{}}
+	b.addMessage(root)
+
+	pruned := map[string]*descriptorpb.FileDescriptorProto{}
+	for path, file := range b.files {
+		pruned[path] = b.prune(file)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	visited := map[string]bool{}
+	var visit func(path string)
+	visit = func(path string) {
+		if visited[path] {
+			return
+		}
+		visited[path] = true
+		for _, dependency := range pruned[path].Dependency {
+			visit(dependency)
+		}
+		set.File = append(set.File, pruned[path])
+	}
+	visit(root.ParentFile().Path())
+
+	// the bundle is validated by building the files it contains.
+	if _, err := protodesc.NewFiles(set); err != nil {
+		return nil, fmt.Errorf("invalid bundle for %s: %v", root.FullName(), err)
+	}
+	return set, nil
+}
+
+// Measure returns the statistics of the given file descriptor set, whose
+// size is the one of its deterministic serialisation.
+func Measure(set *descriptorpb.FileDescriptorSet) (Stats, error) {
+
+	data, err := export.Marshal(set)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{Files: len(set.File), Bytes: len(data)}
+	for _, file := range set.File {
+		stats.Types += countTypes(file.MessageType, len(file.EnumType))
+	}
+	return stats, nil
+}
+
+// FileDescriptorSet converts the files of the given registry into a file
+// descriptor set, sorted by path.
+func FileDescriptorSet(files *protoregistry.Files) *descriptorpb.FileDescriptorSet {
+
+	set := &descriptorpb.FileDescriptorSet{}
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+		return true
+	})
+	sort.Slice(set.File, func(i, j int) bool { return set.File[i].GetName() < set.File[j].GetName() })
+	return set
+}
+
+// countTypes counts the given messages, with their nested messages and
+// enums, and adds the given number of enums.
+func countTypes(messages []*descriptorpb.DescriptorProto, enums int) int {
+
+	count := enums
+	for _, message := range messages {
+		count += 1 + countTypes(message.NestedType, len(message.EnumType))
+	}
+	return count
+}
+
+// builder collects the types reachable from a root message and the files
+// declaring them.
+type builder struct {
+	types map[protoreflect.FullName]bool
+	files map[string]protoreflect.FileDescriptor
+}
+
+// addMessage adds the given message, the messages enclosing it and the types
+// of their fields.
+func (b *builder) addMessage(md protoreflect.MessageDescriptor) {
+
+	if b.types[md.FullName()] {
+		return
+	}
+	b.types[md.FullName()] = true
+	b.files[md.ParentFile().Path()] = md.ParentFile()
+	b.addParent(md.Parent())
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Message() != nil {
+			b.addMessage(field.Message())
+		}
+		if field.Enum() != nil {
+			b.addEnum(field.Enum())
+		}
+	}
+}
+
+// addEnum adds the given enum and the messages enclosing it.
+func (b *builder) addEnum(ed protoreflect.EnumDescriptor) {
+
+	if b.types[ed.FullName()] {
+		return
+	}
+	b.types[ed.FullName()] = true
+	b.files[ed.ParentFile().Path()] = ed.ParentFile()
+	b.addParent(ed.Parent())
+}
+
+// addParent adds the given parent of a type, if it is a message.
+func (b *builder) addParent(parent protoreflect.Descriptor) {
+
+	if md, isMessage := parent.(protoreflect.MessageDescriptor); isMessage {
+		b.addMessage(md)
+	}
+}
+
+// prune converts the given file into its descriptor, keeping only the types
+// collected and the imports of the files declaring the types of their fields.
+func (b *builder) prune(file protoreflect.FileDescriptor) *descriptorpb.FileDescriptorProto {
+
+	fdp := protodesc.ToFileDescriptorProto(file)
+	prefix := ""
+	if len(file.Package()) > 0 {
+		prefix = string(file.Package()) + "."
+	}
+	fdp.MessageType = b.pruneMessages(prefix, fdp.MessageType)
+	fdp.EnumType = b.pruneEnums(prefix, fdp.EnumType)
+	fdp.Service = nil
+	fdp.Extension = nil
+	fdp.SourceCodeInfo = nil
+	fdp.PublicDependency = nil
+	fdp.WeakDependency = nil
+
+	dependencies := map[string]bool{}
+	b.collectDependencies(file.Path(), file.Messages(), dependencies)
+	fdp.Dependency = nil
+	for dependency := range dependencies {
+		fdp.Dependency = append(fdp.Dependency, dependency)
+	}
+	sort.Strings(fdp.Dependency)
+	return fdp
+}
+
+// pruneMessages keeps the messages collected among the given ones, whose
+// full names start with the given prefix, and prunes their nested types.
+func (b *builder) pruneMessages(prefix string, messages []*descriptorpb.DescriptorProto) []*descriptorpb.DescriptorProto {
+
+	kept := []*descriptorpb.DescriptorProto{}
+	for _, message := range messages {
+		name := prefix + message.GetName()
+		if !b.types[protoreflect.FullName(name)] {
+			continue
+		}
+		message.NestedType = b.pruneMessages(name+".", message.NestedType)
+		message.EnumType = b.pruneEnums(name+".", message.EnumType)
+		message.Extension = nil
+		kept = append(kept, message)
+	}
+	return kept
+}
+
+// pruneEnums keeps the enums collected among the given ones, whose full
+// names start with the given prefix.
+func (b *builder) pruneEnums(prefix string, enums []*descriptorpb.EnumDescriptorProto) []*descriptorpb.EnumDescriptorProto {
+
+	kept := []*descriptorpb.EnumDescriptorProto{}
+	for _, enum := range enums {
+		if b.types[protoreflect.FullName(prefix+enum.GetName())] {
+			kept = append(kept, enum)
+		}
+	}
+	return kept
+}
+
+// collectDependencies adds to `dependencies` the paths of the files, other
+// than the given one, declaring the types of the fields of the collected
+// messages among the given ones (and their nested messages).
+func (b *builder) collectDependencies(path string, messages protoreflect.MessageDescriptors, dependencies map[string]bool) {
+
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if !b.types[md.FullName()] {
+			continue
+		}
+		fields := md.Fields()
+		for j := 0; j < fields.Len(); j++ {
+			var dependency protoreflect.Descriptor
+			field := fields.Get(j)
+			if field.Message() != nil {
+				dependency = field.Message()
+			} else if field.Enum() != nil {
+				dependency = field.Enum()
+			}
+			if dependency != nil && dependency.ParentFile().Path() != path {
+				dependencies[dependency.ParentFile().Path()] = true
+			}
+		}
+		b.collectDependencies(path, md.Messages(), dependencies)
+	}
+}
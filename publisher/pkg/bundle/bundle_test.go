@@ -0,0 +1,301 @@
+package bundle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"publisher/pkg/export"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	message  = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	enum     = descriptorpb.FieldDescriptorProto_TYPE_ENUM
+)
+
+// field creates the descriptor of a field.
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+
+	fdp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     kind.Enum(),
+	}
+	if len(typeName) > 0 {
+		fdp.TypeName = proto.String(typeName)
+	}
+	return fdp
+}
+
+// testFiles returns the files of the test schema:
+//
+//	bundle/root.proto   -> common.proto, other.proto (unused)
+//	bundle/common.proto -> extra.proto, other.proto
+//	bundle/extra.proto
+//	bundle/other.proto
+//
+// where the root message only uses the nested message `Outer.Inner`, whose
+// enclosing message uses a message of `extra.proto`.
+func testFiles() []*descriptorpb.FileDescriptorProto {
+
+	return []*descriptorpb.FileDescriptorProto{
+		{
+			Name:       proto.String("bundle/root.proto"),
+			Package:    proto.String("bundle.test"),
+			Syntax:     proto.String("proto2"),
+			Dependency: []string{"bundle/common.proto", "bundle/other.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name:           proto.String("Root"),
+				Field:          []*descriptorpb.FieldDescriptorProto{field("inner", 1, optional, message, ".bundle.test.Outer.Inner")},
+				ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{{Start: proto.Int32(100), End: proto.Int32(200)}},
+			}},
+			Extension: []*descriptorpb.FieldDescriptorProto{func() *descriptorpb.FieldDescriptorProto {
+				extension := field("tag", 100, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, "")
+				extension.Extendee = proto.String(".bundle.test.Root")
+				return extension
+			}()},
+			SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+				Path: []int32{4, 0},
+				Span: []int32{0, 0, 10},
+			}}},
+		},
+		{
+			Name:       proto.String("bundle/common.proto"),
+			Package:    proto.String("bundle.test"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"bundle/extra.proto", "bundle/other.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{
+				{
+					Name:  proto.String("Unused"),
+					Field: []*descriptorpb.FieldDescriptorProto{field("other", 1, optional, message, ".bundle.test.Other")},
+				},
+				{
+					Name:  proto.String("Outer"),
+					Field: []*descriptorpb.FieldDescriptorProto{field("extra", 1, optional, message, ".bundle.test.Extra")},
+					NestedType: []*descriptorpb.DescriptorProto{
+						{
+							Name:  proto.String("Inner"),
+							Field: []*descriptorpb.FieldDescriptorProto{field("color", 1, optional, enum, ".bundle.test.Color")},
+						},
+						{Name: proto.String("Spare")},
+					},
+				},
+			},
+			EnumType: []*descriptorpb.EnumDescriptorProto{{
+				Name: proto.String("Color"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{
+					{Name: proto.String("NONE"), Number: proto.Int32(0)},
+					{Name: proto.String("RED"), Number: proto.Int32(1)},
+				},
+			}},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Service"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("Call"),
+					InputType:  proto.String(".bundle.test.Unused"),
+					OutputType: proto.String(".bundle.test.Unused"),
+				}},
+			}},
+		},
+		{
+			Name:        proto.String("bundle/extra.proto"),
+			Package:     proto.String("bundle.test"),
+			Syntax:      proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Extra")}, {Name: proto.String("Unrelated")}},
+		},
+		{
+			Name:        proto.String("bundle/other.proto"),
+			Package:     proto.String("bundle.test"),
+			Syntax:      proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Other")}},
+		},
+	}
+}
+
+// testRoot builds the test schema from its files, defined in the given
+// order, and returns the registry and the root message.
+func testRoot(t *testing.T, order []int) (*protoregistry.Files, protoreflect.MessageDescriptor) {
+
+	t.Helper()
+	all := testFiles()
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, i := range order {
+		set.File = append(set.File, all[i])
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	descriptor, err := files.FindDescriptorByName("bundle.test.Root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files, descriptor.(protoreflect.MessageDescriptor)
+}
+
+// names returns the names of the given messages, with their nested ones.
+func names(messages []*descriptorpb.DescriptorProto) []string {
+
+	result := []string{}
+	for _, message := range messages {
+		result = append(result, message.GetName())
+		for _, nested := range names(message.NestedType) {
+			result = append(result, message.GetName()+"."+nested)
+		}
+	}
+	return result
+}
+
+func TestBuildPrunesToTheClosure(t *testing.T) {
+
+	_, root := testRoot(t, []int{0, 1, 2, 3})
+	set, err := Build(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the files follow their dependencies, and unused files are dropped.
+	paths := []string{}
+	for _, file := range set.File {
+		paths = append(paths, file.GetName())
+	}
+	if strings.Join(paths, ",") != "bundle/extra.proto,bundle/common.proto,bundle/root.proto" {
+		t.Fatalf("unexpected files: %v", paths)
+	}
+	extra, common, bundled := set.File[0], set.File[1], set.File[2]
+
+	// the enclosing message is kept with the types of its fields, but not
+	// its unused nested messages.
+	for _, test := range []struct {
+		file     *descriptorpb.FileDescriptorProto
+		expected string
+	}{
+		{extra, "Extra"},
+		{common, "Outer,Outer.Inner"},
+		{bundled, "Root"},
+	} {
+		if actual := strings.Join(names(test.file.MessageType), ","); actual != test.expected {
+			t.Errorf("%s: unexpected messages: %s", test.file.GetName(), actual)
+		}
+	}
+	if len(common.EnumType) != 1 || common.EnumType[0].GetName() != "Color" {
+		t.Errorf("unexpected enums: %v", common.EnumType)
+	}
+
+	// services, extensions and source information are dropped.
+	if len(common.Service) != 0 || len(bundled.Extension) != 0 || bundled.SourceCodeInfo != nil {
+		t.Errorf("unexpected declarations: %v, %v, %v", common.Service, bundled.Extension, bundled.SourceCodeInfo)
+	}
+}
+
+func TestBuildRewritesDependencies(t *testing.T) {
+
+	_, root := testRoot(t, []int{0, 1, 2, 3})
+	set, err := Build(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// only the imports declaring the types of the kept fields remain.
+	for i, expected := range []string{"", "bundle/extra.proto", "bundle/common.proto"} {
+		if actual := strings.Join(set.File[i].Dependency, ","); actual != expected {
+			t.Errorf("%s: unexpected dependencies: %s", set.File[i].GetName(), actual)
+		}
+	}
+
+	// and they are sorted.
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{Name: proto.String("deps/b.proto"), Package: proto.String("deps"), Syntax: proto.String("proto3"), MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("B")}}},
+		{Name: proto.String("deps/a.proto"), Package: proto.String("deps"), Syntax: proto.String("proto3"), MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("A")}}},
+		{
+			Name:       proto.String("deps/root.proto"),
+			Package:    proto.String("deps"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"deps/b.proto", "deps/a.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name:  proto.String("Root"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("b", 1, optional, message, ".deps.B"), field("a", 2, optional, message, ".deps.A")},
+			}},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor, _ := files.FindDescriptorByName("deps.Root")
+	set, err = Build(descriptor.(protoreflect.MessageDescriptor))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := strings.Join(set.File[2].Dependency, ","); actual != "deps/a.proto,deps/b.proto" {
+		t.Errorf("unexpected dependencies: %s", actual)
+	}
+}
+
+func TestBuildIsIndependentOfFileOrder(t *testing.T) {
+
+	var expected []byte
+	for _, order := range [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}, {2, 0, 3, 1}, {1, 3, 0, 2}} {
+		_, root := testRoot(t, order)
+		set, err := Build(root)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, err := export.Marshal(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected == nil {
+			expected = data
+		} else if !bytes.Equal(data, expected) {
+			t.Errorf("%v: the bundle differs", order)
+		}
+	}
+}
+
+func TestMeasureAndReport(t *testing.T) {
+
+	files, root := testRoot(t, []int{3, 2, 1, 0})
+	original, err := Measure(FileDescriptorSet(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundled, err := Measure(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nested messages and enums are counted as types.
+	if original.Files != 4 || original.Types != 9 || bundled.Files != 3 || bundled.Types != 5 {
+		t.Errorf("unexpected statistics: %+v, %+v", original, bundled)
+	}
+	if bundled.Bytes <= 0 || bundled.Bytes >= original.Bytes {
+		t.Errorf("unexpected sizes: %d, %d", original.Bytes, bundled.Bytes)
+	}
+
+	report := Report{Root: root.FullName(), Original: original, Bundled: bundled}
+	if report.Reduction() <= 0 || report.Reduction() >= 100 {
+		t.Errorf("unexpected reduction: %f", report.Reduction())
+	}
+	text := report.String()
+	for _, line := range []string{"bundle of bundle.test.Root", "files: 4 -> 3", "types: 9 -> 5", "% smaller)"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("missing %q in report:\n%s", line, text)
+		}
+	}
+	if (Report{}).Reduction() != 0 {
+		t.Errorf("unexpected reduction of an empty report")
+	}
+}
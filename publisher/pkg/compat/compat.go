@@ -0,0 +1,461 @@
+package compat
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Compare verifies the compatibility between the `previous` and the
+// `current` version of a schema, both expressed as registries of file
+// descriptors. If `root` is not empty, only the message with the given
+// name and the types reachable from its fields are compared, otherwise
+// all the messages and enumerations defined in the previous version of
+// the schema are compared with their counterpart in the current one.
+// The changes detected are collected in a report, whose severities are
+// computed according to the given compatibility `mode`.
+func Compare(previous *protoregistry.Files, current *protoregistry.Files, root protoreflect.FullName, mode Mode) (*Report, error) {
+
+	c := newComparator(mode)
+
+	if len(root) > 0 {
+
+		previousMessage, err := findMessage(previous, root)
+		if err != nil {
+			return nil, fmt.Errorf("previous schema: %v", err)
+		}
+		currentMessage, err := findMessage(current, root)
+		if err != nil {
+			c.removedMessage(root)
+			return c.report, nil
+		}
+		c.compareMessages(previousMessage, currentMessage)
+		return c.report, nil
+	}
+
+	previousMessages, previousEnums := collectTypes(previous)
+	currentMessages, currentEnums := collectTypes(current)
+
+	for _, name := range sortedNames(previousMessages) {
+		counterpart, isPresent := currentMessages[name]
+		if !isPresent {
+			c.removedMessage(name)
+			continue
+		}
+		c.compareMessages(previousMessages[name], counterpart)
+	}
+	for _, name := range sortedNames(currentMessages) {
+		if _, isPresent := previousMessages[name]; !isPresent {
+			c.report.add(Full, Source, Info, string(name), "message added to the current schema")
+		}
+	}
+	for _, name := range sortedNames(previousEnums) {
+		counterpart, isPresent := currentEnums[name]
+		if !isPresent {
+			c.report.add(Full, Source, Warning, string(name), "enum removed from the current schema")
+			continue
+		}
+		c.compareEnums(previousEnums[name], counterpart)
+	}
+
+	return c.report, nil
+}
+
+// CompareMessages verifies the compatibility between two versions of
+// a message descriptor, including the types reachable from its fields,
+// and returns the report of the changes detected.
+func CompareMessages(previous protoreflect.MessageDescriptor, current protoreflect.MessageDescriptor, mode Mode) *Report {
+
+	c := newComparator(mode)
+	c.compareMessages(previous, current)
+	return c.report
+}
+
+// comparator holds the state of a comparison, which is the report
+// being populated and the pairs of types already compared, which is
+// required to deal with recursive type definitions.
+type comparator struct {
+	report  *Report
+	visited map[string]bool
+}
+
+// newComparator creates a comparator for the given mode.
+func newComparator(mode Mode) *comparator {
+
+	return &comparator{
+		report:  &Report{Mode: mode, Changes: []Change{}},
+		visited: map[string]bool{},
+	}
+}
+
+// markVisited records the comparison between the two given descriptors
+// and returns `true` if the pair had already been compared.
+func (c *comparator) markVisited(previous protoreflect.Descriptor, current protoreflect.Descriptor) bool {
+
+	key := fmt.Sprintf("%s|%s", previous.FullName(), current.FullName())
+	if c.visited[key] {
+		return true
+	}
+	c.visited[key] = true
+	return false
+}
+
+// removedMessage reports the removal of the message with the given name,
+// which is the same whether the message is the root of the comparison or
+// not: consumers look up the type of the payload by name in the schema
+// (i.e. the fragment of the schema URI), hence they can no longer decode
+// the messages of a type that was removed, wherever it was declared.
+func (c *comparator) removedMessage(name protoreflect.FullName) {
+
+	c.report.add(Full, Source, Error, string(name), "message removed from the current schema, its name can no longer be resolved")
+}
+
+// compareMessages compares the fields of two versions of a message.
+func (c *comparator) compareMessages(previous protoreflect.MessageDescriptor, current protoreflect.MessageDescriptor) {
+
+	if c.markVisited(previous, current) {
+		return
+	}
+
+	previousFields := previous.Fields()
+	currentFields := current.Fields()
+
+	for i := 0; i < previousFields.Len(); i++ {
+
+		field := previousFields.Get(i)
+		counterpart := currentFields.ByNumber(field.Number())
+		element := string(field.FullName())
+
+		if counterpart == nil {
+			if current.ReservedRanges().Has(field.Number()) {
+				c.report.add(Full, Source, Info, element, "field %d removed, number is reserved", field.Number())
+			} else {
+				c.report.add(Full, Wire, Error, element, "field %d removed without reserving its number", field.Number())
+			}
+			if field.Cardinality() == protoreflect.Required {
+				c.report.add(Forward, Wire, Error, element, "required field %d removed", field.Number())
+			}
+			continue
+		}
+		c.compareFields(field, counterpart)
+	}
+
+	for i := 0; i < currentFields.Len(); i++ {
+
+		field := currentFields.Get(i)
+		if previousFields.ByNumber(field.Number()) != nil {
+			continue
+		}
+		element := string(field.FullName())
+
+		switch {
+		case previous.ReservedRanges().Has(field.Number()):
+			c.report.add(Full, Wire, Error, element, "field added with number %d, which was reserved", field.Number())
+		case previous.ReservedNames().Has(field.Name()):
+			c.report.add(Full, JSON, Error, element, "field added with name '%s', which was reserved", field.Name())
+		default:
+			c.report.add(Full, Source, Info, element, "field %d added", field.Number())
+		}
+		if field.Cardinality() == protoreflect.Required {
+			c.report.add(Backward, Wire, Error, element, "required field %d added", field.Number())
+		}
+	}
+}
+
+// compareFields compares two versions of a field sharing the same
+// number, and recursively compares the message and enum types they
+// refer to.
+func (c *comparator) compareFields(previous protoreflect.FieldDescriptor, current protoreflect.FieldDescriptor) {
+
+	element := string(previous.FullName())
+
+	// names of the field: the parser renders the JSON output with the
+	// original field names, while other consumers rely on the JSON name.
+	if previous.Name() != current.Name() {
+		c.report.add(Full, JSON, Error, element, "field %d renamed from '%s' to '%s'", previous.Number(), previous.Name(), current.Name())
+	}
+	if previous.JSONName() != current.JSONName() {
+		c.report.add(Full, JSON, Error, element, "json_name changed from '%s' to '%s'", previous.JSONName(), current.JSONName())
+	}
+
+	// cardinality and shape of the field.
+	previousShape, currentShape := shapeOf(previous), shapeOf(current)
+	if previousShape != currentShape {
+		c.report.add(Full, Wire, Warning, element, "field changed from %s to %s", previousShape, currentShape)
+		c.report.add(Full, JSON, Error, element, "JSON value changed from %s to %s", previousShape, currentShape)
+	}
+	if previous.Cardinality() != protoreflect.Required && current.Cardinality() == protoreflect.Required {
+		c.report.add(Backward, Wire, Error, element, "field became required")
+	}
+	if previous.Cardinality() == protoreflect.Required && current.Cardinality() != protoreflect.Required {
+		c.report.add(Forward, Wire, Error, element, "field is no longer required")
+	}
+	if previous.HasPresence() != current.HasPresence() {
+		c.report.add(Full, JSON, Warning, element, "field presence changed, default values are rendered differently")
+	}
+	if previous.HasDefault() != current.HasDefault() || (previous.HasDefault() && fmt.Sprint(previous.Default().Interface()) != fmt.Sprint(current.Default().Interface())) {
+		c.report.add(Full, Source, Warning, element, "default value changed")
+	}
+
+	// membership to oneof declarations.
+	previousOneof, currentOneof := realOneof(previous), realOneof(current)
+	switch {
+	case previousOneof == nil && currentOneof != nil:
+		c.report.add(Full, Wire, Warning, element, "field moved into oneof '%s'", currentOneof.Name())
+	case previousOneof != nil && currentOneof == nil:
+		c.report.add(Full, Wire, Warning, element, "field moved out of oneof '%s'", previousOneof.Name())
+	case previousOneof != nil && previousOneof.Name() != currentOneof.Name():
+		c.report.add(Full, Source, Info, element, "field moved from oneof '%s' to '%s'", previousOneof.Name(), currentOneof.Name())
+	}
+
+	// type of the field.
+	c.compareKinds(element, previous, current)
+
+	switch {
+	case previous.Message() != nil && current.Message() != nil:
+		if previous.Message().FullName() != current.Message().FullName() && !previous.IsMap() {
+			c.report.add(Full, Source, Warning, element, "message type changed from '%s' to '%s'", previous.Message().FullName(), current.Message().FullName())
+		}
+		c.compareMessages(previous.Message(), current.Message())
+	case previous.Enum() != nil && current.Enum() != nil:
+		if previous.Enum().FullName() != current.Enum().FullName() {
+			c.report.add(Full, Source, Warning, element, "enum type changed from '%s' to '%s'", previous.Enum().FullName(), current.Enum().FullName())
+		}
+		c.compareEnums(previous.Enum(), current.Enum())
+	}
+}
+
+// compareKinds compares the kinds of two versions of a field and reports
+// the impact of a change on both the wire and the JSON representation.
+func (c *comparator) compareKinds(element string, previous protoreflect.FieldDescriptor, current protoreflect.FieldDescriptor) {
+
+	previousKind, currentKind := previous.Kind(), current.Kind()
+	if previousKind == currentKind {
+		return
+	}
+
+	previousWire, currentWire := wireTypeOf(previousKind), wireTypeOf(currentKind)
+	switch {
+	case previousWire != currentWire:
+		c.report.add(Full, Wire, Error, element, "type changed from %s to %s (wire type %s to %s)", previousKind, currentKind, previousWire, currentWire)
+	case isMessageKind(previousKind) || isMessageKind(currentKind):
+		c.report.add(Full, Wire, Error, element, "type changed from %s to %s, values are decoded as a different structure", previousKind, currentKind)
+	case previousKind == protoreflect.BytesKind && currentKind == protoreflect.StringKind:
+		c.report.add(Backward, Wire, Warning, element, "type changed from %s to %s, values that are not valid UTF-8 cannot be decoded", previousKind, currentKind)
+		c.report.add(Forward, Source, Info, element, "type changed from %s to %s, strings are read as their UTF-8 bytes", previousKind, currentKind)
+	case previousKind == protoreflect.StringKind && currentKind == protoreflect.BytesKind:
+		c.report.add(Forward, Wire, Warning, element, "type changed from %s to %s, values that are not valid UTF-8 cannot be decoded by previous consumers", previousKind, currentKind)
+		c.report.add(Backward, Source, Info, element, "type changed from %s to %s, strings are read as their UTF-8 bytes", previousKind, currentKind)
+	case encodingOf(previousKind) != encodingOf(currentKind):
+		c.report.add(Full, Wire, Error, element, "type changed from %s to %s, values are encoded differently", previousKind, currentKind)
+	default:
+		c.report.add(Full, Wire, Warning, element, "type changed from %s to %s, values may be truncated", previousKind, currentKind)
+	}
+
+	if previousJSON, currentJSON := jsonTypeOf(previousKind), jsonTypeOf(currentKind); previousJSON != currentJSON {
+		c.report.add(Full, JSON, Error, element, "JSON value changed from %s to %s", previousJSON, currentJSON)
+	}
+}
+
+// compareEnums compares the values of two versions of an enum.
+func (c *comparator) compareEnums(previous protoreflect.EnumDescriptor, current protoreflect.EnumDescriptor) {
+
+	if c.markVisited(previous, current) {
+		return
+	}
+
+	previousValues := previous.Values()
+	currentValues := current.Values()
+
+	for i := 0; i < previousValues.Len(); i++ {
+
+		value := previousValues.Get(i)
+		counterpart := currentValues.ByNumber(value.Number())
+		element := string(value.FullName())
+
+		if counterpart == nil {
+			c.report.add(Backward, JSON, Error, element, "value %d removed, it will be rendered as a number", value.Number())
+			if !current.ReservedRanges().Has(value.Number()) {
+				c.report.add(Full, Wire, Warning, element, "value %d removed without reserving its number", value.Number())
+			}
+			continue
+		}
+		if value.Name() != counterpart.Name() {
+			c.report.add(Full, JSON, Error, element, "value %d renamed from '%s' to '%s'", value.Number(), value.Name(), counterpart.Name())
+		}
+	}
+
+	for i := 0; i < currentValues.Len(); i++ {
+
+		value := currentValues.Get(i)
+		if previousValues.ByNumber(value.Number()) != nil {
+			continue
+		}
+		element := string(value.FullName())
+
+		if previous.ReservedRanges().Has(value.Number()) {
+			c.report.add(Full, Wire, Error, element, "value added with number %d, which was reserved", value.Number())
+			continue
+		}
+		c.report.add(Forward, JSON, Warning, element, "value %d added, previous consumers render it as a number", value.Number())
+		if current.ParentFile().Syntax() == protoreflect.Proto2 {
+			c.report.add(Forward, Wire, Warning, element, "value %d added to a closed enum, previous consumers treat it as unknown field", value.Number())
+		}
+	}
+}
+
+// findMessage looks up the message descriptor with the given name.
+func findMessage(files *protoregistry.Files, name protoreflect.FullName) (protoreflect.MessageDescriptor, error) {
+
+	descriptor, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+	md, isMessage := descriptor.(protoreflect.MessageDescriptor)
+	if !isMessage {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+// collectTypes indexes by name all the messages (except map entries)
+// and enumerations defined in the given registry, including nested
+// declarations.
+func collectTypes(files *protoregistry.Files) (map[protoreflect.FullName]protoreflect.MessageDescriptor, map[protoreflect.FullName]protoreflect.EnumDescriptor) {
+
+	messages := map[protoreflect.FullName]protoreflect.MessageDescriptor{}
+	enums := map[protoreflect.FullName]protoreflect.EnumDescriptor{}
+
+	var walk func(protoreflect.MessageDescriptors, protoreflect.EnumDescriptors)
+	walk = func(mds protoreflect.MessageDescriptors, eds protoreflect.EnumDescriptors) {
+		for i := 0; i < eds.Len(); i++ {
+			enums[eds.Get(i).FullName()] = eds.Get(i)
+		}
+		for i := 0; i < mds.Len(); i++ {
+			md := mds.Get(i)
+			if !md.IsMapEntry() {
+				messages[md.FullName()] = md
+			}
+			walk(md.Messages(), md.Enums())
+		}
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		walk(fd.Messages(), fd.Enums())
+		return true
+	})
+
+	return messages, enums
+}
+
+// sortedNames returns the names of the given descriptors in lexical
+// order, so that reports are stable across executions.
+func sortedNames(descriptors interface{}) []protoreflect.FullName {
+
+	names := []protoreflect.FullName{}
+	switch indexed := descriptors.(type) {
+	case map[protoreflect.FullName]protoreflect.MessageDescriptor:
+		for name := range indexed {
+			names = append(names, name)
+		}
+	case map[protoreflect.FullName]protoreflect.EnumDescriptor:
+		for name := range indexed {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// realOneof returns the oneof declaration containing the given field,
+// ignoring the synthetic ones generated for proto3 optional fields.
+func realOneof(field protoreflect.FieldDescriptor) protoreflect.OneofDescriptor {
+
+	oneof := field.ContainingOneof()
+	if oneof == nil || oneof.IsSynthetic() {
+		return nil
+	}
+	return oneof
+}
+
+// shapeOf describes the cardinality of the given field.
+func shapeOf(field protoreflect.FieldDescriptor) string {
+
+	switch {
+	case field.IsMap():
+		return "map"
+	case field.IsList():
+		return "repeated"
+	default:
+		return "singular"
+	}
+}
+
+// wireTypeOf returns the name of the wire type used to encode values
+// of the given kind.
+func wireTypeOf(kind protoreflect.Kind) string {
+
+	switch kind {
+	case protoreflect.BoolKind, protoreflect.EnumKind,
+		protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Uint32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Uint64Kind:
+		return "varint"
+	case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind, protoreflect.FloatKind:
+		return "i32"
+	case protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind, protoreflect.DoubleKind:
+		return "i64"
+	case protoreflect.GroupKind:
+		return "group"
+	default:
+		return "len"
+	}
+}
+
+// isMessageKind determines whether values of the given kind are messages,
+// whose content is decoded according to their own type.
+func isMessageKind(kind protoreflect.Kind) bool {
+	return kind == protoreflect.MessageKind || kind == protoreflect.GroupKind
+}
+
+// encodingOf groups kinds that share the same wire type and whose
+// values can be exchanged, possibly with truncation.
+func encodingOf(kind protoreflect.Kind) string {
+
+	switch kind {
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return "zigzag"
+	case protoreflect.FloatKind:
+		return "float"
+	case protoreflect.DoubleKind:
+		return "double"
+	default:
+		return wireTypeOf(kind)
+	}
+}
+
+// jsonTypeOf describes how values of the given kind are rendered in
+// the JSON representation of a message.
+func jsonTypeOf(kind protoreflect.Kind) string {
+
+	switch kind {
+	case protoreflect.BoolKind:
+		return "boolean"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Uint32Kind,
+		protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		return "number"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		return "numeric string"
+	case protoreflect.StringKind:
+		return "string"
+	case protoreflect.BytesKind:
+		return "base64 string"
+	case protoreflect.EnumKind:
+		return "enum name"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,222 @@
+package compat
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// schema describes the `compat.test.Sample` message of a test schema, which
+// also declares the `compat.test.Other` message used by message fields.
+type schema struct {
+	fields        []*descriptorpb.FieldDescriptorProto
+	reservedNums  []int32
+	reservedNames []string
+	withoutSample bool
+}
+
+// registry builds the registry of the test schema.
+func (s schema) registry(t *testing.T) *protoregistry.Files {
+
+	t.Helper()
+	sample := &descriptorpb.DescriptorProto{Name: proto.String("Sample"), Field: s.fields, ReservedName: s.reservedNames}
+	for _, number := range s.reservedNums {
+		sample.ReservedRange = append(sample.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(number), End: proto.Int32(number + 1)})
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("compat/test.proto"),
+		Package:     proto.String("compat.test"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Other")}},
+	}
+	if !s.withoutSample {
+		file.MessageType = append(file.MessageType, sample)
+	}
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return files
+}
+
+// field creates a singular field with the given name, number and type.
+func field(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+
+	fdp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     kind.Enum(),
+	}
+	if kind == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		fdp.TypeName = proto.String(".compat.test.Other")
+	}
+	return fdp
+}
+
+// compare compares the `Sample` message of the two schemas.
+func compare(t *testing.T, previous schema, current schema, mode Mode) *Report {
+
+	t.Helper()
+	report, err := Compare(previous.registry(t), current.registry(t), "compat.test.Sample", mode)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return report
+}
+
+// expectChange fails the test if the report does not contain a change with
+// the given category and severity, whose message contains the given text.
+func expectChange(t *testing.T, report *Report, category Category, severity Severity, text string) {
+
+	t.Helper()
+	for _, change := range report.Changes {
+		if change.Category == category && change.Severity == severity && strings.Contains(change.Message, text) {
+			return
+		}
+	}
+	t.Errorf("missing %s %s change '%s' in report:\n%s", severity, category, text, report)
+}
+
+const (
+	typeInt32   = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	typeInt64   = descriptorpb.FieldDescriptorProto_TYPE_INT64
+	typeSint32  = descriptorpb.FieldDescriptorProto_TYPE_SINT32
+	typeString  = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	typeBytes   = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+	typeMessage = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+)
+
+func TestCompareIdentical(t *testing.T) {
+
+	s := schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString), field("other", 2, typeMessage)}}
+	report := compare(t, s, s, Full)
+	if len(report.Changes) != 0 {
+		t.Errorf("expected no changes, got:\n%s", report)
+	}
+}
+
+func TestCompareFieldRemoval(t *testing.T) {
+
+	previous := schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString), field("age", 2, typeInt32)}}
+
+	report := compare(t, previous, schema{fields: previous.fields[:1]}, Full)
+	expectChange(t, report, Wire, Error, "field 2 removed without reserving its number")
+
+	report = compare(t, previous, schema{fields: previous.fields[:1], reservedNums: []int32{2}}, Full)
+	expectChange(t, report, Source, Info, "field 2 removed, number is reserved")
+	if report.HasErrors() {
+		t.Errorf("expected no errors when the number is reserved, got:\n%s", report)
+	}
+}
+
+func TestCompareRenumbering(t *testing.T) {
+
+	previous := schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString)}}
+	current := schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 3, typeString)}}
+
+	report := compare(t, previous, current, Full)
+	expectChange(t, report, Wire, Error, "field 1 removed without reserving its number")
+	expectChange(t, report, Source, Info, "field 3 added")
+}
+
+func TestCompareKinds(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		previous descriptorpb.FieldDescriptorProto_Type
+		current  descriptorpb.FieldDescriptorProto_Type
+		mode     Mode
+		category Category
+		severity Severity
+		text     string
+	}{
+		{"widening", typeInt32, typeInt64, Full, Wire, Warning, "values may be truncated"},
+		{"widening json", typeInt32, typeInt64, Full, JSON, Error, "JSON value changed from number to numeric string"},
+		{"zigzag", typeInt32, typeSint32, Full, Wire, Error, "values are encoded differently"},
+		{"wire type", typeInt32, typeString, Full, Wire, Error, "wire type varint to len"},
+		{"string to bytes", typeString, typeBytes, Full, Wire, Warning, "cannot be decoded by previous consumers"},
+		{"string to bytes backward", typeString, typeBytes, Backward, Source, Info, "strings are read as their UTF-8 bytes"},
+		{"bytes to string", typeBytes, typeString, Full, Wire, Warning, "values that are not valid UTF-8 cannot be decoded"},
+		{"bytes to string json", typeBytes, typeString, Full, JSON, Error, "JSON value changed from base64 string to string"},
+		{"string to message", typeString, typeMessage, Full, Wire, Error, "decoded as a different structure"},
+		{"message to bytes", typeMessage, typeBytes, Full, Wire, Error, "decoded as a different structure"},
+		{"bytes to message backward", typeBytes, typeMessage, Backward, Wire, Error, "decoded as a different structure"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := schema{fields: []*descriptorpb.FieldDescriptorProto{field("value", 1, test.previous)}}
+			current := schema{fields: []*descriptorpb.FieldDescriptorProto{field("value", 1, test.current)}}
+			expectChange(t, compare(t, previous, current, test.mode), test.category, test.severity, test.text)
+		})
+	}
+}
+
+func TestCompareStringToBytesDirections(t *testing.T) {
+
+	previous := schema{fields: []*descriptorpb.FieldDescriptorProto{field("value", 1, typeString)}}
+	current := schema{fields: []*descriptorpb.FieldDescriptorProto{field("value", 1, typeBytes)}}
+
+	// current consumers read strings as bytes, only the JSON output changes.
+	report := compare(t, previous, current, Backward)
+	for _, change := range report.Changes {
+		if change.Category == Wire && change.Severity != Info {
+			t.Errorf("unexpected wire change in backward mode: %s", change)
+		}
+	}
+}
+
+func TestCompareReservedReuse(t *testing.T) {
+
+	previous := schema{
+		fields:        []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString)},
+		reservedNums:  []int32{2},
+		reservedNames: []string{"age"},
+	}
+
+	report := compare(t, previous, schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString), field("years", 2, typeInt32)}}, Full)
+	expectChange(t, report, Wire, Error, "field added with number 2, which was reserved")
+
+	report = compare(t, previous, schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString), field("age", 3, typeInt32)}}, Full)
+	expectChange(t, report, JSON, Error, "field added with name 'age', which was reserved")
+}
+
+func TestCompareRenaming(t *testing.T) {
+
+	previous := schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString)}}
+	current := schema{fields: []*descriptorpb.FieldDescriptorProto{field("label", 1, typeString)}}
+
+	report := compare(t, previous, current, Full)
+	expectChange(t, report, JSON, Error, "field 1 renamed from 'name' to 'label'")
+	expectChange(t, report, JSON, Error, "json_name changed from 'name' to 'label'")
+}
+
+func TestCompareRemovedMessage(t *testing.T) {
+
+	previous := schema{fields: []*descriptorpb.FieldDescriptorProto{field("name", 1, typeString)}}
+	current := schema{withoutSample: true}
+
+	rooted, err := Compare(previous.registry(t), current.registry(t), "compat.test.Sample", Full)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all, err := Compare(previous.registry(t), current.registry(t), "", Full)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the removal is reported the same way whether the message is the root
+	// of the comparison or not.
+	if len(rooted.Changes) != 1 || len(all.Changes) != 1 || rooted.Changes[0] != all.Changes[0] {
+		t.Fatalf("expected the same single change, got:\n%s\nand:\n%s", rooted, all)
+	}
+	if change := rooted.Changes[0]; change.Severity != Error || change.Element != "compat.test.Sample" {
+		t.Errorf("unexpected change: %s", change)
+	}
+}
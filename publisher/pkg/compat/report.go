@@ -0,0 +1,192 @@
+package compat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mode identifies the direction of compatibility that is verified
+// when comparing two versions of a schema.
+type Mode int
+
+const (
+	// Backward verifies that consumers built with the current schema
+	// can read data produced with the previous schema.
+	Backward Mode = iota
+	// Forward verifies that consumers built with the previous schema
+	// can read data produced with the current schema.
+	Forward
+	// Full verifies both backward and forward compatibility.
+	Full
+)
+
+// ParseMode converts the given string into the corresponding Mode.
+func ParseMode(value string) (Mode, error) {
+
+	switch strings.ToLower(value) {
+	case "backward":
+		return Backward, nil
+	case "forward":
+		return Forward, nil
+	case "full":
+		return Full, nil
+	}
+	return Full, fmt.Errorf("unknown compatibility mode: '%s' (expected backward, forward or full)", value)
+}
+
+// String returns the lowercase name of the mode.
+func (m Mode) String() string {
+
+	switch m {
+	case Backward:
+		return "backward"
+	case Forward:
+		return "forward"
+	default:
+		return "full"
+	}
+}
+
+// MarshalText renders the mode as its name in JSON documents.
+func (m Mode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// includes determines whether the mode verifies compatibility in
+// the given direction.
+func (m Mode) includes(direction Mode) bool {
+	return m == Full || direction == Full || m == direction
+}
+
+// Severity qualifies the impact of a change on existing consumers.
+type Severity int
+
+const (
+	// Info marks changes that do not affect existing consumers.
+	Info Severity = iota
+	// Warning marks changes that may alter the decoded content
+	// without preventing consumers from reading the data.
+	Warning
+	// Error marks changes that break existing consumers.
+	Error
+)
+
+// String returns the lowercase name of the severity.
+func (s Severity) String() string {
+
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// MarshalText renders the severity as its name in JSON documents.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Category groups changes according to the representation of the
+// data that they affect.
+type Category int
+
+const (
+	// Wire identifies changes affecting the protobuf binary encoding.
+	Wire Category = iota
+	// JSON identifies changes affecting the JSON rendering of the
+	// message (i.e. the output of the `parse` command).
+	JSON
+	// Source identifies changes that only affect the schema definition
+	// and the code generated from it.
+	Source
+)
+
+// String returns the lowercase name of the category.
+func (c Category) String() string {
+
+	switch c {
+	case Wire:
+		return "wire"
+	case JSON:
+		return "json"
+	default:
+		return "source"
+	}
+}
+
+// MarshalText renders the category as its name in JSON documents.
+func (c Category) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Change describes a single difference between the previous and the
+// current version of an element of the schema.
+type Change struct {
+	Category Category `json:"category"`
+	Severity Severity `json:"severity"`
+	Element  string   `json:"element"`
+	Message  string   `json:"message"`
+}
+
+// String renders the change as a single line of text.
+func (c Change) String() string {
+	return fmt.Sprintf("%-7s %-6s %s: %s", strings.ToUpper(c.Severity.String()), c.Category, c.Element, c.Message)
+}
+
+// Report collects the changes detected while comparing two versions
+// of a schema according to a given compatibility mode.
+type Report struct {
+	Mode    Mode     `json:"mode"`
+	Changes []Change `json:"changes"`
+}
+
+// Count returns the number of changes with the given severity.
+func (r *Report) Count(severity Severity) int {
+
+	count := 0
+	for _, change := range r.Changes {
+		if change.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// HasErrors determines whether the report contains breaking changes.
+func (r *Report) HasErrors() bool {
+	return r.Count(Error) > 0
+}
+
+// String renders the report as human readable text, one change per
+// line followed by a summary.
+func (r *Report) String() string {
+
+	builder := strings.Builder{}
+	for _, change := range r.Changes {
+		builder.WriteString(change.String())
+		builder.WriteString("\n")
+	}
+	builder.WriteString(fmt.Sprintf("%s compatibility: %d error(s), %d warning(s), %d info(s)",
+		r.Mode, r.Count(Error), r.Count(Warning), r.Count(Info)))
+	return builder.String()
+}
+
+// add appends a change to the report. If the change only affects a
+// direction that is not verified by the report mode, its severity is
+// lowered to Info so that it is still reported without failing the
+// check.
+func (r *Report) add(direction Mode, category Category, severity Severity, element string, format string, args ...interface{}) {
+
+	if !r.Mode.includes(direction) {
+		severity = Info
+	}
+	r.Changes = append(r.Changes, Change{
+		Category: category,
+		Severity: severity,
+		Element:  element,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,122 @@
+package confluent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MagicByte is the first byte of the messages framed according to the
+// Confluent wire format.
+const MagicByte = 0x00
+
+// Frame is the content of a message framed according to the Confluent
+// wire format used by the Kafka serialisers backed by a Schema Registry:
+// a magic byte, the 4-byte (big endian) identifier of the schema in the
+// registry, the indexes of the message type within the schema, and the
+// protobuf binary of the message.
+type Frame struct {
+	// SchemaID is the identifier of the schema in the registry.
+	SchemaID uint32
+	// Indexes is the path of the message type within the schema: the
+	// first index identifies a top-level message of the file, and the
+	// following ones the nested messages.
+	Indexes []int
+	// Payload is the protobuf binary of the message.
+	Payload []byte
+}
+
+// IsFramed determines whether the given data starts with the header of
+// the Confluent wire format (magic byte and schema identifier).
+func IsFramed(data []byte) bool {
+
+	return len(data) > 5 && data[0] == MagicByte
+}
+
+// Decode strips the Confluent framing from the given data and returns its
+// content. The message indexes are encoded as a list of zig-zag varints
+// prefixed by their count, with the single byte `0` as shorthand for the
+// first top-level message (indexes `[0]`).
+func Decode(data []byte) (Frame, error) {
+
+	frame := Frame{}
+	if !IsFramed(data) {
+		return frame, errors.New("data is not framed according to the Confluent wire format")
+	}
+	frame.SchemaID = binary.BigEndian.Uint32(data[1:5])
+
+	data = data[5:]
+	count, n := protowire.ConsumeVarint(data)
+	if n < 0 {
+		return frame, fmt.Errorf("invalid message indexes: %v", protowire.ParseError(n))
+	}
+	data = data[n:]
+
+	size := protowire.DecodeZigZag(count)
+	if size == 0 {
+		frame.Indexes = []int{0}
+	}
+	for i := int64(0); i < size; i++ {
+		index, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return frame, fmt.Errorf("invalid message indexes: %v", protowire.ParseError(n))
+		}
+		data = data[n:]
+		frame.Indexes = append(frame.Indexes, int(protowire.DecodeZigZag(index)))
+	}
+
+	frame.Payload = data
+	return frame, nil
+}
+
+// Encode frames the given protobuf binary according to the Confluent wire
+// format, with the given schema identifier and message indexes.
+func Encode(schemaID uint32, indexes []int, payload []byte) []byte {
+
+	buffer := []byte{MagicByte, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(buffer[1:], schemaID)
+
+	if len(indexes) == 0 || (len(indexes) == 1 && indexes[0] == 0) {
+		buffer = append(buffer, 0)
+	} else {
+		buffer = protowire.AppendVarint(buffer, protowire.EncodeZigZag(int64(len(indexes))))
+		for _, index := range indexes {
+			buffer = protowire.AppendVarint(buffer, protowire.EncodeZigZag(int64(index)))
+		}
+	}
+	return append(buffer, payload...)
+}
+
+// Indexes computes the message indexes of the given message, which is the
+// path from the file defining it to the message.
+func Indexes(md protoreflect.MessageDescriptor) []int {
+
+	indexes := []int{md.Index()}
+	for parent, isNested := md.Parent().(protoreflect.MessageDescriptor); isNested; parent, isNested = parent.Parent().(protoreflect.MessageDescriptor) {
+		indexes = append([]int{parent.Index()}, indexes...)
+	}
+	return indexes
+}
+
+// MessageByIndexes returns the message identified by the given indexes
+// in the file.
+func MessageByIndexes(fd protoreflect.FileDescriptor, indexes []int) (protoreflect.MessageDescriptor, error) {
+
+	if len(indexes) == 0 {
+		return nil, errors.New("no message indexes")
+	}
+
+	messages := fd.Messages()
+	var md protoreflect.MessageDescriptor
+	for _, index := range indexes {
+		if index < 0 || index >= messages.Len() {
+			return nil, fmt.Errorf("message indexes %v do not identify a message in %s", indexes, fd.Path())
+		}
+		md = messages.Get(index)
+		messages = md.Messages()
+	}
+	return md, nil
+}
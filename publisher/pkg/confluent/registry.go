@@ -0,0 +1,220 @@
+package confluent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"publisher/pkg/logging"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Reference is a reference of a schema to another schema registered under
+// a subject, which is imported with the given name.
+type Reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// Schema is a schema stored in the registry, as returned by the Schema
+// Registry HTTP API.
+type Schema struct {
+	Schema     string      `json:"schema"`
+	SchemaType string      `json:"schemaType,omitempty"`
+	References []Reference `json:"references,omitempty"`
+}
+
+// Registry is a client of the Schema Registry HTTP API, which resolves the
+// schema identifiers into file descriptors. Compiled schemas are cached,
+// hence each schema is retrieved and compiled only once.
+type Registry struct {
+	baseURL string
+	// Client is the HTTP client used to send the requests.
+	Client *http.Client
+
+	lock  sync.Mutex
+	files map[uint32]protoreflect.FileDescriptor
+}
+
+// NewRegistry creates a client of the Schema Registry exposed at the given
+// base URL (e.g. `http://localhost:8081`).
+func NewRegistry(baseURL string) *Registry {
+
+	return &Registry{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		files:   map[uint32]protoreflect.FileDescriptor{},
+	}
+}
+
+// SchemaByID retrieves the schema with the given identifier.
+func (r *Registry) SchemaByID(id uint32) (*Schema, error) {
+
+	schema := &Schema{}
+	err := r.get(fmt.Sprintf("/schemas/ids/%d", id), schema)
+	return schema, err
+}
+
+// SchemaByVersion retrieves the given version of the schema registered
+// under the subject.
+func (r *Registry) SchemaByVersion(subject string, version int) (*Schema, error) {
+
+	schema := &Schema{}
+	err := r.get(fmt.Sprintf("/subjects/%s/versions/%d", url.PathEscape(subject), version), schema)
+	return schema, err
+}
+
+// File resolves the schema with the given identifier into the descriptor
+// of the file it defines. The schema and the schemas it references are
+// compiled together, with the well known types available for import.
+func (r *Registry) File(id uint32) (protoreflect.FileDescriptor, error) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if fd, isPresent := r.files[id]; isPresent {
+		return fd, nil
+	}
+
+	schema, err := r.SchemaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.SchemaType) > 0 && schema.SchemaType != "PROTOBUF" {
+		return nil, fmt.Errorf("schema %d is not a protobuf schema (type: %s)", id, schema.SchemaType)
+	}
+
+	// the schema is stored under a name that cannot clash with the
+	// names used to import the references.
+	name := fmt.Sprintf("schema-registry/%d.proto", id)
+	sources := map[string]string{name: schema.Schema}
+	err = r.collect(schema.References, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := Compile(name, sources)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile schema %d: %v", id, err)
+	}
+	logging.SugarLog.Infof("Compiled schema from registry (id: %d, files: %d)", id, len(sources))
+
+	r.files[id] = fd
+	return fd, nil
+}
+
+// Resolve strips the Confluent framing from the given data and resolves
+// the descriptor of the message it carries, through the schema identifier
+// and the message indexes. The method returns the descriptor and the
+// protobuf binary of the message.
+func (r *Registry) Resolve(data []byte) (protoreflect.MessageDescriptor, []byte, error) {
+
+	frame, err := Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fd, err := r.File(frame.SchemaID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	md, err := MessageByIndexes(fd, frame.Indexes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return md, frame.Payload, nil
+}
+
+// collect retrieves the sources of the given references, and of the
+// references they contain, indexed by their import name.
+func (r *Registry) collect(references []Reference, sources map[string]string) error {
+
+	for _, reference := range references {
+
+		if _, isPresent := sources[reference.Name]; isPresent {
+			continue
+		}
+		schema, err := r.SchemaByVersion(reference.Subject, reference.Version)
+		if err != nil {
+			return fmt.Errorf("could not resolve reference %s (subject: %s, version: %d): %v", reference.Name, reference.Subject, reference.Version, err)
+		}
+		sources[reference.Name] = schema.Schema
+
+		err = r.collect(schema.References, sources)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get sends a GET request to the given path of the registry and decodes
+// the JSON response into `value`.
+func (r *Registry) get(path string, value interface{}) error {
+
+	request, err := http.NewRequest(http.MethodGet, r.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+
+	response, err := r.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("schema registry replied to %s with status: %s (%s)", path, response.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Compile compiles the `.proto` source with the given name, which can
+// import the other sources (indexed by name) and the well known types,
+// and returns the descriptor of the file.
+func Compile(name string, sources map[string]string) (protoreflect.FileDescriptor, error) {
+
+	parser := protoparse.Parser{Accessor: protoparse.FileContentsFromMap(sources)}
+	parsed, err := parser.ParseFiles(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var walk func(*desc.FileDescriptor)
+	walk = func(fd *desc.FileDescriptor) {
+		if seen[fd.GetName()] {
+			return
+		}
+		seen[fd.GetName()] = true
+		for _, dependency := range fd.GetDependencies() {
+			walk(dependency)
+		}
+		fds.File = append(fds.File, fd.AsFileDescriptorProto())
+	}
+	walk(parsed[0])
+
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, err
+	}
+	return files.FindFileByPath(name)
+}
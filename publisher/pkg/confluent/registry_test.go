@@ -0,0 +1,202 @@
+package confluent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// rootSchema is a schema whose sixth message has a nested message, which is
+// identified by the indexes `[5 0]`, and which references a common schema.
+const rootSchema = `syntax = "proto3";
+package test.registry;
+import "common.proto";
+import "google/protobuf/timestamp.proto";
+message First { string name = 1; }
+message Second { Common common = 1; }
+message Third { google.protobuf.Timestamp time = 1; }
+message Fourth {}
+message Fifth {}
+message Outer {
+  message Inner { string name = 1; int32 age = 2; }
+  repeated Inner users = 1;
+}
+`
+
+// commonSchema is the schema referenced by rootSchema, which in turn
+// references the schema of the values.
+const commonSchema = `syntax = "proto3";
+package test.registry;
+import "values.proto";
+message Common { Value value = 1; }
+`
+
+// valuesSchema is the schema referenced by commonSchema.
+const valuesSchema = `syntax = "proto3";
+package test.registry;
+enum Value { VALUE_NULL = 0; VALUE_1 = 1; }
+`
+
+// standInRegistry is a stand-in Schema Registry serving a fixed set of
+// schemas by identifier and by subject, and recording the paths requested.
+type standInRegistry struct {
+	lock     sync.Mutex
+	requests []string
+}
+
+// newStandInRegistry starts a stand-in Schema Registry.
+func newStandInRegistry(t *testing.T) (*standInRegistry, *httptest.Server) {
+
+	byPath := map[string]Schema{
+		"/schemas/ids/1":              {Schema: rootSchema, References: []Reference{{Name: "common.proto", Subject: "common", Version: 3}}},
+		"/schemas/ids/2":              {Schema: `syntax = "proto3"; package test.registry; message Only { string name = 1; }`, SchemaType: "PROTOBUF"},
+		"/schemas/ids/3":              {Schema: `{"type": "record", "name": "Only", "fields": []}`, SchemaType: "AVRO"},
+		"/subjects/common/versions/3": {Schema: commonSchema, References: []Reference{{Name: "values.proto", Subject: "values", Version: 1}}},
+		"/subjects/values/versions/1": {Schema: valuesSchema},
+	}
+
+	r := &standInRegistry{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		r.lock.Lock()
+		r.requests = append(r.requests, request.URL.Path)
+		r.lock.Unlock()
+
+		schema, isPresent := byPath[request.URL.Path]
+		if !isPresent {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code": 40403, "message": "Schema not found"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		json.NewEncoder(w).Encode(schema)
+	}))
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+// namePayload is the protobuf binary of a message whose first field is the
+// string `alice`.
+func namePayload() []byte {
+
+	payload := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendString(payload, "alice")
+}
+
+func TestRegistryResolveNestedMessage(t *testing.T) {
+
+	r, server := newStandInRegistry(t)
+	registry := NewRegistry(server.URL + "/")
+
+	data := Encode(1, []int{5, 0}, namePayload())
+	md, payload, err := registry.Resolve(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if md.FullName() != "test.registry.Outer.Inner" {
+		t.Fatalf("unexpected message: %s", md.FullName())
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if name := msg.Get(md.Fields().ByName("name")).String(); name != "alice" {
+		t.Errorf("unexpected name: %s", name)
+	}
+
+	// the references (and their references) were retrieved by subject.
+	expected := []string{"/schemas/ids/1", "/subjects/common/versions/3", "/subjects/values/versions/1"}
+	if strings.Join(r.requests, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected requests: %v", r.requests)
+	}
+	common := md.ParentFile().Messages().ByName("Second").Fields().ByName("common")
+	if common.Message() == nil || common.Message().Fields().ByName("value").Enum().FullName() != "test.registry.Value" {
+		t.Errorf("the references were not compiled with the schema")
+	}
+
+	// the compiled schema is cached.
+	if _, _, err := registry.Resolve(Encode(1, []int{2}, nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.requests) != len(expected) {
+		t.Errorf("the schema was retrieved again: %v", r.requests)
+	}
+}
+
+func TestRegistryZeroIndexShortcut(t *testing.T) {
+
+	_, server := newStandInRegistry(t)
+	registry := NewRegistry(server.URL)
+
+	// the first message is encoded with the single byte 0.
+	data := Encode(2, []int{0}, namePayload())
+	if data[5] != 0 || len(data) != 6+len(namePayload()) {
+		t.Fatalf("the shortcut was not used: %x", data)
+	}
+	md, payload, err := registry.Resolve(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if md.FullName() != "test.registry.Only" || string(payload) != string(namePayload()) {
+		t.Errorf("unexpected resolution: %s (%x)", md.FullName(), payload)
+	}
+
+	// the explicit form of the same indexes is accepted as well.
+	explicit := append([]byte{MagicByte, 0, 0, 0, 2}, protowire.AppendVarint(protowire.AppendVarint(nil, protowire.EncodeZigZag(1)), 0)...)
+	frame, err := Decode(append(explicit, namePayload()...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(frame.Indexes) != 1 || frame.Indexes[0] != 0 || frame.SchemaID != 2 {
+		t.Errorf("unexpected frame: %+v", frame)
+	}
+}
+
+func TestRegistryBadMagicByte(t *testing.T) {
+
+	r, server := newStandInRegistry(t)
+	registry := NewRegistry(server.URL)
+
+	data := Encode(1, []int{5, 0}, namePayload())
+	data[0] = 0x01
+	if _, _, err := registry.Resolve(data); err == nil || !strings.Contains(err.Error(), "not framed") {
+		t.Fatalf("expected the framing to be rejected, got: %v", err)
+	}
+	if _, _, err := registry.Resolve([]byte{MagicByte, 0, 0}); err == nil {
+		t.Fatalf("expected a truncated header to be rejected")
+	}
+	if len(r.requests) > 0 {
+		t.Errorf("the registry was queried for an unframed message: %v", r.requests)
+	}
+}
+
+func TestRegistryUnknownSchema(t *testing.T) {
+
+	_, server := newStandInRegistry(t)
+	registry := NewRegistry(server.URL)
+
+	_, _, err := registry.Resolve(Encode(42, nil, namePayload()))
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "/schemas/ids/42") {
+		t.Fatalf("expected the status to be reported, got: %v", err)
+	}
+}
+
+func TestRegistryInvalidIndexesAndTypes(t *testing.T) {
+
+	_, server := newStandInRegistry(t)
+	registry := NewRegistry(server.URL)
+
+	if _, _, err := registry.Resolve(Encode(1, []int{5, 1}, nil)); err == nil || !strings.Contains(err.Error(), "do not identify a message") {
+		t.Errorf("expected the indexes to be rejected, got: %v", err)
+	}
+	if _, _, err := registry.Resolve(Encode(3, nil, nil)); err == nil || !strings.Contains(err.Error(), "not a protobuf schema") {
+		t.Errorf("expected the schema type to be rejected, got: %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package describe
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// File summarises the content of a file descriptor: the package, the
+// files it depends upon and the names of the top-level and nested
+// declarations it contains.
+type File struct {
+	Path         string    `json:"path"`
+	Package      string    `json:"package"`
+	Syntax       string    `json:"syntax"`
+	Dependencies []string  `json:"dependencies"`
+	Messages     []string  `json:"messages"`
+	Enums        []string  `json:"enums"`
+	Services     []Service `json:"services"`
+	Extensions   []string  `json:"extensions"`
+}
+
+// Service describes a service declaration and its methods.
+type Service struct {
+	Name    string   `json:"name"`
+	Methods []Method `json:"methods"`
+}
+
+// Method describes a method of a service.
+type Method struct {
+	Name            string `json:"name"`
+	Input           string `json:"input"`
+	Output          string `json:"output"`
+	ClientStreaming bool   `json:"client_streaming,omitempty"`
+	ServerStreaming bool   `json:"server_streaming,omitempty"`
+}
+
+// Message describes a message declaration and its fields.
+type Message struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Fields  []Field  `json:"fields"`
+	Oneofs  []string `json:"oneofs,omitempty"`
+	Options string   `json:"options,omitempty"`
+}
+
+// Field describes a field of a message.
+type Field struct {
+	Number   int32  `json:"number"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Label    string `json:"label"`
+	Oneof    string `json:"oneof,omitempty"`
+	JSONName string `json:"json_name"`
+	Default  string `json:"default,omitempty"`
+	Options  string `json:"options,omitempty"`
+}
+
+// Enum describes an enum declaration and its values.
+type Enum struct {
+	Name    string      `json:"name"`
+	File    string      `json:"file"`
+	Values  []EnumValue `json:"values"`
+	Options string      `json:"options,omitempty"`
+}
+
+// EnumValue describes a value of an enum.
+type EnumValue struct {
+	Name    string `json:"name"`
+	Number  int32  `json:"number"`
+	Options string `json:"options,omitempty"`
+}
+
+// Files summarises all the files contained in the given registry, in
+// lexical order of their path.
+func Files(files *protoregistry.Files) []File {
+
+	summaries := []File{}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		summaries = append(summaries, newFile(fd))
+		return true
+	})
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Path < summaries[j].Path })
+	return summaries
+}
+
+// Type describes the declaration with the given name, which is either a
+// message, an enum or a service. The method returns a *Message, *Enum
+// or *Service depending on the type of the declaration.
+func Type(files *protoregistry.Files, name protoreflect.FullName) (interface{}, error) {
+
+	descriptor, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d := descriptor.(type) {
+	case protoreflect.MessageDescriptor:
+		return newMessage(d), nil
+	case protoreflect.EnumDescriptor:
+		return newEnum(d), nil
+	case protoreflect.ServiceDescriptor:
+		service := newService(d)
+		return &service, nil
+	}
+	return nil, fmt.Errorf("%s is not a message, enum or service", name)
+}
+
+// newFile summarises the given file descriptor.
+func newFile(fd protoreflect.FileDescriptor) File {
+
+	file := File{
+		Path:         fd.Path(),
+		Package:      string(fd.Package()),
+		Syntax:       fd.Syntax().String(),
+		Dependencies: []string{},
+		Messages:     []string{},
+		Enums:        []string{},
+		Services:     []Service{},
+		Extensions:   []string{},
+	}
+
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		file.Dependencies = append(file.Dependencies, imports.Get(i).Path())
+	}
+
+	var walk func(protoreflect.MessageDescriptors, protoreflect.EnumDescriptors, protoreflect.ExtensionDescriptors)
+	walk = func(mds protoreflect.MessageDescriptors, eds protoreflect.EnumDescriptors, xds protoreflect.ExtensionDescriptors) {
+		for i := 0; i < eds.Len(); i++ {
+			file.Enums = append(file.Enums, string(eds.Get(i).FullName()))
+		}
+		for i := 0; i < xds.Len(); i++ {
+			xd := xds.Get(i)
+			file.Extensions = append(file.Extensions, fmt.Sprintf("%s (extends %s)", xd.FullName(), xd.ContainingMessage().FullName()))
+		}
+		for i := 0; i < mds.Len(); i++ {
+			md := mds.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			file.Messages = append(file.Messages, string(md.FullName()))
+			walk(md.Messages(), md.Enums(), md.Extensions())
+		}
+	}
+	walk(fd.Messages(), fd.Enums(), fd.Extensions())
+
+	services := fd.Services()
+	for i := 0; i < services.Len(); i++ {
+		file.Services = append(file.Services, newService(services.Get(i)))
+	}
+
+	return file
+}
+
+// newService describes the given service descriptor.
+func newService(sd protoreflect.ServiceDescriptor) Service {
+
+	service := Service{Name: string(sd.FullName()), Methods: []Method{}}
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		service.Methods = append(service.Methods, Method{
+			Name:            string(md.Name()),
+			Input:           string(md.Input().FullName()),
+			Output:          string(md.Output().FullName()),
+			ClientStreaming: md.IsStreamingClient(),
+			ServerStreaming: md.IsStreamingServer(),
+		})
+	}
+	return service
+}
+
+// newMessage describes the given message descriptor.
+func newMessage(md protoreflect.MessageDescriptor) *Message {
+
+	message := &Message{
+		Name:    string(md.FullName()),
+		File:    md.ParentFile().Path(),
+		Fields:  []Field{},
+		Options: optionsOf(md.Options()),
+	}
+
+	// the synthetic oneofs of proto3 optional fields are not declared.
+	oneofs := md.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		if !oneofs.Get(i).IsSynthetic() {
+			message.Oneofs = append(message.Oneofs, string(oneofs.Get(i).Name()))
+		}
+	}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		field := Field{
+			Number:   int32(fd.Number()),
+			Name:     string(fd.Name()),
+			Type:     typeOf(fd),
+			Label:    fd.Cardinality().String(),
+			JSONName: fd.JSONName(),
+			Options:  optionsOf(fd.Options()),
+		}
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			field.Oneof = string(oneof.Name())
+		}
+		if fd.HasDefault() {
+			field.Default = defaultOf(fd)
+		}
+		message.Fields = append(message.Fields, field)
+	}
+
+	return message
+}
+
+// newEnum describes the given enum descriptor.
+func newEnum(ed protoreflect.EnumDescriptor) *Enum {
+
+	enum := &Enum{
+		Name:    string(ed.FullName()),
+		File:    ed.ParentFile().Path(),
+		Values:  []EnumValue{},
+		Options: optionsOf(ed.Options()),
+	}
+
+	values := ed.Values()
+	for i := 0; i < values.Len(); i++ {
+		value := values.Get(i)
+		enum.Values = append(enum.Values, EnumValue{
+			Name:    string(value.Name()),
+			Number:  int32(value.Number()),
+			Options: optionsOf(value.Options()),
+		})
+	}
+	return enum
+}
+
+// typeOf renders the type of a field as it would appear in a .proto file.
+func typeOf(fd protoreflect.FieldDescriptor) string {
+
+	switch {
+	case fd.IsMap():
+		return fmt.Sprintf("map<%s, %s>", typeOf(fd.MapKey()), typeOf(fd.MapValue()))
+	case fd.Message() != nil:
+		return string(fd.Message().FullName())
+	case fd.Enum() != nil:
+		return string(fd.Enum().FullName())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+// defaultOf renders the default value of a field. Bytes are rendered as
+// in .proto files, with the non-printable bytes escaped.
+func defaultOf(fd protoreflect.FieldDescriptor) string {
+
+	switch {
+	case fd.Enum() != nil:
+		return string(fd.DefaultEnumValue().Name())
+	case fd.Kind() == protoreflect.BytesKind:
+		return protodesc.ToFieldDescriptorProto(fd).GetDefaultValue()
+	}
+	return fmt.Sprintf("%v", fd.Default().Interface())
+}
+
+// optionsOf renders the options of a declaration in text format, or
+// returns an empty string if no option is set.
+func optionsOf(options proto.Message) string {
+
+	if options == nil || !options.ProtoReflect().IsValid() {
+		return ""
+	}
+	data, err := prototext.MarshalOptions{}.Marshal(options)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(data)), " ")
+}
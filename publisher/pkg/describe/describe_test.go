@@ -0,0 +1,250 @@
+package describe
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// field creates a field with the given name, number, label and type.
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+
+	fdp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     kind.Enum(),
+	}
+	if len(typeName) > 0 {
+		fdp.TypeName = proto.String(typeName)
+	}
+	return fdp
+}
+
+// testRegistry builds a registry with a proto2 file declaring defaults and
+// extensions, and a proto3 file declaring optional fields, oneofs, maps and
+// a service, which depends on the first.
+func testRegistry(t *testing.T) *protoregistry.Files {
+
+	t.Helper()
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	data := field("data", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_BYTES, "")
+	data.DefaultValue = proto.String(`\001\377a\"b`)
+	name := field("name", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	name.DefaultValue = proto.String("hello")
+	kind := field("kind", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".describe.test.Kind")
+	kind.DefaultValue = proto.String("SECOND")
+	count := field("count", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, "")
+	count.DefaultValue = proto.String("7")
+	count.Options = &descriptorpb.FieldOptions{Deprecated: proto.Bool(true)}
+	extra := field("extra", 100, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, "")
+	extra.Extendee = proto.String(".describe.test.Legacy")
+
+	legacy := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("describe/legacy.proto"),
+		Package: proto.String("describe.test"),
+		Syntax:  proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:           proto.String("Legacy"),
+			Field:          []*descriptorpb.FieldDescriptorProto{data, name, kind, count},
+			ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{{Start: proto.Int32(100), End: proto.Int32(200)}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Kind"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("FIRST"), Number: proto.Int32(0)},
+				{Name: proto.String("SECOND"), Number: proto.Int32(1)},
+			},
+		}},
+		Extension: []*descriptorpb.FieldDescriptorProto{extra},
+	}
+
+	nickname := field("nickname", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	nickname.Proto3Optional, nickname.OneofIndex = proto.Bool(true), proto.Int32(1)
+	text := field("text", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	text.OneofIndex = proto.Int32(0)
+	raw := field("raw", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_BYTES, "")
+	raw.OneofIndex = proto.Int32(0)
+
+	modern := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("describe/modern.proto"),
+		Package:    proto.String("describe.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"describe/legacy.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Modern"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				nickname, text, raw,
+				field("counts", 4, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".describe.test.Modern.CountsEntry"),
+				field("legacy", 5, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".describe.test.Legacy"),
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}, {Name: proto.String("_nickname")}},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("CountsEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("value", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Api"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:            proto.String("Watch"),
+				InputType:       proto.String(".describe.test.Modern"),
+				OutputType:      proto.String(".describe.test.Legacy"),
+				ServerStreaming: proto.Bool(true),
+			}},
+		}},
+	}
+
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{modern, legacy}})
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return files
+}
+
+func TestFiles(t *testing.T) {
+
+	files := Files(testRegistry(t))
+	if len(files) != 2 || files[0].Path != "describe/legacy.proto" || files[1].Path != "describe/modern.proto" {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+
+	legacy, modern := files[0], files[1]
+	if legacy.Syntax != "proto2" || strings.Join(legacy.Enums, ",") != "describe.test.Kind" || strings.Join(legacy.Extensions, ",") != "describe.test.extra (extends describe.test.Legacy)" {
+		t.Errorf("unexpected file: %+v", legacy)
+	}
+	// map entries are not listed.
+	if strings.Join(modern.Messages, ",") != "describe.test.Modern" || strings.Join(modern.Dependencies, ",") != "describe/legacy.proto" {
+		t.Errorf("unexpected file: %+v", modern)
+	}
+
+	expected := strings.Join([]string{
+		"file describe/legacy.proto (package: describe.test, syntax: proto2)",
+		"  messages:",
+		"    describe.test.Legacy",
+		"  enums:",
+		"    describe.test.Kind",
+		"  extensions:",
+		"    describe.test.extra (extends describe.test.Legacy)",
+		"file describe/modern.proto (package: describe.test, syntax: proto3)",
+		"  messages:",
+		"    describe.test.Modern",
+		"  service describe.test.Api",
+		"    rpc Watch(describe.test.Modern) returns (stream describe.test.Legacy)",
+		"dependencies:",
+		"  describe/legacy.proto",
+		"  describe/modern.proto -> describe/legacy.proto",
+		"",
+	}, "\n")
+	if text := FilesText(files); text != expected {
+		t.Errorf("unexpected text:\n%s", text)
+	}
+}
+
+func TestTypeMessage(t *testing.T) {
+
+	described, err := Type(testRegistry(t), "describe.test.Modern")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := described.(*Message)
+
+	// the synthetic oneof of the optional field is not a declared oneof.
+	if strings.Join(message.Oneofs, ",") != "choice" {
+		t.Errorf("unexpected oneofs: %v", message.Oneofs)
+	}
+	expected := []Field{
+		{Number: 1, Name: "nickname", Type: "string", Label: "optional", JSONName: "nickname"},
+		{Number: 2, Name: "text", Type: "string", Label: "optional", Oneof: "choice", JSONName: "text"},
+		{Number: 3, Name: "raw", Type: "bytes", Label: "optional", Oneof: "choice", JSONName: "raw"},
+		{Number: 4, Name: "counts", Type: "map<string, int32>", Label: "repeated", JSONName: "counts"},
+		{Number: 5, Name: "legacy", Type: "describe.test.Legacy", Label: "optional", JSONName: "legacy"},
+	}
+	if len(message.Fields) != len(expected) {
+		t.Fatalf("unexpected fields: %+v", message.Fields)
+	}
+	for i, field := range message.Fields {
+		if field != expected[i] {
+			t.Errorf("unexpected field: %+v", field)
+		}
+	}
+}
+
+func TestTypeDefaults(t *testing.T) {
+
+	described, err := Type(testRegistry(t), "describe.test.Legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := described.(*Message)
+
+	defaults := []string{}
+	for _, field := range message.Fields {
+		defaults = append(defaults, field.Name+"="+field.Default)
+	}
+	// bytes are escaped as in .proto files.
+	if actual := strings.Join(defaults, " "); actual != `data=\001\377a\"b name=hello kind=SECOND count=7` {
+		t.Errorf("unexpected defaults: %s", actual)
+	}
+	if message.Fields[3].Options != "deprecated:true" {
+		t.Errorf("unexpected options: %q", message.Fields[3].Options)
+	}
+
+	text := message.String()
+	for _, line := range []string{
+		`    1 data                 optional   bytes json_name=data default=\001\377a\"b`,
+		`    4 count                optional   int32 json_name=count default=7 options=[deprecated:true]`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, text)
+		}
+	}
+
+	// the JSON document carries valid strings.
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"default":"\\001\\377a\\\"b"`) {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+}
+
+func TestTypeEnumAndService(t *testing.T) {
+
+	files := testRegistry(t)
+
+	enum, err := Type(files, "describe.test.Kind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := enum.(*Enum).String(); text != "enum describe.test.Kind (file: describe/legacy.proto)\n    0 FIRST\n    1 SECOND\n" {
+		t.Errorf("unexpected text:\n%s", text)
+	}
+
+	service, err := Type(files, "describe.test.Api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if methods := service.(*Service).Methods; len(methods) != 1 || !methods[0].ServerStreaming || methods[0].ClientStreaming {
+		t.Errorf("unexpected methods: %+v", methods)
+	}
+
+	if _, err := Type(files, "describe.test.Legacy.data"); err == nil || !strings.Contains(err.Error(), "not a message, enum or service") {
+		t.Errorf("expected the field to be rejected, got: %v", err)
+	}
+	if _, err := Type(files, "describe.test.Missing"); err == nil {
+		t.Errorf("expected the missing type to be rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package describe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilesText renders the summary of the given files as human readable
+// text, followed by the dependency graph between the files.
+func FilesText(files []File) string {
+
+	builder := strings.Builder{}
+	for _, file := range files {
+
+		builder.WriteString(fmt.Sprintf("file %s (package: %s, syntax: %s)\n", file.Path, file.Package, file.Syntax))
+		writeList(&builder, "messages", file.Messages)
+		writeList(&builder, "enums", file.Enums)
+		writeList(&builder, "extensions", file.Extensions)
+		for _, service := range file.Services {
+			builder.WriteString("  service " + service.String())
+		}
+	}
+
+	builder.WriteString("dependencies:\n")
+	for _, file := range files {
+		if len(file.Dependencies) == 0 {
+			builder.WriteString(fmt.Sprintf("  %s\n", file.Path))
+		}
+		for _, dependency := range file.Dependencies {
+			builder.WriteString(fmt.Sprintf("  %s -> %s\n", file.Path, dependency))
+		}
+	}
+	return builder.String()
+}
+
+// String renders the service and its methods as human readable text.
+func (s *Service) String() string {
+
+	builder := strings.Builder{}
+	builder.WriteString(s.Name + "\n")
+	for _, method := range s.Methods {
+		input, output := method.Input, method.Output
+		if method.ClientStreaming {
+			input = "stream " + input
+		}
+		if method.ServerStreaming {
+			output = "stream " + output
+		}
+		builder.WriteString(fmt.Sprintf("    rpc %s(%s) returns (%s)\n", method.Name, input, output))
+	}
+	return builder.String()
+}
+
+// String renders the message and its fields as human readable text.
+func (m *Message) String() string {
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("message %s (file: %s)\n", m.Name, m.File))
+	if len(m.Options) > 0 {
+		builder.WriteString(fmt.Sprintf("  options: %s\n", m.Options))
+	}
+	for _, field := range m.Fields {
+
+		builder.WriteString(fmt.Sprintf("  %3d %-20s %-10s %s json_name=%s", field.Number, field.Name, field.Label, field.Type, field.JSONName))
+		if len(field.Oneof) > 0 {
+			builder.WriteString(" oneof=" + field.Oneof)
+		}
+		if len(field.Default) > 0 {
+			builder.WriteString(" default=" + field.Default)
+		}
+		if len(field.Options) > 0 {
+			builder.WriteString(" options=[" + field.Options + "]")
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// String renders the enum and its values as human readable text.
+func (e *Enum) String() string {
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("enum %s (file: %s)\n", e.Name, e.File))
+	if len(e.Options) > 0 {
+		builder.WriteString(fmt.Sprintf("  options: %s\n", e.Options))
+	}
+	for _, value := range e.Values {
+		builder.WriteString(fmt.Sprintf("  %3d %s", value.Number, value.Name))
+		if len(value.Options) > 0 {
+			builder.WriteString(" options=[" + value.Options + "]")
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// writeList writes a labelled list of names, one per line, skipping
+// empty lists.
+func writeList(builder *strings.Builder, label string, names []string) {
+
+	if len(names) == 0 {
+		return
+	}
+	builder.WriteString(fmt.Sprintf("  %s:\n", label))
+	for _, name := range names {
+		builder.WriteString(fmt.Sprintf("    %s\n", name))
+	}
+}
@@ -0,0 +1,319 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Kind identifies the type of difference detected for a field.
+type Kind int
+
+const (
+	// Added identifies values only present in the right message.
+	Added Kind = iota
+	// Removed identifies values only present in the left message.
+	Removed
+	// Changed identifies values present in both messages with a
+	// different content.
+	Changed
+)
+
+// String returns the lowercase name of the kind.
+func (k Kind) String() string {
+
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	default:
+		return "changed"
+	}
+}
+
+// MarshalText renders the kind as its name in JSON documents.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Options controls the behaviour of the comparison.
+type Options struct {
+	// FloatTolerance is the maximum absolute difference between two
+	// float or double values that are considered equal.
+	FloatTolerance float64
+}
+
+// Difference describes a field-level difference between two messages.
+// The path identifies the field by using the protobuf names of the fields
+// traversed from the root message, with indexes for repeated fields and
+// keys for map fields.
+type Difference struct {
+	Path  string      `json:"path"`
+	Kind  Kind        `json:"kind"`
+	Left  interface{} `json:"left,omitempty"`
+	Right interface{} `json:"right,omitempty"`
+}
+
+// String renders the difference as a single line of text.
+func (d Difference) String() string {
+
+	switch d.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", d.Path, render(d.Right))
+	case Removed:
+		return fmt.Sprintf("- %s: %s", d.Path, render(d.Left))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", d.Path, render(d.Left), render(d.Right))
+	}
+}
+
+// Compare compares the content of the `left` and `right` messages and
+// returns the list of field-level differences between the two. Repeated
+// fields are compared by position, map fields by key and floating point
+// values are considered equal when they are within the tolerance given
+// in `options`. The two messages must be of the same type.
+func Compare(left protoreflect.Message, right protoreflect.Message, options Options) ([]Difference, error) {
+
+	leftName, rightName := left.Descriptor().FullName(), right.Descriptor().FullName()
+	if leftName != rightName {
+		return nil, fmt.Errorf("cannot compare messages of different types (left: %s, right: %s)", leftName, rightName)
+	}
+
+	c := comparator{options: options, differences: []Difference{}}
+	c.compareMessages("", left, right)
+	return c.differences, nil
+}
+
+// comparator accumulates the differences found while walking the two
+// messages being compared.
+type comparator struct {
+	options     Options
+	differences []Difference
+}
+
+// compareMessages compares all the fields declared by the descriptor of
+// the given messages, as well as their unknown fields. The messages may
+// have been decoded with distinct descriptors of the same type, hence
+// fields of the right message are matched by number, and the fields only
+// declared by the descriptor of the right message are reported as added.
+func (c *comparator) compareMessages(path string, left protoreflect.Message, right protoreflect.Message) {
+
+	fields := left.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+
+		fd := fields.Get(i)
+		fieldPath := join(path, string(fd.Name()))
+		leftValue, rightValue, hasLeft, hasRight := left.Get(fd), protoreflect.Value{}, left.Has(fd), false
+		if rfd := right.Descriptor().Fields().ByNumber(fd.Number()); rfd != nil {
+			rightValue, hasRight = right.Get(rfd), right.Has(rfd)
+		}
+
+		switch {
+		case !hasLeft && !hasRight:
+			continue
+		case !hasRight:
+			c.add(fieldPath, Removed, fieldValueOf(fd, leftValue), nil)
+		case !hasLeft:
+			c.add(fieldPath, Added, nil, fieldValueOf(fd, rightValue))
+		case fd.IsList():
+			c.compareLists(fieldPath, fd, leftValue.List(), rightValue.List())
+		case fd.IsMap():
+			c.compareMaps(fieldPath, fd, leftValue.Map(), rightValue.Map())
+		default:
+			c.compareValues(fieldPath, fd, leftValue, rightValue)
+		}
+	}
+
+	rightFields := right.Descriptor().Fields()
+	for i := 0; i < rightFields.Len(); i++ {
+
+		fd := rightFields.Get(i)
+		if fields.ByNumber(fd.Number()) != nil || !right.Has(fd) {
+			continue
+		}
+		c.add(join(path, string(fd.Name())), Added, nil, fieldValueOf(fd, right.Get(fd)))
+	}
+
+	leftUnknown, rightUnknown := left.GetUnknown(), right.GetUnknown()
+	if !bytes.Equal(leftUnknown, rightUnknown) {
+		c.add(join(path, "<unknown>"), Changed, []byte(leftUnknown), []byte(rightUnknown))
+	}
+}
+
+// compareLists compares two repeated fields element by element.
+func (c *comparator) compareLists(path string, fd protoreflect.FieldDescriptor, left protoreflect.List, right protoreflect.List) {
+
+	for i := 0; i < left.Len() || i < right.Len(); i++ {
+
+		elementPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= right.Len():
+			c.add(elementPath, Removed, valueOf(fd, left.Get(i)), nil)
+		case i >= left.Len():
+			c.add(elementPath, Added, nil, valueOf(fd, right.Get(i)))
+		default:
+			c.compareValues(elementPath, fd, left.Get(i), right.Get(i))
+		}
+	}
+}
+
+// compareMaps compares two map fields entry by entry, visiting the keys
+// in lexical order so that the output is stable.
+func (c *comparator) compareMaps(path string, fd protoreflect.FieldDescriptor, left protoreflect.Map, right protoreflect.Map) {
+
+	keys := map[string]protoreflect.MapKey{}
+	collect := func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys[key.String()] = key
+		return true
+	}
+	left.Range(collect)
+	right.Range(collect)
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	valueField := fd.MapValue()
+	for _, name := range names {
+
+		key := keys[name]
+		entryPath := fmt.Sprintf("%s[%q]", path, name)
+		hasLeft, hasRight := left.Has(key), right.Has(key)
+
+		switch {
+		case !hasRight:
+			c.add(entryPath, Removed, valueOf(valueField, left.Get(key)), nil)
+		case !hasLeft:
+			c.add(entryPath, Added, nil, valueOf(valueField, right.Get(key)))
+		default:
+			c.compareValues(entryPath, valueField, left.Get(key), right.Get(key))
+		}
+	}
+}
+
+// compareValues compares two singular values of the given field, which
+// are either scalar values or messages.
+func (c *comparator) compareValues(path string, fd protoreflect.FieldDescriptor, left protoreflect.Value, right protoreflect.Value) {
+
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		c.compareMessages(path, left.Message(), right.Message())
+		return
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if c.equalFloats(left.Float(), right.Float()) {
+			return
+		}
+	case protoreflect.BytesKind:
+		if bytes.Equal(left.Bytes(), right.Bytes()) {
+			return
+		}
+	default:
+		if left.Interface() == right.Interface() {
+			return
+		}
+	}
+	c.add(path, Changed, valueOf(fd, left), valueOf(fd, right))
+}
+
+// equalFloats compares two floating point values by using the configured
+// tolerance. NaN values are considered equal to each other.
+func (c *comparator) equalFloats(left float64, right float64) bool {
+
+	if math.IsNaN(left) || math.IsNaN(right) {
+		return math.IsNaN(left) && math.IsNaN(right)
+	}
+	if left == right {
+		return true
+	}
+	return math.Abs(left-right) <= c.options.FloatTolerance
+}
+
+// add records a difference.
+func (c *comparator) add(path string, kind Kind, left interface{}, right interface{}) {
+
+	c.differences = append(c.differences, Difference{Path: path, Kind: kind, Left: left, Right: right})
+}
+
+// fieldValueOf converts the value of a field into a plain Go value, by
+// converting each element of repeated and map fields.
+func fieldValueOf(fd protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+
+	switch {
+	case fd.IsList():
+		list := value.List()
+		values := make([]interface{}, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			values[i] = valueOf(fd, list.Get(i))
+		}
+		return values
+	case fd.IsMap():
+		entries := map[string]interface{}{}
+		value.Map().Range(func(key protoreflect.MapKey, entry protoreflect.Value) bool {
+			entries[key.String()] = valueOf(fd.MapValue(), entry)
+			return true
+		})
+		return entries
+	default:
+		return valueOf(fd, value)
+	}
+}
+
+// valueOf converts a protobuf value into a plain Go value that can be
+// rendered as text or JSON. Enum values are rendered with their names
+// and messages with their JSON representation.
+func valueOf(fd protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(value.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(value.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(value.Message().Interface())
+		if err != nil {
+			return value.Message().Interface()
+		}
+		compact := bytes.Buffer{}
+		if json.Compact(&compact, data) != nil {
+			return json.RawMessage(data)
+		}
+		return json.RawMessage(compact.Bytes())
+	default:
+		return value.Interface()
+	}
+}
+
+// render converts a value into text for the human readable output.
+func render(value interface{}) string {
+
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case json.RawMessage:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// join appends a field name to the given path.
+func join(path string, name string) string {
+
+	if len(path) == 0 {
+		return name
+	}
+	return strings.Join([]string{path, name}, ".")
+}
@@ -0,0 +1,200 @@
+package diff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// compare compares the two messages, and fails the test on error.
+func compare(t *testing.T, left proto.Message, right proto.Message, options Options) []Difference {
+
+	t.Helper()
+	differences, err := Compare(left.ProtoReflect(), right.ProtoReflect(), options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return differences
+}
+
+// lines renders the differences one per line.
+func lines(differences []Difference) string {
+
+	rendered := []string{}
+	for _, difference := range differences {
+		rendered = append(rendered, difference.String())
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// extendedSimpleMessage returns the descriptor of a later version of the
+// simple message, which declares the `param_16` field too.
+func extendedSimpleMessage(t *testing.T) protoreflect.MessageDescriptor {
+
+	t.Helper()
+	fdp := protodesc.ToFileDescriptorProto((&events.SimpleMessage{}).ProtoReflect().Descriptor().ParentFile())
+	for _, message := range fdp.MessageType {
+		if message.GetName() == "SimpleMessage" {
+			message.Field = append(message.Field, &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String("param_16"),
+				JsonName: proto.String("param16"),
+				Number:   proto.Int32(16),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			})
+		}
+	}
+	file, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return file.Messages().ByName("SimpleMessage")
+}
+
+func TestCompareScalars(t *testing.T) {
+
+	left := &events.SimpleMessage{Param_01: "first", Param_02: true, Param_03: []byte{1}, Param_04: 4}
+	right := &events.SimpleMessage{Param_01: "second", Param_03: []byte{1}, Param_05: 5}
+
+	expected := strings.Join([]string{
+		`~ param_01: "first" -> "second"`,
+		`- param_02: true`,
+		`- param_04: 4`,
+		`+ param_05: 5`,
+	}, "\n")
+	if actual := lines(compare(t, left, right, Options{})); actual != expected {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+	if differences := compare(t, left, left, Options{}); len(differences) != 0 {
+		t.Errorf("unexpected differences: %v", differences)
+	}
+}
+
+func TestCompareFloatTolerance(t *testing.T) {
+
+	left := &events.SimpleMessage{Param_14: 1.5, Param_15: 10}
+	right := &events.SimpleMessage{Param_14: 1.5001, Param_15: 10.01}
+
+	if actual := lines(compare(t, left, right, Options{})); actual != "~ param_14: 1.5 -> 1.5001\n~ param_15: 10 -> 10.01" {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+	// only the double is beyond the tolerance (float32 rounding included).
+	if actual := lines(compare(t, left, right, Options{FloatTolerance: 0.001})); actual != "~ param_15: 10 -> 10.01" {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+	if differences := compare(t, left, right, Options{FloatTolerance: 0.1}); len(differences) != 0 {
+		t.Errorf("unexpected differences: %v", differences)
+	}
+}
+
+func TestCompareListsByPosition(t *testing.T) {
+
+	left := &events.ComplexMessage{Param_01: []string{"a", "b", "c"}}
+	right := &events.ComplexMessage{Param_01: []string{"a", "c"}}
+
+	expected := "~ param_01[1]: \"b\" -> \"c\"\n- param_01[2]: \"c\""
+	if actual := lines(compare(t, left, right, Options{})); actual != expected {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+	expected = "~ param_01[1]: \"c\" -> \"b\"\n+ param_01[2]: \"c\""
+	if actual := lines(compare(t, right, left, Options{})); actual != expected {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+	// a list missing on one side is a single difference.
+	if actual := lines(compare(t, left, &events.ComplexMessage{}, Options{})); actual != `- param_01: [a b c]` {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+}
+
+func TestCompareMapsByKey(t *testing.T) {
+
+	left := &events.ComplexMessage{Param_02: map[string]string{"b": "1", "a": "1", "d": "1"}}
+	right := &events.ComplexMessage{Param_02: map[string]string{"d": "1", "a": "2", "c": "1"}}
+
+	// the keys are visited in lexical order, whatever the insertion order.
+	expected := strings.Join([]string{
+		`~ param_02["a"]: "1" -> "2"`,
+		`- param_02["b"]: "1"`,
+		`+ param_02["c"]: "1"`,
+	}, "\n")
+	if actual := lines(compare(t, left, right, Options{})); actual != expected {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+}
+
+func TestCompareNestedMessages(t *testing.T) {
+
+	left := &events.ComposedMessage{Param_01: &events.SimpleMessage{Param_01: "first"}, Param_02: &events.ComplexMessage{Param_01: []string{"a"}}}
+	right := &events.ComposedMessage{Param_01: &events.SimpleMessage{Param_01: "second"}}
+
+	expected := "~ param_01.param_01: \"first\" -> \"second\"\n- param_02: {\"param_01\":[\"a\"]}"
+	if actual := lines(compare(t, left, right, Options{})); actual != expected {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+}
+
+func TestCompareDistinctDescriptors(t *testing.T) {
+
+	md := extendedSimpleMessage(t)
+	extended := dynamicpb.NewMessage(md)
+	extended.Set(md.Fields().ByName("param_01"), protoreflect.ValueOfString("second"))
+	extended.Set(md.Fields().ByName("param_16"), protoreflect.ValueOfString("added"))
+	simple := &events.SimpleMessage{Param_01: "first"}
+
+	// the fields only declared on the right are added.
+	if actual := lines(compare(t, simple, extended, Options{})); actual != "~ param_01: \"first\" -> \"second\"\n+ param_16: \"added\"" {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+	// and those only declared on the left are removed.
+	if actual := lines(compare(t, extended, simple, Options{})); actual != "~ param_01: \"second\" -> \"first\"\n- param_16: \"added\"" {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+	// unset fields are not reported.
+	extended.Clear(md.Fields().ByName("param_16"))
+	if actual := lines(compare(t, simple, extended, Options{})); actual != "~ param_01: \"first\" -> \"second\"" {
+		t.Errorf("unexpected differences:\n%s", actual)
+	}
+}
+
+func TestCompareRejectsDifferentTypes(t *testing.T) {
+
+	_, err := Compare((&events.SimpleMessage{}).ProtoReflect(), (&events.ComplexMessage{}).ProtoReflect(), Options{})
+	if err == nil || !strings.Contains(err.Error(), "different types") {
+		t.Errorf("expected the comparison to be rejected, got: %v", err)
+	}
+}
+
+func TestDifferencesJSON(t *testing.T) {
+
+	left := &events.ComposedMessage{Param_01: &events.SimpleMessage{Param_01: "first", Param_03: []byte{0xff}}}
+	right := &events.ComposedMessage{Param_01: &events.SimpleMessage{Param_01: "second", Param_04: 4}, Param_02: &events.ComplexMessage{Param_01: []string{"a"}}}
+
+	data, err := json.Marshal(compare(t, left, right, Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[` +
+		`{"path":"param_01.param_01","kind":"changed","left":"first","right":"second"},` +
+		`{"path":"param_01.param_03","kind":"removed","left":"/w=="},` +
+		`{"path":"param_01.param_04","kind":"added","right":4},` +
+		`{"path":"param_02","kind":"added","right":{"param_01":["a"]}}` +
+		`]`
+	if string(data) != expected {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+
+	// no difference is an empty list rather than null.
+	data, _ = json.Marshal(compare(t, left, left, Options{}))
+	if string(data) != "[]" {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+}
@@ -0,0 +1,142 @@
+package publisher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	events "publisher/pkg/events/v1"
+	"publisher/pkg/parser"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Fixture creates the sample instance of a message type linked in the
+// executable, whose content is chosen by hand rather than generated.
+type Fixture func() protoreflect.ProtoMessage
+
+// Entry describes a message type of the catalog of the emitter.
+type Entry struct {
+	// Name is the fully qualified name of the message type.
+	Name protoreflect.FullName `json:"name"`
+	// HasFixture determines whether the sample instance of the type is
+	// created by a fixture, or it is a generated instance.
+	HasFixture bool `json:"fixture"`
+}
+
+// String renders the entry as a line of the list of types.
+func (e Entry) String() string {
+
+	source := "generated"
+	if e.HasFixture {
+		source = "fixture"
+	}
+	return fmt.Sprintf("%-9s %s", source, e.Name)
+}
+
+// fixturesLock guards the access to the registered fixtures.
+var fixturesLock sync.RWMutex
+
+// fixtures maps the fully qualified names of the message types to the
+// fixtures creating their sample instances.
+var fixtures = map[protoreflect.FullName]Fixture{}
+
+// RegisterFixture registers the fixture creating the sample instance of the
+// message type with the given fully qualified name, replacing the fixture
+// previously registered for the type, if any.
+func RegisterFixture(name protoreflect.FullName, fixture Fixture) {
+
+	fixturesLock.Lock()
+	defer fixturesLock.Unlock()
+	fixtures[name] = fixture
+}
+
+// hiddenPackages lists the prefixes of the names of the message types linked
+// in the executable by its dependencies rather than for emission: the
+// well-known types and descriptors of protobuf, the status of gRPC and the
+// messages of the gRPC services (reflection, binary logging, ...).
+var hiddenPackages = []string{"google.protobuf.", "google.rpc.", "grpc."}
+
+// isHidden determines whether the message type with the given name belongs
+// to a package of the dependencies of the executable.
+func isHidden(name protoreflect.FullName) bool {
+
+	for _, prefix := range hiddenPackages {
+		if strings.HasPrefix(string(name), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Catalog lists the message types that can be emitted, which are the message
+// types linked in the executable (i.e. registered in the global registry of
+// types) except those of the packages of its dependencies, sorted by name.
+// The hidden types can still be emitted by their fully qualified name.
+func Catalog() []Entry {
+
+	fixturesLock.RLock()
+	defer fixturesLock.RUnlock()
+
+	entries := []Entry{}
+	protoregistry.GlobalTypes.RangeMessages(func(messageType protoreflect.MessageType) bool {
+		name := messageType.Descriptor().FullName()
+		if isHidden(name) {
+			return true
+		}
+		_, hasFixture := fixtures[name]
+		entries = append(entries, Entry{Name: name, HasFixture: hasFixture})
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// NewMessage creates the sample instance of the message type with the given
+// name, which is either a simple name of the sample package (e.g.
+// `SimpleMessage`) or a fully qualified name of any message type linked in
+// the executable. The instance is created by the fixture registered for the
+// type, or populated by a generator (see Generator) with a fixed seed, so
+// that the same type always produces the same instance.
+func NewMessage(messageType string) (protoreflect.ProtoMessage, error) {
+
+	name := parser.QualifiedName(messageType)
+	resolved, err := protoregistry.GlobalTypes.FindMessageByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type: '%s'", messageType)
+	}
+
+	fixturesLock.RLock()
+	fixture, isPresent := fixtures[name]
+	fixturesLock.RUnlock()
+	if isPresent {
+		return fixture(), nil
+	}
+
+	message := resolved.New()
+	NewGenerator(0, DefaultMaxDepth).populate(message, 1)
+	return message.Interface(), nil
+}
+
+// FormatCatalog renders the given entries one per line.
+func FormatCatalog(entries []Entry) string {
+
+	lines := []string{}
+	for _, entry := range entries {
+		lines = append(lines, entry.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// init registers the fixtures of the sample types.
+func init() {
+
+	RegisterFixture((&events.SimpleMessage{}).ProtoReflect().Descriptor().FullName(), func() protoreflect.ProtoMessage { return newSimpleMessage() })
+	RegisterFixture((&events.ComplexMessage{}).ProtoReflect().Descriptor().FullName(), func() protoreflect.ProtoMessage { return newComplexMessage() })
+	RegisterFixture((&events.ComposedMessage{}).ProtoReflect().Descriptor().FullName(), func() protoreflect.ProtoMessage { return newComposedMessage() })
+	RegisterFixture((&events.ImportMessage{}).ProtoReflect().Descriptor().FullName(), func() protoreflect.ProtoMessage { return newImportMessage() })
+	RegisterFixture((&events.EnumMessage{}).ProtoReflect().Descriptor().FullName(), func() protoreflect.ProtoMessage { return newEnumMessage() })
+	RegisterFixture((&events.NestedMessage{}).ProtoReflect().Descriptor().FullName(), func() protoreflect.ProtoMessage { return newNestedMessage() })
+}
@@ -0,0 +1,50 @@
+package publisher
+
+import (
+	"strings"
+	"testing"
+
+	events "publisher/pkg/events/v1"
+)
+
+func TestCatalogListsSampleTypes(t *testing.T) {
+
+	entries := Catalog()
+	names := map[string]bool{}
+	for _, entry := range entries {
+		name := string(entry.Name)
+		names[name] = entry.HasFixture
+		// the types linked by the dependencies are not listed.
+		for _, prefix := range []string{"google.protobuf.", "google.rpc.", "grpc."} {
+			if strings.HasPrefix(name, prefix) {
+				t.Errorf("unexpected type of a dependency: %s", name)
+			}
+		}
+	}
+
+	simple := string((&events.SimpleMessage{}).ProtoReflect().Descriptor().FullName())
+	sub := string((&events.SubMessage{}).ProtoReflect().Descriptor().FullName())
+	if hasFixture, isListed := names[simple]; !isListed || !hasFixture {
+		t.Errorf("expected %s to be listed with a fixture", simple)
+	}
+	if hasFixture, isListed := names[sub]; !isListed || hasFixture {
+		t.Errorf("expected %s to be listed as generated", sub)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i-1].Name >= entries[i].Name {
+			t.Errorf("the entries are not sorted: %s, %s", entries[i-1].Name, entries[i].Name)
+		}
+	}
+}
+
+func TestNewMessageOfHiddenType(t *testing.T) {
+
+	// the hidden types can still be emitted by their fully qualified name.
+	message, err := NewMessage("google.protobuf.Timestamp")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name := message.ProtoReflect().Descriptor().FullName(); name != "google.protobuf.Timestamp" {
+		t.Errorf("unexpected type: %s", name)
+	}
+}
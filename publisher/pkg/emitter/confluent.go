@@ -0,0 +1,24 @@
+package publisher
+
+import (
+	"publisher/pkg/confluent"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ConfluentSchemaID is the identifier assigned by the Schema Registry to
+// the schema of the messages emitted. When set to a non-negative value the
+// protobuf binaries are framed according to the Confluent wire format, with
+// the message indexes computed from the descriptor of the message.
+var ConfluentSchemaID int64 = -1
+
+// frame prefixes the protobuf binary of the given message with the Confluent
+// framing, when a schema identifier is configured.
+func frame(message protoreflect.ProtoMessage, buffer []byte) []byte {
+
+	if ConfluentSchemaID < 0 {
+		return buffer
+	}
+	indexes := confluent.Indexes(message.ProtoReflect().Descriptor())
+	return confluent.Encode(uint32(ConfluentSchemaID), indexes, buffer)
+}
@@ -0,0 +1,58 @@
+package publisher
+
+import (
+	"bytes"
+	"testing"
+
+	"publisher/pkg/confluent"
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFrameNestedMessage(t *testing.T) {
+
+	previous := ConfluentSchemaID
+	ConfluentSchemaID = 7
+	defer func() { ConfluentSchemaID = previous }()
+
+	message := &events.NestedMessage_ProfileMessage{Name: "alice", Age: 42}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := confluent.Decode(frame(message, payload))
+	if err != nil {
+		t.Fatalf("invalid framing: %v", err)
+	}
+	if frame.SchemaID != 7 || len(frame.Indexes) != 2 || frame.Indexes[0] != 5 || frame.Indexes[1] != 0 {
+		t.Errorf("unexpected frame: %+v", frame)
+	}
+	if !bytes.Equal(frame.Payload, payload) {
+		t.Errorf("unexpected payload: %x", frame.Payload)
+	}
+}
+
+func TestFrameFirstMessageUsesShortcut(t *testing.T) {
+
+	previous := ConfluentSchemaID
+	ConfluentSchemaID = 1
+	defer func() { ConfluentSchemaID = previous }()
+
+	message := newSimpleMessage()
+	payload, _ := proto.Marshal(message)
+	framed := frame(message, payload)
+	if !bytes.Equal(framed[:6], []byte{confluent.MagicByte, 0, 0, 0, 1, 0}) || !bytes.Equal(framed[6:], payload) {
+		t.Errorf("unexpected framing: %x", framed[:6])
+	}
+}
+
+func TestFrameDisabled(t *testing.T) {
+
+	message := newSimpleMessage()
+	payload, _ := proto.Marshal(message)
+	if framed := frame(message, payload); !bytes.Equal(framed, payload) {
+		t.Errorf("the binary was framed without schema identifier: %x", framed)
+	}
+}
@@ -0,0 +1,109 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	proto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Clock returns the current time. It is used to set the time of the
+// cloud events and the timestamps of the messages emitted, and can be
+// replaced to control the time observed by the emitter.
+var Clock = time.Now
+
+// IDGenerator returns the identifier of the next cloud event emitted.
+// It can be replaced to control the identifiers assigned to events.
+var IDGenerator = func() string {
+	return uuid.New().String()
+}
+
+// EventSource is the value of the `source` attribute of the cloud
+// events emitted.
+var EventSource = "http://localhost/publisher"
+
+// Deterministic determines whether protobuf binaries are marshalled
+// deterministically (i.e. with map entries sorted by key) and JSON
+// documents are rendered with sorted keys.
+var Deterministic = false
+
+// EnableDeterministicMode configures the emitter so that the same inputs
+// always produce byte-identical outputs. The clock is fixed to the given
+// time, the identifiers of the events are derived from a sequence, the
+// source is set to a fixed value, and both protobuf binaries and JSON
+// documents are marshalled deterministically.
+func EnableDeterministicMode(fixedTime time.Time) {
+
+	Clock = func() time.Time { return fixedTime }
+	IDGenerator = SequentialIDGenerator("publisher")
+	EventSource = "http://localhost/publisher"
+	Deterministic = true
+}
+
+// SequentialIDGenerator returns a generator of identifiers that are
+// name-based UUIDs (version 5) computed from the given namespace and
+// a counter, which makes the sequence of identifiers reproducible.
+func SequentialIDGenerator(namespace string) func() string {
+
+	sequence := 0
+	return func() string {
+		sequence++
+		return uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("%s/%d", namespace, sequence))).String()
+	}
+}
+
+// marshal serialises the given message into a protobuf binary, honouring
+// the deterministic mode and the Confluent framing.
+func marshal(message protoreflect.ProtoMessage) ([]byte, error) {
+
+	buffer, err := proto.MarshalOptions{Deterministic: Deterministic}.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return frame(message, buffer), nil
+}
+
+// marshalJSON serialises the given value into JSON. In deterministic mode
+// the keys of the JSON objects are sorted, regardless of the order used
+// by the marshaller of the value.
+func marshalJSON(value interface{}) ([]byte, error) {
+
+	data, err := json.Marshal(value)
+	if err != nil || !Deterministic {
+		return data, err
+	}
+	return sortKeys(data)
+}
+
+// canonicalJSON renders the given document with sorted keys in deterministic
+// mode. Documents that are not JSON objects or arrays (e.g. protobuf binaries
+// produced by an envelope) are returned as they are.
+func canonicalJSON(data []byte) ([]byte, error) {
+
+	trimmed := bytes.TrimSpace(data)
+	if !Deterministic || len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') || !json.Valid(trimmed) {
+		return data, nil
+	}
+
+	return sortKeys(trimmed)
+}
+
+// sortKeys renders the given JSON document with the keys of its objects
+// sorted. Numbers are kept as they are written, so that integers beyond
+// the precision of a float64 (i.e. 2^53) are not rounded.
+func sortKeys(data []byte) ([]byte, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var generic interface{}
+	err := decoder.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
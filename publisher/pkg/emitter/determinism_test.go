@@ -0,0 +1,81 @@
+package publisher
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// withDeterministicMode enables the deterministic mode for the duration
+// of the test.
+func withDeterministicMode(t *testing.T) {
+
+	t.Helper()
+	clock, generator, source, deterministic := Clock, IDGenerator, EventSource, Deterministic
+	t.Cleanup(func() {
+		Clock, IDGenerator, EventSource, Deterministic = clock, generator, source, deterministic
+	})
+	EnableDeterministicMode(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func TestMarshalJSONKeepsLargeIntegers(t *testing.T) {
+
+	withDeterministicMode(t)
+
+	value := map[string]interface{}{
+		"b": uint64(18446744073709551615),
+		"a": []interface{}{int64(9007199254740993), -9223372036854775808, 1.5},
+	}
+	expected := `{"a":[9007199254740993,-9223372036854775808,1.5],"b":18446744073709551615}`
+
+	data, err := marshalJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+
+	data, err = canonicalJSON([]byte(` {"b":18446744073709551615,"a":[9007199254740993,-9223372036854775808,1.5]}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+}
+
+func TestSerializeMessagesIsReproducible(t *testing.T) {
+
+	messages := []protoreflect.ProtoMessage{
+		&events.ComplexMessage{Param_01: []string{"a", "b"}, Param_02: map[string]string{"z": "1", "y": "2", "x": "3", "w": "4"}},
+		&events.SimpleMessage{Param_05: -9223372036854775808, Param_07: 18446744073709551615},
+	}
+
+	for _, format := range []string{FormatCloudEvent, FormatPubSub, FormatDelimited} {
+
+		emit := func() []byte {
+			withDeterministicMode(t)
+			path := filepath.Join(t.TempDir(), "events")
+			if err := SerializeMessages(path, "ComplexMessage", "root.pb", messages, format); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}
+
+		first, second := emit(), emit()
+		if len(first) == 0 || !bytes.Equal(first, second) {
+			t.Errorf("%s: the outputs differ:\n%s\n%s", format, first, second)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package publisher
+
+import (
+	"sync"
+
+	"publisher/pkg/bundle"
+	"publisher/pkg/envelope"
+	"publisher/pkg/export"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// EmbedSchema determines whether the messages emitted embed the bundle of
+// their schema (see the `bundle` package), so that consumers that cannot
+// reach the schema URI can still decode them. Cloud events carry it as an
+// extension attribute, while raw messages require the self-describing
+// envelope.
+var EmbedSchema = false
+
+// schema is the bundle of the schema of a message type, serialised, with
+// its digest.
+type schema struct {
+	descriptor []byte
+	digest     string
+}
+
+// schemas caches the bundles of the schemas embedded, indexed by message
+// descriptor.
+var schemas sync.Map
+
+// embeddedSchema returns the bundle of the schema of the given message type,
+// which is computed once per type. The bundle is serialised deterministically,
+// hence the same type always yields the same bytes and digest.
+func embeddedSchema(md protoreflect.MessageDescriptor) (schema, error) {
+
+	if cached, isPresent := schemas.Load(md); isPresent {
+		return cached.(schema), nil
+	}
+
+	set, err := bundle.Build(md)
+	if err != nil {
+		return schema{}, err
+	}
+	descriptor, err := export.Marshal(set)
+	if err != nil {
+		return schema{}, err
+	}
+
+	embedded := schema{descriptor: descriptor, digest: envelope.Digest(descriptor)}
+	schemas.Store(md, embedded)
+	return embedded, nil
+}
@@ -1,128 +1,203 @@
 package publisher
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"time"
-
-	"github.com/google/uuid"
+	"path/filepath"
+	"strings"
 
+	"publisher/pkg/envelope"
 	events "publisher/pkg/events/v1"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
-	proto "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// SerializeSimpleMessage persists to the specified path an `SimpleMessage`.
-// The serialisation process can either wrap the serialised protobuf version
-// of the message with a `CloudEvent` structure or publishing it as is (raw).
-// In case the message is serialised within a cloud event, then the value of
-// `schemaURI` is used to embed information about the schema of the message
-// to enable dynamic consumption.
-func SerializeSimpleMessage(path string, schemaURI string, isRaw bool) error {
+// Output formats supported when persisting multiple messages.
+const (
+	// FormatRaw saves each message as a protobuf binary.
+	FormatRaw = "raw"
+	// FormatCloudEvent wraps each message into a cloud event.
+	FormatCloudEvent = "cloudevent"
+	// FormatDelimited saves the messages as a stream of protobuf
+	// binaries, each prefixed by its size.
+	FormatDelimited = "delimited"
+	// FormatPubSub wraps each message into the JSON representation
+	// of a Pub/Sub message, carrying the attributes of PubSubSchema.
+	FormatPubSub = "pubsub"
+)
 
-	message := newSimpleMessage()
-	return SerializeMessage(path, "SimpleMessage", schemaURI, message, isRaw)
-}
+// SerializeMessage implements the heavy-lifting required for emitting a cloud event.
+// It generates a cloud even wrapper and configures it to transport the given message
+// as payload of the event, serialised in base64 binary. The cloud event isntance is
+// then serialised into JSON and persisted to the path specified by the caller. The
+// value of schemaURI is used to provide a reference to the Protobuf file descriptor
+// that can be used by consumer to deserialise the payload of the event.
+func SerializeMessage(path string, messageType string, schemaURI string, message protoreflect.ProtoMessage, isRaw bool) error {
 
-// SerializeComplexMessage persists to the specified path an `ComplexMessage`.
-// The serialisation process can either wrap the serialised protobuf version
-// of the message with a `CloudEvent` structure or publishing it as is (raw).
-// In case the message is serialised within a cloud event, then the value of
-// `schemaURI` is used to embed information about the schema of the message
-// to enable dynamic consumption.
-func SerializeComplexMessage(path string, schemaURI string, isRaw bool) error {
+	buffer, err := marshal(message)
+	if err != nil {
+		return err
+	}
 
-	message := newComplexMessage()
-	return SerializeMessage(path, "ComplexMessage", schemaURI, message, isRaw)
-}
+	if !isRaw {
+
+		ce, err := newCloudEvent(messageType, schemaURI, message, buffer)
+		if err != nil {
+			return err
+		}
+		bytes, err := marshalJSON(ce)
+		if err != nil {
+			return err
+		}
 
-// SerializeImportMessage persists to the specified path an `ImportMessage`.
-// The serialisation process can either wrap the serialised protobuf version of
-// the message with a `CloudEvent` structure or publishing it as it is (raw).
-// In case the message is serialised within a cloud event, then the value of
-// `schemaURI` is used to embed information about the schema of the message
-// to enable dynamic consumption.
-func SerializeImportMessage(path string, schemaURI string, isRaw bool) error {
+		buffer = bytes
+	}
 
-	message := newImportMessage()
-	return SerializeMessage(path, "ImportMessage", schemaURI, message, isRaw)
+	return writeFile(path, buffer)
 }
 
-// SerializeComposedMessage persists to the specified path an `ComposedMessage`.
-// The serialisation process can either wrap the serialised protobuf version of
-// the message with a `CloudEvent` structure or publishing it as it is (raw).
-// In case the message is serialised within a cloud event, then the value of
-// `schemaURI` is used to embed information about the schema of the message
-// to enable dynamic consumption.
-func SerializeComposedMessage(path string, schemaURI string, isRaw bool) error {
+// SerializeMessages persists the given messages according to the specified format.
+// With `FormatRaw` each message is saved as protobuf binary in a separate file (when
+// more than one message is given, the path is suffixed with the index of the message),
+// and with `FormatPubSub` the messages are wrapped into Pub/Sub messages and saved as
+// a single message or, when more than one message is given, as a JSON array. Any other
+// format is the name of an envelope (see the `envelope` package), which wraps all the
+// messages into the same file: `FormatCloudEvent` saves a single event or a batch of
+// events, and `FormatDelimited` a stream of binaries, each prefixed by its size.
+func SerializeMessages(path string, messageType string, schemaURI string, messages []protoreflect.ProtoMessage, format string) error {
+
+	switch format {
+	case FormatRaw:
+
+		for i, message := range messages {
+			target := path
+			if len(messages) > 1 {
+				target = indexedPath(path, i)
+			}
+			err := SerializeMessage(target, messageType, schemaURI, message, true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 
-	message := newComposedMessage()
-	return SerializeMessage(path, "ComposedMessage", schemaURI, message, isRaw)
-}
+	case FormatPubSub:
 
-// SerializeEnumMessage persists to the specified path an `EnumMessage`. The
-// serialisation process can either wrap the serialised protobuf version of
-// the message with a `CloudEvent`` structure or publishing it as it is (raw).
-// In case the message is serialised within a cloud event, then the value of
-// `schemaURI` is used to embed information about the schema of the message
-// to enable dynamic consumption.
-func SerializeEnumMessage(path string, schemaURI string, isRaw bool) error {
-	message := newEnumMessage()
-	return SerializeMessage(path, "EnumMessage", schemaURI, message, isRaw)
+		batch := []interface{}{}
+		for _, message := range messages {
+			wrapper, err := newPubSubMessage(message)
+			if err != nil {
+				return err
+			}
+			batch = append(batch, wrapper)
+		}
+		var value interface{} = batch
+		if len(batch) == 1 {
+			value = batch[0]
+		}
+		buffer, err := marshalJSON(value)
+		if err != nil {
+			return err
+		}
+		return writeFile(path, buffer)
+	}
+
+	buffer, err := wrap(format, messageType, schemaURI, messages)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, buffer)
 }
 
-// SerializeNestedMessage persists to the specified path an `NestedMessage`.
-// The serialisation process can either wrap the serialised protobuf version
-// of the message with a `CloudEvent`` structure or publishing it as it is (raw).
-// In case the message is serialised within a cloud event, then the value of
-// `schemaURI` is used to embed information about the schema of the message
-// to enable dynamic consumption.
-func SerializeNestedMessage(path string, schemaURI string, isRaw bool) error {
-	message := newNestedMessage()
-	return SerializeMessage(path, "NestedMessage", schemaURI, message, isRaw)
+// unknownFormat returns the error reporting an unknown output format.
+func unknownFormat(format string) error {
+
+	return fmt.Errorf("unknown output format: '%s' (expected %s or an envelope: %s)", format, FormatPubSub, strings.Join(envelope.Names(), ", "))
 }
 
-// SerializeMessage implements the heavy-lifting required for emitting a cloud event.
-// It generates a cloud even wrapper and configures it to transport the given message
-// as payload of the event, serialised in base64 binary. The cloud event isntance is
-// then serialised into JSON and persisted to the path specified by the caller. The
-// value of schemaURI is used to provide a reference to the Protobuf file descriptor
-// that can be used by consumer to deserialise the payload of the event.
-func SerializeMessage(path string, messageType string, schemaURI string, message protoreflect.ProtoMessage, isRaw bool) error {
+// wrap marshals the given messages and wraps them into the envelope with
+// the given name. JSON documents produced by the envelope are rendered
+// with sorted keys in deterministic mode.
+func wrap(format string, messageType string, schemaURI string, messages []protoreflect.ProtoMessage) ([]byte, error) {
 
-	buffer, err := proto.Marshal(message)
+	env, err := envelope.Lookup(format)
 	if err != nil {
-		return err
+		return nil, unknownFormat(format)
 	}
 
-	fp, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	batch := []envelope.Message{}
+	for _, message := range messages {
+		buffer, err := marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := newEnvelopeMessage(messageType, schemaURI, message, buffer)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, wrapped)
+	}
+
+	buffer, err := env.Wrap(batch)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return canonicalJSON(buffer)
+}
 
-	if !isRaw {
+// newEnvelopeMessage creates the message carried by an envelope, which
+// references the schema of the message and defines the attributes of the
+// cloud events wrapping it. When EmbedSchema is set, the message also
+// embeds the bundle of its schema (see embeddedSchema).
+func newEnvelopeMessage(messageType string, schemaURI string, message protoreflect.ProtoMessage, buffer []byte) (envelope.Message, error) {
+
+	wrapped := envelope.Message{
+		Data:      buffer,
+		SchemaURI: fmt.Sprintf("%s#%s", schemaURI, messageType),
+		Header: map[string]interface{}{
+			"id":      IDGenerator(),
+			"source":  EventSource,
+			"subject": "publisher",
+			"time":    Clock(),
+		},
+	}
+	if !EmbedSchema {
+		return wrapped, nil
+	}
 
-		ce := cloudevents.NewEvent()
-		ce.SetID(uuid.New().String())
-		ce.SetSource("http://localhost/publisher")
-		ce.SetSubject("publisher")
-		ce.SetType(messageType)
-		ce.SetDataSchema(fmt.Sprintf("%s#%s", schemaURI, messageType))
-		ce.SetData("application/protobuf", buffer)
-		ce.SetTime(time.Now())
+	schema, err := embeddedSchema(message.ProtoReflect().Descriptor())
+	if err != nil {
+		return wrapped, err
+	}
+	wrapped.Descriptor = schema.descriptor
+	wrapped.Digest = schema.digest
+	wrapped.TypeName = string(message.ProtoReflect().Descriptor().FullName())
+	return wrapped, nil
+}
 
-		bytes, err := json.Marshal(ce)
-		if err != nil {
-			return err
-		}
+// newCloudEvent creates a cloud event that transports the given protobuf binary
+// as payload, and references the schema of the message in the `dataschema`.
+func newCloudEvent(messageType string, schemaURI string, message protoreflect.ProtoMessage, buffer []byte) (cloudevents.Event, error) {
 
-		buffer = bytes
+	wrapped, err := newEnvelopeMessage(messageType, schemaURI, message, buffer)
+	if err != nil {
+		return cloudevents.Event{}, err
 	}
+	return envelope.NewEvent(wrapped)
+}
+
+// writeFile persists the given buffer to the specified path, overwriting
+// existing files.
+func writeFile(path string, buffer []byte) error {
+
+	fp, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
 
 	written, err := fp.Write(buffer)
 
@@ -136,6 +211,14 @@ func SerializeMessage(path string, messageType string, schemaURI string, message
 	return nil
 }
 
+// indexedPath inserts the given index in the file name of the specified path,
+// before the extension (e.g. `message.bin` becomes `message-0001.bin`).
+func indexedPath(path string, index int) string {
+
+	extension := filepath.Ext(path)
+	return fmt.Sprintf("%s-%04d%s", strings.TrimSuffix(path, extension), index+1, extension)
+}
+
 // newSimpleMessage generates a simple message and
 // returns a pointer to it to the caller.
 func newSimpleMessage() *events.SimpleMessage {
@@ -182,7 +265,7 @@ func newComplexMessage() *events.ComplexMessage {
 func newImportMessage() *events.ImportMessage {
 
 	return &events.ImportMessage{
-		Param_01: timestamppb.Now(),
+		Param_01: timestamppb.New(Clock()),
 		Param_02: &events.SubMessage{
 			Param_01: events.Values_VALUE_1,
 			Param_02: "this is nested!",
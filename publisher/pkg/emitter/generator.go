@@ -0,0 +1,252 @@
+package publisher
+
+import (
+	"math"
+	"math/rand"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DefaultMaxDepth is the default limit to the nesting of messages
+// generated for recursive type definitions.
+const DefaultMaxDepth = 5
+
+// maxElements is the maximum number of elements generated for repeated
+// and map fields.
+const maxElements = 3
+
+// alphabet contains the characters used to generate strings.
+const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 "
+
+// Generator produces messages of any type with random but valid content,
+// driven by the message descriptor of the type. All the fields of the
+// messages are populated, with the exception of oneof declarations (for
+// which a single member is populated) and of message fields that exceed
+// the maximum nesting depth. Required message fields (proto2) are always
+// populated, as the message could not be marshalled otherwise: beyond the
+// maximum depth only their required fields are. Generators created with
+// the same seed produce the same sequence of messages.
+type Generator struct {
+	random   *rand.Rand
+	maxDepth int
+	// required holds the types populated beyond the maximum depth, which
+	// breaks cycles of required fields (that no message can satisfy).
+	required map[protoreflect.FullName]bool
+}
+
+// NewGenerator creates a generator initialised with the given seed, which
+// populates messages up to `maxDepth` levels of nesting.
+func NewGenerator(seed int64, maxDepth int) *Generator {
+
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	return &Generator{
+		random:   rand.New(rand.NewSource(seed)),
+		maxDepth: maxDepth,
+		required: map[protoreflect.FullName]bool{},
+	}
+}
+
+// Generate creates a dynamic message of the type identified by `md` and
+// populates it with random content.
+func (g *Generator) Generate(md protoreflect.MessageDescriptor) *dynamicpb.Message {
+
+	msg := dynamicpb.NewMessage(md)
+	g.populate(msg, 1)
+	return msg
+}
+
+// populate sets random values to the fields of the given message, which
+// is at the given nesting `depth`.
+func (g *Generator) populate(msg protoreflect.Message, depth int) {
+
+	if g.populateWellKnown(msg) {
+		return
+	}
+	if depth > g.maxDepth {
+		g.populateRequired(msg, depth)
+		return
+	}
+
+	md := msg.Descriptor()
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			continue
+		}
+		g.populateField(msg, fd, depth)
+	}
+
+	oneofs := md.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() {
+			continue
+		}
+		// members that are messages exceeding the depth limit are not
+		// selected, so that recursive definitions always terminate.
+		candidates := []protoreflect.FieldDescriptor{}
+		for j := 0; j < oneof.Fields().Len(); j++ {
+			if fd := oneof.Fields().Get(j); fd.Message() == nil || depth < g.maxDepth {
+				candidates = append(candidates, fd)
+			}
+		}
+		if len(candidates) > 0 {
+			g.populateField(msg, candidates[g.random.Intn(len(candidates))], depth)
+		}
+	}
+}
+
+// populateRequired sets random values to the required fields of the given
+// message, which is beyond the maximum depth. Types that are already being
+// populated further up are left empty, as a cycle of required fields cannot
+// be satisfied by any message.
+func (g *Generator) populateRequired(msg protoreflect.Message, depth int) {
+
+	name := msg.Descriptor().FullName()
+	if g.required[name] {
+		return
+	}
+	g.required[name] = true
+	defer delete(g.required, name)
+
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); fd.Cardinality() == protoreflect.Required {
+			g.populateField(msg, fd, depth)
+		}
+	}
+}
+
+// populateField sets a random value to the given field of the message.
+func (g *Generator) populateField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, depth int) {
+
+	isMessage := fd.Message() != nil && !fd.IsMap()
+	if fd.IsMap() {
+		isMessage = fd.MapValue().Message() != nil
+	}
+	if isMessage && depth >= g.maxDepth && fd.Cardinality() != protoreflect.Required {
+		return
+	}
+
+	switch {
+	case fd.IsList():
+		list := msg.Mutable(fd).List()
+		for n := g.random.Intn(maxElements) + 1; n > 0; n-- {
+			list.Append(g.value(list.NewElement, fd, depth))
+		}
+	case fd.IsMap():
+		entries := msg.Mutable(fd).Map()
+		for n := g.random.Intn(maxElements) + 1; n > 0; n-- {
+			key := g.value(nil, fd.MapKey(), depth).MapKey()
+			entries.Set(key, g.value(entries.NewValue, fd.MapValue(), depth))
+		}
+	default:
+		msg.Set(fd, g.value(func() protoreflect.Value { return msg.NewField(fd) }, fd, depth))
+	}
+}
+
+// value produces a random value for the given field. For message fields
+// the `newValue` function is used to create the message to populate.
+func (g *Generator) value(newValue func() protoreflect.Value, fd protoreflect.FieldDescriptor, depth int) protoreflect.Value {
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(g.random.Intn(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(g.random.Intn(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(g.random.Uint32()))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(g.random.Uint32())
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(int64(g.random.Uint64()))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(g.random.Uint64())
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(g.random.NormFloat64() * 1000))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(g.random.NormFloat64() * 1000000)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(g.text(g.random.Intn(16) + 1))
+	case protoreflect.BytesKind:
+		data := make([]byte, g.random.Intn(16)+1)
+		g.random.Read(data)
+		return protoreflect.ValueOfBytes(data)
+	default:
+		value := newValue()
+		g.populate(value.Message(), depth+1)
+		return value
+	}
+}
+
+// populateWellKnown populates the well known types whose fields are subject
+// to constraints that random values would not satisfy. The method returns
+// `false` for any other message type.
+func (g *Generator) populateWellKnown(msg protoreflect.Message) bool {
+
+	fields := msg.Descriptor().Fields()
+	switch msg.Descriptor().FullName() {
+	case "google.protobuf.Timestamp":
+		// between 1970-01-01 and 2100-01-01
+		msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(g.random.Int63n(4102444800)))
+		msg.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(g.random.Int31n(1000000000)))
+	case "google.protobuf.Duration":
+		seconds := g.random.Int63n(2*86400) - 86400
+		nanos := g.random.Int31n(1000000000)
+		if seconds < 0 {
+			nanos = -nanos
+		}
+		msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(seconds))
+		msg.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(nanos))
+	case "google.protobuf.FieldMask":
+		paths := msg.Mutable(fields.ByName("paths")).List()
+		for n := g.random.Intn(maxElements) + 1; n > 0; n-- {
+			paths.Append(protoreflect.ValueOfString(g.identifier()))
+		}
+	case "google.protobuf.Any":
+		// an Any must reference a resolvable type, the timestamp is linked
+		// in the executable and can always be resolved.
+		msg.Set(fields.ByName("type_url"), protoreflect.ValueOfString("type.googleapis.com/google.protobuf.Timestamp"))
+		msg.Set(fields.ByName("value"), protoreflect.ValueOfBytes([]byte{}))
+	case "google.protobuf.Value":
+		// the value is limited to scalars, to avoid unbounded nesting.
+		switch g.random.Intn(3) {
+		case 0:
+			msg.Set(fields.ByName("string_value"), protoreflect.ValueOfString(g.text(8)))
+		case 1:
+			msg.Set(fields.ByName("number_value"), protoreflect.ValueOfFloat64(math.Round(g.random.NormFloat64()*1000)))
+		default:
+			msg.Set(fields.ByName("bool_value"), protoreflect.ValueOfBool(g.random.Intn(2) == 1))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// text produces a random string of the given length.
+func (g *Generator) text(length int) string {
+
+	buffer := make([]byte, length)
+	for i := range buffer {
+		buffer[i] = alphabet[g.random.Intn(len(alphabet))]
+	}
+	return string(buffer)
+}
+
+// identifier produces a random lowercase identifier.
+func (g *Generator) identifier() string {
+
+	buffer := make([]byte, g.random.Intn(8)+1)
+	for i := range buffer {
+		buffer[i] = alphabet[g.random.Intn(26)]
+	}
+	return string(buffer)
+}
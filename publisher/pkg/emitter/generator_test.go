@@ -0,0 +1,95 @@
+package publisher
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// proto2Schema builds a proto2 schema declaring:
+//
+//	message Node { optional Node next = 1; required Leaf leaf = 2; }
+//	message Leaf { required int32 id = 1; optional Node node = 2; }
+//	message Loop { required Loop self = 1; }
+func proto2Schema(t *testing.T) protoreflect.FileDescriptor {
+
+	t.Helper()
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		fdp := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Label: label.Enum(), Type: kind.Enum()}
+		if len(typeName) > 0 {
+			fdp.TypeName = proto.String(typeName)
+		}
+		return fdp
+	}
+	optional, required := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("generator/test.proto"),
+		Package: proto.String("generator.test"),
+		Syntax:  proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Node"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("next", 1, optional, message, ".generator.test.Node"),
+				field("leaf", 2, required, message, ".generator.test.Leaf"),
+			}},
+			{Name: proto.String("Leaf"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, required, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				field("node", 2, optional, message, ".generator.test.Node"),
+			}},
+			{Name: proto.String("Loop"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("self", 1, required, message, ".generator.test.Loop"),
+			}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return file
+}
+
+func TestGenerateRequiredBeyondMaxDepth(t *testing.T) {
+
+	node := proto2Schema(t).Messages().ByName("Node")
+	for depth := 1; depth <= 3; depth++ {
+		msg := NewGenerator(42, depth).Generate(node)
+		if _, err := proto.Marshal(msg); err != nil {
+			t.Errorf("max depth %d: generated message cannot be marshalled: %v", depth, err)
+		}
+	}
+}
+
+func TestGenerateRequiredCycleTerminates(t *testing.T) {
+
+	loop := proto2Schema(t).Messages().ByName("Loop")
+	msg := NewGenerator(42, 2).Generate(loop)
+
+	// a cycle of required fields cannot be satisfied, the generation must
+	// terminate nonetheless.
+	depth := 0
+	for current := msg.ProtoReflect(); current.Has(current.Descriptor().Fields().ByName("self")); depth++ {
+		current = current.Get(current.Descriptor().Fields().ByName("self")).Message()
+	}
+	if depth == 0 || depth > 3 {
+		t.Errorf("unexpected nesting of the required cycle: %d", depth)
+	}
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+
+	node := proto2Schema(t).Messages().ByName("Node")
+	first, err := proto.MarshalOptions{Deterministic: true}.Marshal(NewGenerator(7, 3).Generate(node))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := proto.MarshalOptions{Deterministic: true}.Marshal(NewGenerator(7, 3).Generate(node))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("generators with the same seed produced different messages")
+	}
+}
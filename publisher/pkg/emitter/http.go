@@ -0,0 +1,159 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"publisher/pkg/logging"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// Modes supported by the HTTP sink for the transport of cloud events.
+const (
+	// ModeStructured sends the cloud event as JSON document in the body
+	// of the request (`application/cloudevents+json`).
+	ModeStructured = "structured"
+	// ModeBinary sends the attributes of the cloud event as `ce-` headers
+	// and the protobuf binary as body of the request.
+	ModeBinary = "binary"
+)
+
+// Delivery reports the outcome of the delivery of a record to the endpoint
+// of an HTTP sink.
+type Delivery struct {
+	// Status is the status code of the last response received, or zero
+	// when no response has been received.
+	Status int
+	// Attempts is the number of requests sent to deliver the record.
+	Attempts int
+	// Err is the error of the last attempt, if any.
+	Err error
+}
+
+// HTTPSink sends each record to an endpoint with a POST request. Cloud
+// events are sent in structured or binary mode, any other record is sent
+// as body with its content type. Requests that fail or receive
+// a 5xx or 429 response are retried, waiting between attempts for a delay
+// that doubles at each retry. The outcome of each delivery is recorded.
+type HTTPSink struct {
+	endpoint string
+	mode     string
+	// Client is the HTTP client used to send the requests.
+	Client *http.Client
+	// Retries is the number of attempts made after the first one fails.
+	Retries int
+	// Backoff is the delay before the first retry.
+	Backoff time.Duration
+	// Deliveries records the outcome of the delivery of each record,
+	// in the order in which records are written.
+	Deliveries []Delivery
+}
+
+// NewHTTPSink creates a sink posting the records to the given endpoint and
+// sending cloud events in the given mode (ModeStructured or ModeBinary).
+func NewHTTPSink(endpoint string, mode string, retries int) (*HTTPSink, error) {
+
+	if len(endpoint) == 0 {
+		return nil, fmt.Errorf("the HTTP sink requires an endpoint")
+	}
+	if mode != ModeStructured && mode != ModeBinary {
+		return nil, fmt.Errorf("unknown HTTP mode: '%s' (expected %s or %s)", mode, ModeStructured, ModeBinary)
+	}
+	return &HTTPSink{
+		endpoint: endpoint,
+		mode:     mode,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		Retries:  retries,
+		Backoff:  500 * time.Millisecond,
+	}, nil
+}
+
+// Write posts the record to the endpoint, retrying failed requests. The
+// method returns an error if the record could not be delivered.
+func (s *HTTPSink) Write(record Record) error {
+
+	delivery := Delivery{}
+	delay := s.Backoff
+	for {
+		delivery.Attempts++
+		delivery.Status, delivery.Err = s.post(record)
+		logging.SugarLog.Infof("Posted record (endpoint: %s, attempt: %d, status: %d)", s.endpoint, delivery.Attempts, delivery.Status)
+
+		if !isRetryable(delivery.Status, delivery.Err) || delivery.Attempts > s.Retries {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	s.Deliveries = append(s.Deliveries, delivery)
+	if delivery.Err != nil {
+		return fmt.Errorf("could not deliver record to %s after %d attempt(s): %v", s.endpoint, delivery.Attempts, delivery.Err)
+	}
+	return nil
+}
+
+// Close releases the idle connections of the client.
+func (s *HTTPSink) Close() error {
+
+	s.Client.CloseIdleConnections()
+	return nil
+}
+
+// post sends a single request carrying the record, and returns the status
+// code of the response. Responses with a status other than 2xx produce an
+// error.
+func (s *HTTPSink) post(record Record) (int, error) {
+
+	request, err := http.NewRequest(http.MethodPost, s.endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case record.Event != nil && s.mode == ModeBinary:
+		err = cehttp.WriteRequest(context.Background(), binding.ToMessage(record.Event), request)
+		if err != nil {
+			return 0, err
+		}
+	default:
+		setBody(request, record.Data, record.ContentType)
+	}
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// setBody sets the body of the request and its content type.
+func setBody(request *http.Request, data []byte, contentType string) {
+
+	request.Body = io.NopCloser(bytes.NewReader(data))
+	request.ContentLength = int64(len(data))
+	request.Header.Set("Content-Type", contentType)
+}
+
+// isRetryable determines whether a request that completed with the given
+// status code and error should be retried: requests that received no
+// response, server errors and throttled requests are retried.
+func isRetryable(status int, err error) bool {
+
+	if err == nil {
+		return false
+	}
+	return status == 0 || status >= 500 || status == http.StatusTooManyRequests
+}
@@ -0,0 +1,223 @@
+package publisher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// testSchemaURI is the schema URI referenced by the events emitted in tests.
+const testSchemaURI = "file:///schemas/root.pb"
+
+// receivedRequest is a request received by the test receiver.
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a stand-in endpoint recording the requests it receives, and
+// replying with the statuses given (the last one is repeated).
+type receiver struct {
+	lock     sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+// newReceiver starts a test server replying with the given statuses.
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+
+	r := &receiver{statuses: statuses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.requests = append(r.requests, receivedRequest{header: request.Header.Clone(), body: body})
+		status := r.statuses[len(r.statuses)-1]
+		if len(r.requests) <= len(r.statuses) {
+			status = r.statuses[len(r.requests)-1]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+// newTestSink creates an HTTP sink posting to the given server without
+// waiting between retries.
+func newTestSink(t *testing.T, server *httptest.Server, mode string, retries int) *HTTPSink {
+
+	t.Helper()
+	sink, err := NewHTTPSink(server.URL, mode, retries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Backoff = time.Millisecond
+	return sink
+}
+
+// emitSample emits a simple message to the sink in the given format.
+func emitSample(sink Sink, format string) error {
+
+	return Emit(sink, "SimpleMessage", testSchemaURI, []protoreflect.ProtoMessage{newSimpleMessage()}, format)
+}
+
+// expectSample fails the test if the given binary is not the simple message.
+func expectSample(t *testing.T, data []byte) {
+
+	t.Helper()
+	decoded := &events.SimpleMessage{}
+	if err := proto.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("invalid protobuf binary: %v", err)
+	}
+	if !proto.Equal(decoded, newSimpleMessage()) {
+		t.Errorf("unexpected message: %v", decoded)
+	}
+}
+
+func TestHTTPSinkStructuredMode(t *testing.T) {
+
+	r, server := newReceiver(t, http.StatusAccepted)
+	sink := newTestSink(t, server, ModeStructured, 0)
+	if err := emitSample(sink, FormatCloudEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(r.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(r.requests))
+	}
+	request := r.requests[0]
+	if contentType := request.header.Get("Content-Type"); contentType != "application/cloudevents+json" {
+		t.Errorf("unexpected content type: %s", contentType)
+	}
+	for name := range request.header {
+		if strings.HasPrefix(strings.ToLower(name), "ce-") {
+			t.Errorf("unexpected binary mode header in structured mode: %s", name)
+		}
+	}
+
+	event := map[string]interface{}{}
+	if err := json.Unmarshal(request.body, &event); err != nil {
+		t.Fatalf("invalid structured event: %v", err)
+	}
+	if event["specversion"] != "1.0" || event["dataschema"] != testSchemaURI+"#SimpleMessage" {
+		t.Errorf("unexpected attributes: %v", event)
+	}
+	data, err := base64.StdEncoding.DecodeString(event["data_base64"].(string))
+	if err != nil {
+		t.Fatalf("invalid data_base64: %v", err)
+	}
+	expectSample(t, data)
+	if sink.Deliveries[0].Status != http.StatusAccepted || sink.Deliveries[0].Attempts != 1 {
+		t.Errorf("unexpected delivery: %+v", sink.Deliveries[0])
+	}
+}
+
+func TestHTTPSinkBinaryMode(t *testing.T) {
+
+	r, server := newReceiver(t, http.StatusOK)
+	sink := newTestSink(t, server, ModeBinary, 0)
+	if err := emitSample(sink, FormatCloudEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(r.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(r.requests))
+	}
+	header := r.requests[0].header
+	if contentType := header.Get("Content-Type"); contentType != "application/protobuf" {
+		t.Errorf("unexpected content type: %s", contentType)
+	}
+	if header.Get("Ce-Specversion") != "1.0" || len(header.Get("Ce-Id")) == 0 || header.Get("Ce-Source") != EventSource {
+		t.Errorf("missing context attributes: %v", header)
+	}
+	if dataschema := header.Get("Ce-Dataschema"); dataschema != testSchemaURI+"#SimpleMessage" {
+		t.Errorf("unexpected dataschema: %s", dataschema)
+	}
+	expectSample(t, r.requests[0].body)
+}
+
+func TestHTTPSinkRawRecords(t *testing.T) {
+
+	r, server := newReceiver(t, http.StatusOK)
+	sink := newTestSink(t, server, ModeBinary, 0)
+	if err := emitSample(sink, FormatRaw); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := r.requests[0].header
+	if contentType := header.Get("Content-Type"); contentType != "application/protobuf" {
+		t.Errorf("unexpected content type: %s", contentType)
+	}
+	if len(header.Get("Ce-Id")) > 0 {
+		t.Errorf("unexpected context attributes for a raw record: %v", header)
+	}
+	expectSample(t, r.requests[0].body)
+}
+
+func TestHTTPSinkClientErrorIsNotRetried(t *testing.T) {
+
+	r, server := newReceiver(t, http.StatusBadRequest)
+	sink := newTestSink(t, server, ModeStructured, 3)
+
+	err := emitSample(sink, FormatCloudEvent)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected the status to be reported, got: %v", err)
+	}
+	if len(r.requests) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(r.requests))
+	}
+	if delivery := sink.Deliveries[0]; delivery.Status != http.StatusBadRequest || delivery.Attempts != 1 || delivery.Err == nil {
+		t.Errorf("unexpected delivery: %+v", delivery)
+	}
+}
+
+func TestHTTPSinkRetriesServerErrors(t *testing.T) {
+
+	r, server := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusCreated)
+	sink := newTestSink(t, server, ModeStructured, 3)
+
+	if err := emitSample(sink, FormatCloudEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.requests) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(r.requests))
+	}
+	if delivery := sink.Deliveries[0]; delivery.Status != http.StatusCreated || delivery.Attempts != 3 || delivery.Err != nil {
+		t.Errorf("unexpected delivery: %+v", delivery)
+	}
+}
+
+func TestHTTPSinkRetriesExhausted(t *testing.T) {
+
+	r, server := newReceiver(t, http.StatusInternalServerError)
+	sink := newTestSink(t, server, ModeBinary, 2)
+
+	err := emitSample(sink, FormatCloudEvent)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempt(s)") {
+		t.Fatalf("expected the failure to be reported, got: %v", err)
+	}
+	if len(r.requests) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(r.requests))
+	}
+}
+
+func TestNewHTTPSinkValidation(t *testing.T) {
+
+	if _, err := NewHTTPSink("", ModeStructured, 0); err == nil {
+		t.Errorf("expected an error without endpoint")
+	}
+	if _, err := NewHTTPSink("http://localhost", "chunked", 0); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,27 @@
+package publisher
+
+import (
+	"time"
+
+	"publisher/pkg/pubsub"
+
+	proto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// PubSubSchema identifies the Pub/Sub schema (name, revision and encoding)
+// set as attributes of the messages emitted with `FormatPubSub`.
+var PubSubSchema = pubsub.Schema{Encoding: pubsub.EncodingBinary}
+
+// newPubSubMessage wraps the given message into a Pub/Sub message, whose
+// data is encoded as specified by PubSubSchema.
+func newPubSubMessage(message protoreflect.ProtoMessage) (*pubsub.Message, error) {
+
+	wrapper, err := pubsub.Marshal(message, PubSubSchema, proto.MarshalOptions{Deterministic: Deterministic})
+	if err != nil {
+		return nil, err
+	}
+	wrapper.MessageID = IDGenerator()
+	wrapper.PublishTime = Clock().UTC().Format(time.RFC3339Nano)
+	return wrapper, nil
+}
@@ -0,0 +1,262 @@
+package publisher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"publisher/pkg/envelope"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Record is the unit of content delivered to a sink: the serialised form
+// of a single message, and the cloud event wrapping it when the message
+// is emitted as a cloud event.
+type Record struct {
+	// Data is the serialised record: the JSON representation of the
+	// cloud event or Pub/Sub message, the protobuf binary of the
+	// message, or the binary prefixed by its size for delimited records.
+	Data []byte
+	// ContentType is the media type of the data.
+	ContentType string
+	// Event is the cloud event wrapping the message, or nil when the
+	// message is emitted as a raw protobuf binary.
+	Event *cloudevents.Event
+}
+
+// isJSON determines whether the data of the record is a JSON document.
+func (r Record) isJSON() bool {
+
+	return strings.HasSuffix(r.ContentType, "json")
+}
+
+// Sink is the destination of the records produced by the emitter. Sinks
+// receive the records one at a time, and are closed once all the records
+// have been emitted, which flushes any buffered content.
+type Sink interface {
+	// Write delivers the given record to the destination.
+	Write(record Record) error
+	// Close flushes any pending content and releases the resources
+	// held by the sink.
+	Close() error
+}
+
+// Emit serialises the given messages according to the format and delivers
+// them to the sink one record at a time. With `FormatCloudEvent` each
+// message is wrapped into a cloud event whose `dataschema` references the
+// schema, with `FormatPubSub` into a Pub/Sub message, with `FormatRaw`
+// each record is the protobuf binary and with `FormatDelimited` the binary
+// is prefixed by its size encoded as varint. Any other format is the name of
+// a registered envelope, which wraps each message into a record. The sink is
+// not closed, which is left to the caller.
+func Emit(sink Sink, messageType string, schemaURI string, messages []protoreflect.ProtoMessage, format string) error {
+
+	if _, err := envelope.Lookup(format); err != nil && format != FormatPubSub {
+		return unknownFormat(format)
+	}
+
+	for _, message := range messages {
+
+		buffer, err := marshal(message)
+		if err != nil {
+			return err
+		}
+
+		record := Record{Data: buffer, ContentType: "application/protobuf"}
+		switch format {
+		case FormatCloudEvent:
+			ce, err := newCloudEvent(messageType, schemaURI, message, buffer)
+			if err != nil {
+				return err
+			}
+			record.Event = &ce
+			record.ContentType = "application/cloudevents+json"
+			record.Data, err = marshalJSON(ce)
+			if err != nil {
+				return err
+			}
+		case FormatPubSub:
+			wrapper, err := newPubSubMessage(message)
+			if err != nil {
+				return err
+			}
+			record.ContentType = "application/json"
+			record.Data, err = marshalJSON(wrapper)
+			if err != nil {
+				return err
+			}
+		case FormatDelimited:
+			record.Data = append(protowire.AppendVarint(nil, uint64(len(buffer))), buffer...)
+		case FormatRaw:
+		default:
+			record.Data, err = wrap(format, messageType, schemaURI, []protoreflect.ProtoMessage{message})
+			if err != nil {
+				return err
+			}
+			if json.Valid(record.Data) {
+				record.ContentType = "application/json"
+			}
+		}
+
+		err = sink.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriterSink writes the records to a stream (e.g. the standard output).
+// JSON records are written one per line (newline delimited JSON), while
+// binary records are written as they are.
+type WriterSink struct {
+	writer *bufio.Writer
+}
+
+// NewWriterSink creates a sink writing the records to the given writer.
+func NewWriterSink(writer io.Writer) *WriterSink {
+
+	return &WriterSink{writer: bufio.NewWriter(writer)}
+}
+
+// NewStdoutSink creates a sink writing the records to the standard output.
+func NewStdoutSink() *WriterSink {
+
+	return NewWriterSink(os.Stdout)
+}
+
+// Write writes the record to the stream.
+func (s *WriterSink) Write(record Record) error {
+
+	_, err := s.writer.Write(record.Data)
+	if err == nil && record.isJSON() {
+		err = s.writer.WriteByte('\n')
+	}
+	return err
+}
+
+// Close flushes the content buffered by the sink.
+func (s *WriterSink) Close() error {
+
+	return s.writer.Flush()
+}
+
+// DirectorySink appends the records to files created in a directory, and
+// rotates to a new file when the current one reaches the maximum number
+// of records or the maximum size. Files are named after the prefix and
+// a sequence number (e.g. `events-0001.json`). JSON records are written
+// one per line (newline delimited JSON), while binary records are written
+// as they are: rotating raw binaries with a maximum count of one record
+// produces a file per message, while delimited records can share a file.
+type DirectorySink struct {
+	directory string
+	prefix    string
+	extension string
+	// MaxCount is the maximum number of records written to a file,
+	// zero or negative values remove the limit.
+	MaxCount int
+	// MaxSize is the maximum size in bytes of a file, zero or negative
+	// values remove the limit. A file always holds at least one record,
+	// hence it exceeds the limit when a single record is larger.
+	MaxSize int64
+
+	file  *os.File
+	index int
+	count int
+	size  int64
+}
+
+// NewDirectorySink creates a sink writing the records to files in the given
+// directory (created if it does not exist), whose names are composed by the
+// prefix, the sequence number of the file and the extension.
+func NewDirectorySink(directory string, prefix string, extension string, maxCount int, maxSize int64) (*DirectorySink, error) {
+
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &DirectorySink{
+		directory: directory,
+		prefix:    prefix,
+		extension: extension,
+		MaxCount:  maxCount,
+		MaxSize:   maxSize,
+	}, nil
+}
+
+// Write appends the record to the current file, rotating the file first
+// if the record would exceed the limits configured.
+func (s *DirectorySink) Write(record Record) error {
+
+	data := record.Data
+	if record.isJSON() {
+		data = append(append([]byte{}, data...), '\n')
+	}
+
+	if s.file == nil || s.isFull(int64(len(data))) {
+		err := s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	written, err := s.file.Write(data)
+	s.count++
+	s.size += int64(written)
+	return err
+}
+
+// Close closes the current file.
+func (s *DirectorySink) Close() error {
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Files returns the number of files created by the sink.
+func (s *DirectorySink) Files() int {
+
+	return s.index
+}
+
+// isFull determines whether the current file cannot accept a record of
+// the given size.
+func (s *DirectorySink) isFull(size int64) bool {
+
+	if s.MaxCount > 0 && s.count >= s.MaxCount {
+		return true
+	}
+	return s.MaxSize > 0 && s.count > 0 && s.size+size > s.MaxSize
+}
+
+// rotate closes the current file and creates the next one.
+func (s *DirectorySink) rotate() error {
+
+	err := s.Close()
+	if err != nil {
+		return err
+	}
+
+	s.index++
+	path := filepath.Join(s.directory, fmt.Sprintf("%s-%04d%s", s.prefix, s.index, s.extension))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+
+	s.file = file
+	s.count = 0
+	s.size = 0
+	return nil
+}
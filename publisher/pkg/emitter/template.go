@@ -0,0 +1,183 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Template formats supported for the definition of messages.
+const (
+	// TemplateJSON identifies templates rendering the JSON
+	// representation of a message.
+	TemplateJSON = "json"
+	// TemplateText identifies templates rendering the text
+	// representation (prototext) of a message.
+	TemplateText = "prototext"
+)
+
+// Template renders the content of messages from a text template written
+// in JSON or prototext format. The template can use the placeholders and
+// functions of the Go `text/template` package, together with functions
+// that produce content varying across the messages rendered:
+//
+//   - `{{ seq }}`: sequence number of the message being rendered (from 1)
+//   - `{{ next "name" }}`: value of the named counter, incremented at each use
+//   - `{{ uuid }}`: identifier produced by the IDGenerator (random UUID by default)
+//   - `{{ now }}`: time produced by the Clock in RFC 3339 format
+//   - `{{ timestamp "-1h" }}`: current time shifted by the given duration
+//   - `{{ choice "a" "b" "c" }}`: random choice among the given values
+//   - `{{ randInt 1 100 }}`: random integer in the given (inclusive) range
+//   - `{{ env "NAME" }}`: value of the given environment variable
+//   - `{{ json . }}`: value quoted and escaped as JSON string
+type Template struct {
+	template *template.Template
+	format   string
+	random   *rand.Rand
+	sequence int
+	counters map[string]int
+}
+
+// NewTemplate parses the given template text, which renders messages in
+// the given format (TemplateJSON or TemplateText). The seed initialises
+// the random choices made by the template.
+func NewTemplate(text string, format string, seed int64) (*Template, error) {
+
+	if format != TemplateJSON && format != TemplateText {
+		return nil, fmt.Errorf("unknown template format: '%s' (expected %s or %s)", format, TemplateJSON, TemplateText)
+	}
+
+	t := &Template{
+		format:   format,
+		random:   rand.New(rand.NewSource(seed)),
+		counters: map[string]int{},
+	}
+
+	parsed, err := template.New("message").Funcs(template.FuncMap{
+		"seq":       func() int { return t.sequence },
+		"next":      t.next,
+		"uuid":      func() string { return IDGenerator() },
+		"now":       func() string { return Clock().UTC().Format(time.RFC3339Nano) },
+		"timestamp": timestamp,
+		"choice":    t.choice,
+		"randInt":   t.randInt,
+		"env":       os.Getenv,
+		"json":      quote,
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	t.template = parsed
+	return t, nil
+}
+
+// LoadTemplate reads the template stored in the file pointed by `path`.
+// The format is inferred from the extension of the file: `.json` files
+// are interpreted as JSON templates, any other file as prototext.
+func LoadTemplate(path string, seed int64) (*Template, error) {
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := TemplateText
+	if filepath.Ext(path) == ".json" {
+		format = TemplateJSON
+	}
+	return NewTemplate(string(text), format, seed)
+}
+
+// Render renders the template once and unmarshals the result into a dynamic
+// message of the type identified by `md`. Each invocation advances the
+// sequence number of the template.
+func (t *Template) Render(md protoreflect.MessageDescriptor) (*dynamicpb.Message, error) {
+
+	t.sequence++
+
+	buffer := bytes.Buffer{}
+	err := t.template.Execute(&buffer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if t.format == TemplateJSON {
+		err = protojson.Unmarshal(buffer.Bytes(), msg)
+	} else {
+		err = prototext.Unmarshal(buffer.Bytes(), msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rendered message %d is not valid: %v", t.sequence, err)
+	}
+	return msg, nil
+}
+
+// RenderMessages renders the template `count` times into messages of the
+// type identified by `md`.
+func (t *Template) RenderMessages(md protoreflect.MessageDescriptor, count int) ([]protoreflect.ProtoMessage, error) {
+
+	messages := []protoreflect.ProtoMessage{}
+	for i := 0; i < count; i++ {
+		msg, err := t.Render(md)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// next increments and returns the value of the named counter.
+func (t *Template) next(name string) int {
+
+	t.counters[name]++
+	return t.counters[name]
+}
+
+// choice returns one of the given values at random.
+func (t *Template) choice(values ...interface{}) (interface{}, error) {
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("choice requires at least one value")
+	}
+	return values[t.random.Intn(len(values))], nil
+}
+
+// randInt returns a random integer between `min` and `max` (inclusive).
+func (t *Template) randInt(min int, max int) (int, error) {
+
+	if max < min {
+		return 0, fmt.Errorf("randInt requires min (%d) <= max (%d)", min, max)
+	}
+	return min + t.random.Intn(max-min+1), nil
+}
+
+// timestamp returns the current time shifted by the given duration, in
+// RFC 3339 format.
+func timestamp(offset string) (string, error) {
+
+	duration, err := time.ParseDuration(offset)
+	if err != nil {
+		return "", err
+	}
+	return Clock().Add(duration).UTC().Format(time.RFC3339Nano), nil
+}
+
+// quote renders the given value as a JSON string, including the quotes.
+func quote(value interface{}) (string, error) {
+
+	data, err := json.Marshal(fmt.Sprint(value))
+	return string(data), err
+}
@@ -0,0 +1,202 @@
+package publisher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// withFixedContext replaces the clock and the identifier generator for the
+// duration of the test.
+func withFixedContext(t *testing.T, now time.Time) {
+
+	t.Helper()
+	clock, generator := Clock, IDGenerator
+	t.Cleanup(func() { Clock, IDGenerator = clock, generator })
+	Clock = func() time.Time { return now }
+	IDGenerator = SequentialIDGenerator("template")
+}
+
+// render renders the template `count` times into simple messages.
+func render(t *testing.T, template *Template, count int) []*events.SimpleMessage {
+
+	t.Helper()
+	md := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	rendered, err := template.RenderMessages(md, count)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	messages := []*events.SimpleMessage{}
+	for _, message := range rendered {
+		data, err := proto.Marshal(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		simple := &events.SimpleMessage{}
+		if err := proto.Unmarshal(data, simple); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, simple)
+	}
+	return messages
+}
+
+func TestTemplateSequenceAndCounters(t *testing.T) {
+
+	template, err := NewTemplate(`{"param_04": {{ seq }}, "param_05": "{{ next "a" }}", "param_06": {{ next "a" }}, "param_07": "{{ next "b" }}"}`, TemplateJSON, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sequence advances once per message, each counter at each use.
+	expected := [][]int64{{1, 1, 2, 1}, {2, 3, 4, 2}, {3, 5, 6, 3}}
+	for i, message := range render(t, template, 3) {
+		actual := []int64{int64(message.Param_04), message.Param_05, int64(message.Param_06), int64(message.Param_07)}
+		for j := range actual {
+			if actual[j] != expected[i][j] {
+				t.Errorf("unexpected values of message %d: %v", i+1, actual)
+				break
+			}
+		}
+	}
+}
+
+func TestTemplateIdentifiersAndTime(t *testing.T) {
+
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	withFixedContext(t, now)
+
+	template, err := NewTemplate(`param_01: "{{ uuid }}" param_02: true`+"\n"+`param_03: "{{ now }}|{{ timestamp "-1h30m" }}"`, TemplateText, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedIDs := SequentialIDGenerator("template")
+	for _, message := range render(t, template, 2) {
+		if message.Param_01 != expectedIDs() {
+			t.Errorf("unexpected identifier: %s", message.Param_01)
+		}
+		if string(message.Param_03) != "2021-03-04T05:06:07Z|2021-03-04T03:36:07Z" {
+			t.Errorf("unexpected times: %s", message.Param_03)
+		}
+	}
+
+	// invalid offsets are reported when rendering.
+	template, err = NewTemplate(`param_01: "{{ timestamp "yesterday" }}"`, TemplateText, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.Render((&events.SimpleMessage{}).ProtoReflect().Descriptor()); err == nil {
+		t.Errorf("expected the invalid duration to be rejected")
+	}
+}
+
+func TestTemplateChoiceAndRandInt(t *testing.T) {
+
+	template, err := NewTemplate(`{"param_01": {{ json (choice "a" "b" "c") }}, "param_04": {{ randInt -2 2 }}}`, TemplateJSON, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	choices, numbers := map[string]int{}, map[int32]int{}
+	for _, message := range render(t, template, 200) {
+		choices[message.Param_01]++
+		numbers[message.Param_04]++
+	}
+	if len(choices) != 3 || choices["a"] == 0 || choices["b"] == 0 || choices["c"] == 0 {
+		t.Errorf("unexpected choices: %v", choices)
+	}
+	// the range is inclusive.
+	if len(numbers) != 5 || numbers[-2] == 0 || numbers[2] == 0 {
+		t.Errorf("unexpected numbers: %v", numbers)
+	}
+
+	md := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	for text, message := range map[string]string{
+		`{"param_04": {{ randInt 3 1 }}}`: "randInt requires min (3) <= max (1)",
+		`{"param_01": "{{ choice }}"}`:    "choice requires at least one value",
+	} {
+		template, err := NewTemplate(text, TemplateJSON, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := template.Render(md); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected %q, got: %v", message, err)
+		}
+	}
+}
+
+func TestTemplateSeededReproducibility(t *testing.T) {
+
+	text := `{"param_01": {{ json (choice "a" "b" "c" "d" "e") }}, "param_05": "{{ randInt 0 1000000 }}"}`
+	renderAll := func(seed int64) []string {
+		template, err := NewTemplate(text, TemplateJSON, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := []string{}
+		for _, message := range render(t, template, 20) {
+			values = append(values, message.String())
+		}
+		return values
+	}
+
+	first, second := renderAll(42), renderAll(42)
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Errorf("the same seed rendered different messages:\n%v\n%v", first, second)
+	}
+	if strings.Join(first, "\n") == strings.Join(renderAll(43), "\n") {
+		t.Errorf("different seeds rendered the same messages")
+	}
+}
+
+func TestTemplateInvalidOutputAndFormat(t *testing.T) {
+
+	if _, err := NewTemplate(`{}`, "yaml", 1); err == nil || !strings.Contains(err.Error(), "unknown template format") {
+		t.Errorf("expected the format to be rejected, got: %v", err)
+	}
+
+	template, err := NewTemplate(`{"param_04": "{{ seq }}x"}`, TemplateJSON, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.Render((&events.SimpleMessage{}).ProtoReflect().Descriptor()); err == nil || !strings.Contains(err.Error(), "rendered message 1 is not valid") {
+		t.Errorf("expected the rendered message to be rejected, got: %v", err)
+	}
+}
+
+func TestLoadTemplateFormatFromExtension(t *testing.T) {
+
+	directory := t.TempDir()
+	for name, text := range map[string]string{
+		"message.json": `{"param_01": "json"}`,
+		"message.txt":  `param_01: "text"`,
+	} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, expected := range map[string]string{"message.json": "json", "message.txt": "text"} {
+		template, err := LoadTemplate(filepath.Join(directory, name), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, err := template.Render((&events.SimpleMessage{}).ProtoReflect().Descriptor())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value := message.Get(message.Descriptor().Fields().ByName("param_01")); value.String() != expected {
+			t.Errorf("unexpected value rendered from %s: %v", name, value)
+		}
+	}
+	if _, err := LoadTemplate(filepath.Join(directory, "missing.json"), 1); err == nil {
+		t.Errorf("expected the missing file to be rejected")
+	}
+}
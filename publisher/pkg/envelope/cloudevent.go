@@ -0,0 +1,166 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// ProtobufContentType is the content type of the protobuf binaries carried
+// by cloud events.
+const ProtobufContentType = "application/protobuf"
+
+// Extension attributes of the cloud events embedding the schema of their
+// payload.
+const (
+	// DescriptorExtension carries the serialised file descriptor set of
+	// the schema, encoded in base64.
+	DescriptorExtension = "schemadescriptor"
+	// DigestExtension carries the digest of the descriptor set.
+	DigestExtension = "schemadigest"
+)
+
+// CloudEventEnvelope wraps the messages into cloud events in structured
+// mode, whose `data_base64` attribute carries the protobuf binary and whose
+// `dataschema` attribute references the schema of the message. A single
+// message is wrapped into an event, multiple messages into a batch (JSON
+// array of events).
+type CloudEventEnvelope struct{}
+
+// Wrap encodes the messages into a cloud event or a batch of events.
+func (e CloudEventEnvelope) Wrap(messages []Message) ([]byte, error) {
+
+	events := []cloudevents.Event{}
+	for _, message := range messages {
+		ce, err := NewEvent(message)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ce)
+	}
+
+	if len(events) == 1 {
+		return json.Marshal(events[0])
+	}
+	return json.Marshal(events)
+}
+
+// Unwrap decodes a cloud event or a batch of events, and returns the
+// payloads of the events. The header of each message is the JSON
+// representation of the event.
+func (e CloudEventEnvelope) Unwrap(data []byte) ([]Message, error) {
+
+	documents := []json.RawMessage{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(trimmed, &documents)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		documents = append(documents, data)
+	}
+
+	messages := []Message{}
+	for _, document := range documents {
+
+		ce := cloudevents.Event{}
+		err := json.Unmarshal(document, &ce)
+		if err != nil {
+			return nil, err
+		}
+		header := map[string]interface{}{}
+		err = json.Unmarshal(document, &header)
+		if err != nil {
+			return nil, err
+		}
+		descriptor, digest, err := EmbeddedSchema(ce)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, Message{Data: ce.Data(), SchemaURI: ce.DataSchema(), Header: header, Descriptor: descriptor, Digest: digest})
+	}
+	return messages, nil
+}
+
+// EmbeddedSchema returns the file descriptor set embedded in the given cloud
+// event and its digest, which are empty when the event does not embed the
+// schema of its payload.
+func EmbeddedSchema(ce cloudevents.Event) ([]byte, string, error) {
+
+	extensions := ce.Extensions()
+	encoded, isPresent := extensions[DescriptorExtension]
+	if !isPresent {
+		return nil, "", nil
+	}
+	descriptor, err := base64.StdEncoding.DecodeString(fmt.Sprint(encoded))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s attribute: %v", DescriptorExtension, err)
+	}
+	digest := ""
+	if value, isPresent := extensions[DigestExtension]; isPresent {
+		digest = fmt.Sprint(value)
+	}
+	return descriptor, digest, nil
+}
+
+// NewEvent creates the cloud event carrying the given message. The `type`
+// of the event is the fragment of the schema URI (the message type), and
+// the attributes in the header of the message are set to the event: `id`,
+// `source`, `subject`, `type` and `time` (as time.Time or RFC 3339 string)
+// are context attributes, any other value is an extension. The schema of
+// the message, when embedded, is carried by the DescriptorExtension and
+// DigestExtension attributes.
+func NewEvent(message Message) (cloudevents.Event, error) {
+
+	ce := cloudevents.NewEvent()
+
+	schemaUrl, err := url.Parse(message.SchemaURI)
+	if err != nil {
+		return ce, err
+	}
+	ce.SetType(schemaUrl.Fragment)
+
+	for name, value := range message.Header {
+		switch name {
+		case "id":
+			ce.SetID(fmt.Sprint(value))
+		case "source":
+			ce.SetSource(fmt.Sprint(value))
+		case "subject":
+			ce.SetSubject(fmt.Sprint(value))
+		case "type":
+			ce.SetType(fmt.Sprint(value))
+		case "time":
+			switch t := value.(type) {
+			case time.Time:
+				ce.SetTime(t)
+			default:
+				parsed, err := time.Parse(time.RFC3339Nano, fmt.Sprint(value))
+				if err != nil {
+					return ce, err
+				}
+				ce.SetTime(parsed)
+			}
+		default:
+			ce.SetExtension(name, value)
+		}
+	}
+
+	if len(message.Descriptor) > 0 {
+		digest := message.Digest
+		if len(digest) == 0 {
+			digest = Digest(message.Descriptor)
+		}
+		ce.SetExtension(DescriptorExtension, base64.StdEncoding.EncodeToString(message.Descriptor))
+		ce.SetExtension(DigestExtension, digest)
+	}
+
+	ce.SetDataSchema(message.SchemaURI)
+	err = ce.SetData(ProtobufContentType, message.Data)
+	return ce, err
+}
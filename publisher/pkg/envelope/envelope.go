@@ -0,0 +1,271 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"publisher/pkg/confluent"
+	"publisher/pkg/grpcframe"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Auto is the name that selects the envelope by sniffing the input.
+const Auto = "auto"
+
+// Message is a protobuf binary carried by an envelope, together with the
+// reference to its schema and the metadata of the envelope.
+type Message struct {
+	// Data is the protobuf binary of the message.
+	Data []byte
+	// SchemaURI is the URI of the schema of the message, with the type
+	// of the message as fragment. Envelopes that do not carry the schema
+	// leave it empty when unwrapping.
+	SchemaURI string
+	// Header contains the metadata of the envelope. When wrapping, it
+	// provides additional attributes (e.g. the `id` of a cloud event),
+	// when unwrapping, it is the JSON representation of the envelope.
+	Header map[string]interface{}
+	// Descriptor is the serialised file descriptor set of the schema of
+	// the message, when the schema is embedded in the envelope, so that
+	// consumers that cannot reach the schema URI can still decode it.
+	Descriptor []byte
+	// Digest is the digest of Descriptor (see Digest), which consumers
+	// verify before using the embedded schema.
+	Digest string
+	// TypeName is the fully qualified name of the message type within
+	// Descriptor. When it is empty, the type is given by the fragment of
+	// the schema URI.
+	TypeName string
+}
+
+// Envelope wraps protobuf binaries for transport and unwraps them when they
+// are consumed. Envelopes are shared by the emitter, which wraps messages,
+// and by the parser, which unwraps them.
+type Envelope interface {
+	// Wrap encodes the given messages into a single document.
+	Wrap(messages []Message) ([]byte, error)
+	// Unwrap decodes the messages carried by the given document.
+	Unwrap(data []byte) ([]Message, error)
+}
+
+// Names of the built-in envelopes.
+const (
+	// Raw is the envelope of a single protobuf binary.
+	Raw = "raw"
+	// CloudEvent is the envelope of cloud events in structured mode,
+	// with a single event or a batch of events (JSON array).
+	CloudEvent = "cloudevent"
+	// Delimited is the envelope of a stream of protobuf binaries, each
+	// prefixed by its size encoded as varint.
+	Delimited = "delimited"
+	// SelfDescribing is the envelope of a single protobuf binary together
+	// with the file descriptor set of its schema.
+	SelfDescribing = "selfdescribing"
+)
+
+// envelopes maps the names of the envelopes to their implementation.
+var envelopes = map[string]Envelope{
+	Raw:            RawEnvelope{},
+	CloudEvent:     CloudEventEnvelope{},
+	Delimited:      DelimitedEnvelope{},
+	SelfDescribing: SelfDescribingEnvelope{},
+}
+
+// lock guards the access to the registered envelopes.
+var lock sync.RWMutex
+
+// Register makes the given envelope available under the given name, to both
+// the emitter and the parser. Registering a name that is already in use
+// replaces the envelope.
+func Register(name string, envelope Envelope) {
+
+	lock.Lock()
+	defer lock.Unlock()
+	envelopes[name] = envelope
+}
+
+// Lookup returns the envelope registered under the given name.
+func Lookup(name string) (Envelope, error) {
+
+	lock.RLock()
+	defer lock.RUnlock()
+	envelope, isPresent := envelopes[name]
+	if !isPresent {
+		return nil, fmt.Errorf("unknown envelope: '%s' (expected %s or %s)", name, Auto, strings.Join(Names(), ", "))
+	}
+	return envelope, nil
+}
+
+// Names returns the names of the registered envelopes, in lexical order.
+func Names() []string {
+
+	lock.RLock()
+	defer lock.RUnlock()
+	names := []string{}
+	for name := range envelopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Detect sniffs the given input and returns the name of the envelope that
+// decodes it, together with the data to unwrap:
+//
+//   - JSON objects and arrays are cloud events (single or batch)
+//   - printable text that is valid base64, and whose bytes do not already
+//     form one of the binaries below, is decoded and sniffed again
+//   - binaries made of the fields of the self-describing wrapper, whose
+//     digest names the hash function, are self-describing messages
+//   - binaries made of gRPC frames carrying valid messages are rejected,
+//     since they are not an envelope (see the grpcframe package)
+//   - binaries framed according to the Confluent wire format are raw
+//     messages, whose framing is stripped by the parser
+//   - binaries that are a valid stream of at least two size-prefixed
+//     messages, or that are not a valid message, are delimited streams
+//   - any other binary is a raw message
+//
+// gRPC frames, Confluent frames and delimited streams whose first message
+// is empty all start with a zero byte: the checks are ordered from the most
+// to the least constrained layout, a gRPC frame declaring the exact size of
+// its payload.
+func Detect(data []byte) (string, []byte, error) {
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return "", nil, errors.New("cannot detect the envelope of an empty input")
+	}
+
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return CloudEvent, data, nil
+	}
+
+	if isText(trimmed) && !isBinary(data) {
+		if decoded, isBase64 := decodeBase64(trimmed); isBase64 {
+			data = decoded
+		}
+	}
+
+	if isSelfDescribing(data) {
+		return SelfDescribing, data, nil
+	}
+
+	if isGRPC(data) {
+		return "", nil, errors.New("the input is a stream of gRPC frames rather than an envelope")
+	}
+	if isConfluent(data) {
+		return Raw, data, nil
+	}
+
+	count, isDelimited := countDelimited(data)
+	if isDelimited && (count > 1 || !isMessage(data)) {
+		return Delimited, data, nil
+	}
+	return Raw, data, nil
+}
+
+// decodeBase64 decodes text in the standard or URL-safe base64 alphabet
+// (with or without padding), ignoring white spaces.
+func decodeBase64(text []byte) ([]byte, bool) {
+
+	compact := bytes.Join(bytes.Fields(text), nil)
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(string(compact)); err == nil {
+			return decoded, true
+		}
+	}
+	return nil, false
+}
+
+// isText determines whether the data is made of printable ASCII characters
+// and white spaces only, as base64 text is.
+func isText(data []byte) bool {
+
+	for _, b := range data {
+		if (b < 0x20 || b > 0x7e) && b != '\t' && b != '\n' && b != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// isBinary determines whether the data already has one of the binary
+// layouts sniffed by Detect, in which case it is not decoded as base64
+// even when it is printable (e.g. a message carrying a single string).
+func isBinary(data []byte) bool {
+
+	if isSelfDescribing(data) || isGRPC(data) || isConfluent(data) || isMessage(data) {
+		return true
+	}
+	_, isDelimited := countDelimited(data)
+	return isDelimited
+}
+
+// isGRPC determines whether the data is a stream of gRPC frames, whose
+// uncompressed messages are valid protobuf binaries.
+func isGRPC(data []byte) bool {
+
+	frames, err := grpcframe.Split(data)
+	if err != nil {
+		return false
+	}
+	for _, frame := range frames {
+		if !frame.Compressed && !frame.Trailer && !isMessage(frame.Payload) {
+			return false
+		}
+	}
+	return true
+}
+
+// isConfluent determines whether the data is a valid protobuf binary framed
+// according to the Confluent wire format.
+func isConfluent(data []byte) bool {
+
+	frame, err := confluent.Decode(data)
+	return err == nil && isMessage(frame.Payload)
+}
+
+// countDelimited determines whether the data is a stream of size-prefixed
+// messages that are valid protobuf binaries, and returns their number.
+func countDelimited(data []byte) (int, bool) {
+
+	count := 0
+	for len(data) > 0 {
+		size, n := protowire.ConsumeVarint(data)
+		if n < 0 || uint64(len(data)-n) < size {
+			return 0, false
+		}
+		if !isMessage(data[n : n+int(size)]) {
+			return 0, false
+		}
+		data = data[n+int(size):]
+		count++
+	}
+	return count, count > 0
+}
+
+// isMessage determines whether the data is a sequence of well formed
+// protobuf fields.
+func isMessage(data []byte) bool {
+
+	for len(data) > 0 {
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 || number < 1 {
+			return false
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(number, kind, data)
+		if n < 0 {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
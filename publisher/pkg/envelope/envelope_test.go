@@ -0,0 +1,246 @@
+package envelope
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"publisher/pkg/confluent"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testSchemaURI is the schema URI of the messages wrapped in the tests.
+const testSchemaURI = "file:///schemas/root.pb#SimpleMessage"
+
+// newMessage returns a protobuf binary with a string (field 1) and a varint
+// (field 2).
+func newMessage(name string, value uint64) []byte {
+
+	data := protowire.AppendTag(nil, 1, protowire.BytesType)
+	data = protowire.AppendString(data, name)
+	data = protowire.AppendTag(data, 2, protowire.VarintType)
+	return protowire.AppendVarint(data, value)
+}
+
+// wrap wraps the given messages with the envelope registered under the name.
+func wrap(t *testing.T, name string, messages ...Message) []byte {
+
+	t.Helper()
+	env, err := Lookup(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := env.Wrap(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// grpcFrame frames the payload as a gRPC message with the given flags.
+func grpcFrame(flags byte, payload []byte) []byte {
+
+	frame := []byte{flags, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// gzipped compresses the given data.
+func gzipped(t *testing.T, data []byte) []byte {
+
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+
+	first := Message{Data: newMessage("first", 1), SchemaURI: testSchemaURI, Header: map[string]interface{}{"id": "1", "source": "test"}}
+	second := Message{Data: newMessage("second", 2), SchemaURI: testSchemaURI, Header: map[string]interface{}{"id": "2", "source": "test"}}
+	embedded := Message{Data: newMessage("first", 1), Descriptor: newMessage("descriptor", 0), TypeName: "test.SimpleMessage"}
+
+	raw := wrap(t, Raw, first)
+	delimited := wrap(t, Delimited, first, second)
+	selfDescribing := wrap(t, SelfDescribing, embedded)
+	framed := confluent.Encode(7, []int{5, 0}, raw)
+
+	// a valid message whose first byte is also the size of the rest, which
+	// is a valid message too: a single size-prefixed message is not enough
+	// to tell a stream from a message.
+	ambiguous := []byte{0x12, 0x11, 1, 2, 3, 4, 5, 6, 7, 8, 0x0a, 0x07, 'a', 'b', 'c', 'd', 'e', 'f', 'g'}
+
+	// a self-describing wrapper whose digest does not name the hash function.
+	undigested := protowire.AppendTag(nil, descriptorSetField, protowire.BytesType)
+	undigested = protowire.AppendBytes(undigested, embedded.Descriptor)
+	undigested = protowire.AppendTag(undigested, messageField, protowire.BytesType)
+	undigested = protowire.AppendBytes(undigested, newMessage("first", 1))
+	undigested = protowire.AppendTag(undigested, descriptorDigestField, protowire.BytesType)
+	undigested = protowire.AppendString(undigested, "md5:0000")
+
+	// a valid message carrying a string of 65 letters, which is printable
+	// and valid base64 text too (without padding).
+	printable := append([]byte{0x0a, 0x41}, []byte(strings.Repeat("a", 65))...)
+
+	for _, test := range []struct {
+		name     string
+		input    []byte
+		envelope string
+		data     []byte
+	}{
+		{"cloud event", wrap(t, CloudEvent, first), CloudEvent, nil},
+		{"cloud event batch", wrap(t, CloudEvent, first, second), CloudEvent, nil},
+		{"cloud event with spaces", append([]byte("\n  "), append(wrap(t, CloudEvent, first), '\n')...), CloudEvent, nil},
+		{"raw", raw, Raw, raw},
+		{"delimited", delimited, Delimited, delimited},
+		{"delimited single message", wrap(t, Delimited, Message{Data: []byte{0x08, 0x01}}), Delimited, nil},
+		{"self-describing", selfDescribing, SelfDescribing, selfDescribing},
+		{"base64 raw", []byte(base64.StdEncoding.EncodeToString(raw)), Raw, raw},
+		{"base64 url without padding", []byte(base64.RawURLEncoding.EncodeToString(delimited)), Delimited, delimited},
+		{"base64 with line breaks", []byte(wrapLines(base64.StdEncoding.EncodeToString(selfDescribing), 16)), SelfDescribing, selfDescribing},
+		{"confluent", framed, Raw, framed},
+		{"confluent first message", confluent.Encode(7, nil, raw), Raw, confluent.Encode(7, nil, raw)},
+		{"base64 confluent", []byte(base64.StdEncoding.EncodeToString(framed)), Raw, framed},
+
+		// near misses.
+		{"truncated JSON", []byte(`{"specversion": "1.0", "id": `), Raw, nil},
+		{"single message stream", ambiguous, Raw, ambiguous},
+		{"truncated delimited", delimited[:len(delimited)-1], Raw, nil},
+		{"self-describing without digest algorithm", undigested, Raw, undigested},
+		{"empty leading messages", append([]byte{0x00, 0x00}, delimited...), Delimited, nil},
+		{"grpc frame with invalid flags", grpcFrame(0x02, raw), Raw, nil},
+		{"grpc frame with wrong size", grpcFrame(0x00, raw)[:len(raw)+4], Raw, nil},
+		{"confluent with invalid payload", confluent.Encode(7, []int{1}, []byte{0x07}), Raw, nil},
+		{"printable message", printable, Raw, printable},
+	} {
+		name, data, err := Detect(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if name != test.envelope {
+			t.Errorf("%s: expected %s, got %s", test.name, test.envelope, name)
+		}
+		if test.data != nil && !bytes.Equal(data, test.data) {
+			t.Errorf("%s: unexpected data: %x", test.name, data)
+		}
+	}
+}
+
+func TestDetectRejects(t *testing.T) {
+
+	raw := newMessage("first", 1)
+	for _, test := range []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"spaces", []byte(" \n\t")},
+		// gRPC frames start with a zero byte, like Confluent frames and
+		// delimited streams whose first message is empty.
+		{"grpc frame", grpcFrame(0x00, raw)},
+		{"grpc frames", append(grpcFrame(0x00, raw), grpcFrame(0x00, raw)...)},
+		{"grpc-web trailer", append(grpcFrame(0x00, raw), grpcFrame(0x80, []byte("grpc-status: 0\r\n"))...)},
+		{"grpc compressed frame", grpcFrame(0x01, gzipped(t, raw))},
+		{"base64 grpc frame", []byte(base64.StdEncoding.EncodeToString(grpcFrame(0x00, raw)))},
+	} {
+		if name, _, err := Detect(test.input); err == nil {
+			t.Errorf("%s: expected an error, got %s", test.name, name)
+		}
+	}
+}
+
+func TestDetectedEnvelopesUnwrap(t *testing.T) {
+
+	first := Message{Data: newMessage("first", 1), SchemaURI: testSchemaURI, Header: map[string]interface{}{"id": "1", "source": "test"}}
+	second := Message{Data: newMessage("second", 2), SchemaURI: testSchemaURI, Header: map[string]interface{}{"id": "2", "source": "test"}}
+
+	for _, name := range []string{Raw, CloudEvent, Delimited} {
+		messages := []Message{first}
+		if name != Raw {
+			messages = append(messages, second)
+		}
+		detected, data, err := Detect(wrap(t, name, messages...))
+		if err != nil || detected != name {
+			t.Fatalf("%s: detected %s (%v)", name, detected, err)
+		}
+		env, _ := Lookup(detected)
+		unwrapped, err := env.Unwrap(data)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(unwrapped) != len(messages) {
+			t.Fatalf("%s: expected %d messages, got %d", name, len(messages), len(unwrapped))
+		}
+		for i, message := range unwrapped {
+			if !bytes.Equal(message.Data, messages[i].Data) {
+				t.Errorf("%s: unexpected message %d: %x", name, i+1, message.Data)
+			}
+		}
+	}
+}
+
+// upperEnvelope is a custom envelope carrying a single message whose bytes
+// are converted to upper case.
+type upperEnvelope struct{}
+
+func (e upperEnvelope) Wrap(messages []Message) ([]byte, error) {
+
+	return []byte(strings.ToUpper(string(messages[0].Data))), nil
+}
+
+func (e upperEnvelope) Unwrap(data []byte) ([]Message, error) {
+
+	return []Message{{Data: []byte(strings.ToLower(string(data)))}}, nil
+}
+
+func TestRegister(t *testing.T) {
+
+	Register("upper", upperEnvelope{})
+	defer func() {
+		lock.Lock()
+		delete(envelopes, "upper")
+		lock.Unlock()
+	}()
+
+	env, err := Lookup("upper")
+	if err != nil {
+		t.Fatalf("the envelope was not registered: %v", err)
+	}
+	if _, isUpper := env.(upperEnvelope); !isUpper {
+		t.Errorf("unexpected envelope: %T", env)
+	}
+	if strings.Join(Names(), ",") != "cloudevent,delimited,raw,selfdescribing,upper" {
+		t.Errorf("unexpected names: %v", Names())
+	}
+
+	// replacing a built-in envelope.
+	Register(Raw, upperEnvelope{})
+	defer Register(Raw, RawEnvelope{})
+	if env, _ := Lookup(Raw); env != (upperEnvelope{}) {
+		t.Errorf("the envelope was not replaced: %T", env)
+	}
+
+	if _, err := Lookup("missing"); err == nil || !strings.Contains(err.Error(), "upper") {
+		t.Errorf("expected the registered names to be listed, got: %v", err)
+	}
+}
+
+// wrapLines breaks the given text into lines of the given width.
+func wrapLines(text string, width int) string {
+
+	lines := []string{}
+	for len(text) > width {
+		lines = append(lines, text[:width])
+		text = text[width:]
+	}
+	return strings.Join(append(lines, text), "\n")
+}
@@ -0,0 +1,60 @@
+package envelope
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RawEnvelope carries a single protobuf binary as it is, without any
+// reference to its schema.
+type RawEnvelope struct{}
+
+// Wrap returns the protobuf binary of the message.
+func (e RawEnvelope) Wrap(messages []Message) ([]byte, error) {
+
+	if len(messages) != 1 {
+		return nil, fmt.Errorf("the raw envelope carries a single message (%d given)", len(messages))
+	}
+	return messages[0].Data, nil
+}
+
+// Unwrap returns the data as protobuf binary of a single message.
+func (e RawEnvelope) Unwrap(data []byte) ([]Message, error) {
+
+	return []Message{{Data: data}}, nil
+}
+
+// DelimitedEnvelope carries a stream of protobuf binaries, each prefixed
+// by its size encoded as varint, without any reference to their schema.
+type DelimitedEnvelope struct{}
+
+// Wrap concatenates the size-prefixed protobuf binaries of the messages.
+func (e DelimitedEnvelope) Wrap(messages []Message) ([]byte, error) {
+
+	buffer := []byte{}
+	for _, message := range messages {
+		buffer = protowire.AppendVarint(buffer, uint64(len(message.Data)))
+		buffer = append(buffer, message.Data...)
+	}
+	return buffer, nil
+}
+
+// Unwrap splits the stream into the protobuf binaries of the messages.
+func (e DelimitedEnvelope) Unwrap(data []byte) ([]Message, error) {
+
+	messages := []Message{}
+	for len(data) > 0 {
+		size, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid size of message %d: %v", len(messages)+1, protowire.ParseError(n))
+		}
+		if uint64(len(data)-n) < size {
+			return nil, errors.New("truncated delimited stream")
+		}
+		messages = append(messages, Message{Data: data[n : n+int(size)]})
+		data = data[n+int(size):]
+	}
+	return messages, nil
+}
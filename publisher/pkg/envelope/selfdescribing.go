@@ -0,0 +1,178 @@
+package envelope
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DigestAlgorithm is the prefix of the digests of the embedded schemas,
+// which names the hash function used to compute them.
+const DigestAlgorithm = "sha256:"
+
+// TypeURLPrefix is the prefix of the type URLs of the messages carried by
+// self-describing envelopes, as used by `google.protobuf.Any`.
+const TypeURLPrefix = "type.googleapis.com/"
+
+// Fields of the self-describing wrapper, which extends the layout of the
+// `SelfDescribingMessage` suggested by the protobuf documentation with the
+// digest of the descriptor set:
+//
+//	message SelfDescribingMessage {
+//	  google.protobuf.FileDescriptorSet descriptor_set = 1;
+//	  google.protobuf.Any message = 2;
+//	  string descriptor_digest = 3;
+//	}
+const (
+	descriptorSetField    protowire.Number = 1
+	messageField          protowire.Number = 2
+	descriptorDigestField protowire.Number = 3
+
+	// fields of google.protobuf.Any.
+	typeURLField protowire.Number = 1
+	valueField   protowire.Number = 2
+)
+
+// Digest computes the digest of the given serialised descriptor set, which
+// is the hexadecimal SHA-256 hash prefixed by DigestAlgorithm.
+func Digest(descriptor []byte) string {
+
+	hash := sha256.Sum256(descriptor)
+	return DigestAlgorithm + hex.EncodeToString(hash[:])
+}
+
+// SelfDescribingEnvelope carries a single protobuf binary together with the
+// file descriptor set of its schema, in a wrapper modelled after the
+// `SelfDescribingMessage` of the protobuf documentation: the message is
+// carried as `google.protobuf.Any`, whose type URL names the message type
+// within the descriptor set, and the digest of the set is appended.
+type SelfDescribingEnvelope struct{}
+
+// Wrap encodes the message, which must embed its schema, into the wrapper.
+func (e SelfDescribingEnvelope) Wrap(messages []Message) ([]byte, error) {
+
+	if len(messages) != 1 {
+		return nil, fmt.Errorf("the self-describing envelope carries a single message (%d given)", len(messages))
+	}
+	message := messages[0]
+	if len(message.Descriptor) == 0 || len(message.TypeName) == 0 {
+		return nil, errors.New("the self-describing envelope requires the schema of the message to be embedded")
+	}
+	digest := message.Digest
+	if len(digest) == 0 {
+		digest = Digest(message.Descriptor)
+	}
+
+	wrapped := protowire.AppendTag(nil, typeURLField, protowire.BytesType)
+	wrapped = protowire.AppendString(wrapped, TypeURLPrefix+message.TypeName)
+	wrapped = protowire.AppendTag(wrapped, valueField, protowire.BytesType)
+	wrapped = protowire.AppendBytes(wrapped, message.Data)
+
+	buffer := protowire.AppendTag(nil, descriptorSetField, protowire.BytesType)
+	buffer = protowire.AppendBytes(buffer, message.Descriptor)
+	buffer = protowire.AppendTag(buffer, messageField, protowire.BytesType)
+	buffer = protowire.AppendBytes(buffer, wrapped)
+	buffer = protowire.AppendTag(buffer, descriptorDigestField, protowire.BytesType)
+	buffer = protowire.AppendString(buffer, digest)
+	return buffer, nil
+}
+
+// Unwrap decodes the wrapper into the message it carries, together with the
+// embedded schema and its digest. The type of the message is the last path
+// segment of the type URL.
+func (e SelfDescribingEnvelope) Unwrap(data []byte) ([]Message, error) {
+
+	message := Message{}
+	var wrapped []byte
+	err := consumeFields(data, func(number protowire.Number, value []byte) {
+		switch number {
+		case descriptorSetField:
+			message.Descriptor = value
+		case messageField:
+			wrapped = value
+		case descriptorDigestField:
+			message.Digest = string(value)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid self-describing message: %v", err)
+	}
+	if wrapped == nil {
+		return nil, errors.New("invalid self-describing message: the message is missing")
+	}
+
+	typeURL := ""
+	err = consumeFields(wrapped, func(number protowire.Number, value []byte) {
+		switch number {
+		case typeURLField:
+			typeURL = string(value)
+		case valueField:
+			message.Data = value
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid self-describing message: %v", err)
+	}
+	message.TypeName = typeURL[strings.LastIndex(typeURL, "/")+1:]
+	if len(message.TypeName) == 0 {
+		return nil, errors.New("invalid self-describing message: the type URL is missing")
+	}
+	if message.Data == nil {
+		message.Data = []byte{}
+	}
+	return []Message{message}, nil
+}
+
+// isSelfDescribing determines whether the data is a self-describing wrapper,
+// i.e. it only contains the length-delimited fields of the wrapper, and the
+// digest names the hash function.
+func isSelfDescribing(data []byte) bool {
+
+	fields := map[protowire.Number][]byte{}
+	for len(data) > 0 {
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 || kind != protowire.BytesType || number < descriptorSetField || number > descriptorDigestField {
+			return false
+		}
+		data = data[n:]
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return false
+		}
+		fields[number] = value
+		data = data[n:]
+	}
+	return len(fields) == 3 && strings.HasPrefix(string(fields[descriptorDigestField]), DigestAlgorithm)
+}
+
+// consumeFields passes the length-delimited fields of the given binary to
+// the callback (the last occurrence of a field wins), and skips the others.
+func consumeFields(data []byte, callback func(number protowire.Number, value []byte)) error {
+
+	for len(data) > 0 {
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if kind != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(number, kind, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		callback(number, value)
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Options controls the content of the descriptor sets exported.
+type Options struct {
+	// SourceInfo keeps the source code information (locations and
+	// comments) of the files that carry it. Files generated by
+	// protoc-gen-go do not, as the generator strips it.
+	SourceInfo bool
+}
+
+// FileDescriptorSet collects the files of the given registry that declare the
+// types (messages, enums, services or extensions) with the given names, with
+// all their transitive imports, into a file descriptor set. Files appear once,
+// after the files they import (as done by `protoc --include_imports`), and the
+// files of the types are visited in the given order, which makes the output
+// deterministic. The global registry of files (protoregistry.GlobalFiles) holds
+// the schema of the types linked in the executable.
+func FileDescriptorSet(files *protoregistry.Files, names []protoreflect.FullName, options Options) (*descriptorpb.FileDescriptorSet, error) {
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least a type is required")
+	}
+
+	collector := &collector{visited: map[string]bool{}, options: options}
+	for _, name := range names {
+		descriptor, err := files.FindDescriptorByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("no type matching name: %s", name)
+		}
+		collector.collect(descriptor.ParentFile())
+	}
+	return &descriptorpb.FileDescriptorSet{File: collector.files}, nil
+}
+
+// Marshal serialises the given file descriptor set deterministically, so that
+// the same schema always produces the same binary.
+func Marshal(set *descriptorpb.FileDescriptorSet) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(set)
+}
+
+// collector accumulates the files of a descriptor set in dependency order.
+type collector struct {
+	files   []*descriptorpb.FileDescriptorProto
+	visited map[string]bool
+	options Options
+}
+
+// collect appends the imports of the given file, and then the file itself,
+// unless it has already been collected.
+func (c *collector) collect(file protoreflect.FileDescriptor) {
+
+	if c.visited[file.Path()] {
+		return
+	}
+	c.visited[file.Path()] = true
+
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		c.collect(imports.Get(i).FileDescriptor)
+	}
+
+	fdp := protodesc.ToFileDescriptorProto(file)
+	if !c.options.SourceInfo {
+		fdp.SourceCodeInfo = nil
+	}
+	c.files = append(c.files, fdp)
+}
@@ -0,0 +1,190 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// file creates a file declaring a message with a field for each of the
+// given types, which are declared by the given dependencies.
+func file(path string, message string, dependencies []string, types ...string) *descriptorpb.FileDescriptorProto {
+
+	fields := []*descriptorpb.FieldDescriptorProto{}
+	for i, typeName := range types {
+		fields = append(fields, &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(strings.ToLower(typeName[strings.LastIndex(typeName, ".")+1:])),
+			Number:   proto.Int32(int32(i + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+			TypeName: proto.String(typeName),
+		})
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:        proto.String(path),
+		Package:     proto.String("export.test"),
+		Syntax:      proto.String("proto3"),
+		Dependency:  dependencies,
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String(message), Field: fields}},
+	}
+}
+
+// testRegistry builds a registry of files importing each other:
+//
+//	base.proto
+//	left.proto   -> base.proto
+//	right.proto  -> base.proto
+//	top.proto    -> left.proto, right.proto, base.proto
+//	other.proto
+func testRegistry(t *testing.T) *protoregistry.Files {
+
+	t.Helper()
+	top := file("export/top.proto", "Top", []string{"export/left.proto", "export/right.proto", "export/base.proto"}, ".export.test.Left", ".export.test.Right", ".export.test.Base")
+	top.SourceCodeInfo = &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+		Path:            []int32{4, 0},
+		Span:            []int32{0, 0, 10},
+		LeadingComments: proto.String(" Top of the tree.\n"),
+	}}}
+
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		top,
+		file("export/right.proto", "Right", []string{"export/base.proto"}, ".export.test.Base"),
+		file("export/other.proto", "Other", nil),
+		file("export/left.proto", "Left", []string{"export/base.proto"}, ".export.test.Base"),
+		file("export/base.proto", "Base", nil),
+	}})
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return files
+}
+
+// paths returns the paths of the files of the set, in order.
+func paths(set *descriptorpb.FileDescriptorSet) string {
+
+	names := []string{}
+	for _, file := range set.File {
+		names = append(names, file.GetName())
+	}
+	return strings.Join(names, ",")
+}
+
+func TestFileDescriptorSetDependencyOrder(t *testing.T) {
+
+	files := testRegistry(t)
+	for _, test := range []struct {
+		names    []protoreflect.FullName
+		expected string
+	}{
+		{[]protoreflect.FullName{"export.test.Top"}, "export/base.proto,export/left.proto,export/right.proto,export/top.proto"},
+		{[]protoreflect.FullName{"export.test.Right"}, "export/base.proto,export/right.proto"},
+		// the files of the types are visited in the given order.
+		{[]protoreflect.FullName{"export.test.Other", "export.test.Left"}, "export/other.proto,export/base.proto,export/left.proto"},
+		{[]protoreflect.FullName{"export.test.Left", "export.test.Other"}, "export/base.proto,export/left.proto,export/other.proto"},
+		// files shared by several types appear once.
+		{[]protoreflect.FullName{"export.test.Right", "export.test.Top", "export.test.Base", "export.test.Top.base"}, "export/base.proto,export/right.proto,export/left.proto,export/top.proto"},
+	} {
+		set, err := FileDescriptorSet(files, test.names, Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if actual := paths(set); actual != test.expected {
+			t.Errorf("%v: unexpected files: %s", test.names, actual)
+		}
+		// the set is complete, as each file follows its imports.
+		if _, err := protodesc.NewFiles(set); err != nil {
+			t.Errorf("%v: invalid set: %v", test.names, err)
+		}
+	}
+}
+
+func TestFileDescriptorSetLinkedTypes(t *testing.T) {
+
+	name := (&events.ImportMessage{}).ProtoReflect().Descriptor().FullName()
+	set, err := FileDescriptorSet(protoregistry.GlobalFiles, []protoreflect.FullName{name, name}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, file := range set.File {
+		if seen[file.GetName()] {
+			t.Errorf("duplicate file: %s", file.GetName())
+		}
+		for _, dependency := range file.Dependency {
+			if !seen[dependency] {
+				t.Errorf("%s precedes its import %s", file.GetName(), dependency)
+			}
+		}
+		seen[file.GetName()] = true
+	}
+	if !seen["google/protobuf/timestamp.proto"] {
+		t.Errorf("missing import: %s", paths(set))
+	}
+}
+
+func TestFileDescriptorSetSourceInfo(t *testing.T) {
+
+	files := testRegistry(t)
+	names := []protoreflect.FullName{"export.test.Top"}
+
+	set, err := FileDescriptorSet(files, names, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.File[3].SourceCodeInfo != nil {
+		t.Errorf("unexpected source information")
+	}
+
+	set, err = FileDescriptorSet(files, names, Options{SourceInfo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locations := set.File[3].GetSourceCodeInfo().GetLocation(); len(locations) != 1 || locations[0].GetLeadingComments() != " Top of the tree.\n" {
+		t.Errorf("unexpected source information: %v", locations)
+	}
+}
+
+func TestFileDescriptorSetErrors(t *testing.T) {
+
+	files := testRegistry(t)
+	if _, err := FileDescriptorSet(files, nil, Options{}); err == nil || !strings.Contains(err.Error(), "at least a type is required") {
+		t.Errorf("expected the empty list to be rejected, got: %v", err)
+	}
+	if _, err := FileDescriptorSet(files, []protoreflect.FullName{"export.test.Top", "export.test.Missing"}, Options{}); err == nil || !strings.Contains(err.Error(), "no type matching name: export.test.Missing") {
+		t.Errorf("expected the missing type to be rejected, got: %v", err)
+	}
+}
+
+func TestMarshalIsDeterministic(t *testing.T) {
+
+	set, err := FileDescriptorSet(testRegistry(t), []protoreflect.FullName{"export.test.Top"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the set exported from an equivalent registry is the same binary.
+	set, _ = FileDescriptorSet(testRegistry(t), []protoreflect.FullName{"export.test.Top"}, Options{})
+	second, err := Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("the binaries differ")
+	}
+
+	decoded := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(first, decoded); err != nil || !proto.Equal(decoded, set) {
+		t.Errorf("the binary does not decode to the set (error: %v)", err)
+	}
+}
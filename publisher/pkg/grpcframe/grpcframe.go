@@ -0,0 +1,158 @@
+package grpcframe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Flags set on the first byte of the header of a frame.
+const (
+	// CompressedFlag marks frames whose payload is compressed with the
+	// encoding negotiated by the call (`grpc-encoding`).
+	CompressedFlag = 0x01
+	// TrailerFlag marks the frames carrying the trailers of a gRPC-Web
+	// response, encoded as HTTP/1 headers.
+	TrailerFlag = 0x80
+)
+
+// HeaderSize is the size of the header prefixing each frame: the flags and
+// the size of the payload as 4-byte big endian integer.
+const HeaderSize = 5
+
+// DefaultMaxMessageSize is the default maximum size of a decompressed
+// message, which is the default limit of gRPC servers and clients.
+const DefaultMaxMessageSize = 4 << 20
+
+// MaxMessageSize is the maximum size of the messages carried by compressed
+// frames once decompressed. A few kilobytes of gzip can expand into
+// gigabytes, hence decompression stops as soon as the limit is exceeded.
+var MaxMessageSize int64 = DefaultMaxMessageSize
+
+// Frame is a length-prefixed message of a gRPC (or gRPC-Web) stream.
+type Frame struct {
+	// Compressed determines whether the payload is compressed.
+	Compressed bool
+	// Trailer determines whether the payload carries the trailers of a
+	// gRPC-Web response rather than a message.
+	Trailer bool
+	// Payload is the content of the frame, as found in the stream.
+	Payload []byte
+}
+
+// Split splits the given stream into the frames it is composed of.
+func Split(data []byte) ([]Frame, error) {
+
+	frames := []Frame{}
+	for offset := 0; offset < len(data); {
+
+		if len(data)-offset < HeaderSize {
+			return nil, fmt.Errorf("truncated header of frame %d (offset: %d)", len(frames)+1, offset)
+		}
+		flags := data[offset]
+		if flags&^(CompressedFlag|TrailerFlag) != 0 {
+			return nil, fmt.Errorf("invalid flags of frame %d: 0x%02x", len(frames)+1, flags)
+		}
+		size := int(binary.BigEndian.Uint32(data[offset+1 : offset+HeaderSize]))
+		offset += HeaderSize
+		if len(data)-offset < size {
+			return nil, fmt.Errorf("truncated frame %d (expected %d bytes, found %d)", len(frames)+1, size, len(data)-offset)
+		}
+
+		frames = append(frames, Frame{
+			Compressed: flags&CompressedFlag != 0,
+			Trailer:    flags&TrailerFlag != 0,
+			Payload:    data[offset : offset+size],
+		})
+		offset += size
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("the stream does not contain any frame")
+	}
+	return frames, nil
+}
+
+// Message returns the message carried by the frame, decompressing the
+// payload when the frame is compressed. Only `gzip` compression, the
+// one supported by all gRPC implementations, is handled, and messages
+// larger than MaxMessageSize once decompressed are rejected.
+func (f Frame) Message() ([]byte, error) {
+
+	if !f.Compressed {
+		return f.Payload, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(f.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress frame (only gzip is supported): %v", err)
+	}
+	defer reader.Close()
+
+	// a byte more than the maximum is read, so that messages exceeding
+	// the limit are told apart from messages of the maximum size.
+	message, err := io.ReadAll(io.LimitReader(reader, MaxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress frame: %v", err)
+	}
+	if int64(len(message)) > MaxMessageSize {
+		return nil, fmt.Errorf("decompressed message exceeds the maximum size of %d bytes", MaxMessageSize)
+	}
+	return message, nil
+}
+
+// Trailers parses the payload of a trailer frame into its metadata (e.g.
+// `grpc-status` and `grpc-message`), whose names are lower case.
+func (f Frame) Trailers() map[string]string {
+
+	trailers := map[string]string{}
+	for _, line := range strings.Split(string(f.Payload), "\r\n") {
+		if separator := strings.Index(line, ":"); separator > 0 {
+			trailers[strings.ToLower(strings.TrimSpace(line[:separator]))] = strings.TrimSpace(line[separator+1:])
+		}
+	}
+	return trailers
+}
+
+// DecodeText decodes a gRPC-Web text stream (`application/grpc-web-text`),
+// which encodes the frames in base64. The stream can be the concatenation
+// of chunks encoded separately, each terminated by its own padding. White
+// spaces and line breaks are ignored.
+func DecodeText(data []byte) ([]byte, error) {
+
+	text := string(bytes.Join(bytes.Fields(data), nil))
+	decoded := []byte{}
+	for len(text) > 0 {
+
+		end := strings.IndexByte(text, '=')
+		if end < 0 {
+			end = len(text)
+		}
+		for end < len(text) && text[end] == '=' {
+			end++
+		}
+
+		chunk, err := base64.StdEncoding.DecodeString(text[:end])
+		if err != nil {
+			chunk, err = base64.RawStdEncoding.DecodeString(text[:end])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid gRPC-Web text: %v", err)
+		}
+		decoded = append(decoded, chunk...)
+		text = text[end:]
+	}
+	return decoded, nil
+}
+
+// Encode prefixes the given message with the header of an uncompressed
+// frame.
+func Encode(message []byte) []byte {
+
+	buffer := make([]byte, HeaderSize, HeaderSize+len(message))
+	binary.BigEndian.PutUint32(buffer[1:], uint32(len(message)))
+	return append(buffer, message...)
+}
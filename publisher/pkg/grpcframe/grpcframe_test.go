@@ -0,0 +1,171 @@
+package grpcframe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// frame prefixes the payload with the header of a frame with the flags.
+func frame(flags byte, payload []byte) []byte {
+
+	data := Encode(payload)
+	data[0] = flags
+	return data
+}
+
+// compress compresses the data with gzip.
+func compress(t *testing.T, data []byte) []byte {
+
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestSplitLengthPrefixedFrames(t *testing.T) {
+
+	first, second := []byte("\x0a\x05first"), []byte{}
+	stream := append(Encode(first), Encode(second)...)
+	if !bytes.Equal(stream[:HeaderSize], []byte{0, 0, 0, 0, 7}) {
+		t.Fatalf("unexpected header: %x", stream[:HeaderSize])
+	}
+
+	frames, err := Split(stream)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+	for i, expected := range [][]byte{first, second} {
+		message, err := frames[i].Message()
+		if err != nil || frames[i].Compressed || frames[i].Trailer || !bytes.Equal(message, expected) {
+			t.Errorf("unexpected frame %d: %+v (%v)", i+1, frames[i], err)
+		}
+	}
+}
+
+func TestSplitInvalidStreams(t *testing.T) {
+
+	for _, test := range []struct {
+		name    string
+		stream  []byte
+		message string
+	}{
+		{"empty", nil, "does not contain any frame"},
+		{"truncated header", []byte{0, 0, 0}, "truncated header of frame 1"},
+		{"truncated second header", append(Encode([]byte{0x08, 0x01}), 0, 0), "truncated header of frame 2"},
+		{"truncated payload", Encode([]byte{0x08, 0x01})[:6], "truncated frame 1 (expected 2 bytes, found 1)"},
+		{"invalid flags", frame(0x02, []byte{0x08, 0x01}), "invalid flags of frame 1: 0x02"},
+	} {
+		if _, err := Split(test.stream); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected an error containing %q, got: %v", test.name, test.message, err)
+		}
+	}
+}
+
+func TestWebTrailers(t *testing.T) {
+
+	trailers := "grpc-status: 0\r\nGrpc-Message: all good\r\ninvalid line\r\n"
+	stream := append(Encode([]byte{0x08, 0x01}), frame(TrailerFlag, []byte(trailers))...)
+
+	frames, err := Split(stream)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(frames) != 2 || frames[0].Trailer || !frames[1].Trailer {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	parsed := frames[1].Trailers()
+	if len(parsed) != 2 || parsed["grpc-status"] != "0" || parsed["grpc-message"] != "all good" {
+		t.Errorf("unexpected trailers: %v", parsed)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+
+	message := Encode([]byte("\x0a\x05first"))
+	trailer := frame(TrailerFlag, []byte("grpc-status: 0\r\n"))
+
+	// chunks encoded separately, each with its own padding.
+	text := base64.StdEncoding.EncodeToString(message) + "\n" + base64.StdEncoding.EncodeToString(trailer)
+	decoded, err := DecodeText([]byte(text))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(decoded, append(append([]byte{}, message...), trailer...)) {
+		t.Errorf("unexpected stream: %x", decoded)
+	}
+
+	if _, err := DecodeText([]byte("not base64!")); err == nil {
+		t.Errorf("expected invalid text to be rejected")
+	}
+}
+
+func TestCompressedFrame(t *testing.T) {
+
+	message := []byte("\x0a\x05first")
+	frames, err := Split(frame(CompressedFlag, compress(t, message)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !frames[0].Compressed {
+		t.Fatalf("the frame is not compressed")
+	}
+	decompressed, err := frames[0].Message()
+	if err != nil || !bytes.Equal(decompressed, message) {
+		t.Errorf("unexpected message: %x (%v)", decompressed, err)
+	}
+
+	// only gzip is supported.
+	frames, _ = Split(frame(CompressedFlag, message))
+	if _, err := frames[0].Message(); err == nil || !strings.Contains(err.Error(), "only gzip") {
+		t.Errorf("expected the compression to be rejected, got: %v", err)
+	}
+
+	// a truncated gzip stream.
+	compressed := compress(t, message)
+	frames, _ = Split(frame(CompressedFlag, compressed[:len(compressed)-4]))
+	if _, err := frames[0].Message(); err == nil {
+		t.Errorf("expected a truncated stream to be rejected")
+	}
+}
+
+func TestCompressedFrameSizeLimit(t *testing.T) {
+
+	previous := MaxMessageSize
+	MaxMessageSize = 1024
+	defer func() { MaxMessageSize = previous }()
+
+	// a message of the maximum size is accepted.
+	frames, _ := Split(frame(CompressedFlag, compress(t, make([]byte, 1024))))
+	if message, err := frames[0].Message(); err != nil || len(message) != 1024 {
+		t.Errorf("unexpected message: %d bytes (%v)", len(message), err)
+	}
+
+	// a byte more is rejected.
+	frames, _ = Split(frame(CompressedFlag, compress(t, make([]byte, 1025))))
+	if _, err := frames[0].Message(); err == nil || !strings.Contains(err.Error(), "exceeds the maximum size of 1024 bytes") {
+		t.Errorf("expected the message to be rejected, got: %v", err)
+	}
+}
+
+func TestCompressedFrameDefaultLimit(t *testing.T) {
+
+	// a few kilobytes expanding beyond the default limit of gRPC.
+	bomb := compress(t, make([]byte, DefaultMaxMessageSize+1))
+	if len(bomb) > 16<<10 {
+		t.Fatalf("unexpected compressed size: %d bytes", len(bomb))
+	}
+	frames, _ := Split(frame(CompressedFlag, bomb))
+	if _, err := frames[0].Message(); err == nil || !strings.Contains(err.Error(), "exceeds the maximum size") {
+		t.Errorf("expected the message to be rejected, got: %v", err)
+	}
+}
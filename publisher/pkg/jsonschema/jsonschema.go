@@ -0,0 +1,276 @@
+package jsonschema
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Draft is the identifier of the JSON Schema dialect generated.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the generic representation of a JSON Schema document.
+type Schema = map[string]interface{}
+
+// Generate produces the JSON Schema describing the JSON representation of
+// the message identified by `md`, as rendered by the `parse` command. The
+// schema of the root message and of all the messages and enumerations it
+// references are collected under `$defs`, and the root schema refers to
+// the definition of the root message. Leading comments are used as
+// descriptions when the descriptor carries source information.
+func Generate(md protoreflect.MessageDescriptor) Schema {
+
+	g := generator{definitions: Schema{}, prefix: "#/$defs/"}
+	root := g.messageRef(md)
+	root["$schema"] = Draft
+	root["title"] = string(md.FullName())
+	root["$defs"] = g.definitions
+	return root
+}
+
+// Definitions produces the schema of the message identified by `md` and
+// the schemas of the types it references, indexed by their full name. This
+// enables embedding the schemas in other documents, where definitions are
+// referenced by using the given `prefix` (e.g. `#/components/schemas/`).
+func Definitions(md protoreflect.MessageDescriptor, prefix string) (Schema, Schema) {
+
+	g := generator{definitions: Schema{}, prefix: prefix}
+	root := g.messageRef(md)
+	return root, g.definitions
+}
+
+// generator collects the definitions of the messages and enumerations
+// visited while producing a schema.
+type generator struct {
+	definitions Schema
+	prefix      string
+}
+
+// ref returns a reference to the definition with the given name.
+func (g *generator) ref(name protoreflect.FullName) Schema {
+
+	return Schema{"$ref": g.prefix + string(name)}
+}
+
+// messageRef returns the schema used to reference the given message. Well
+// known types are rendered inline according to their JSON mapping, while
+// other messages are added to the definitions and referenced.
+func (g *generator) messageRef(md protoreflect.MessageDescriptor) Schema {
+
+	if schema := wellKnownSchema(md); schema != nil {
+		return schema
+	}
+
+	name := md.FullName()
+	if _, isPresent := g.definitions[string(name)]; !isPresent {
+		// the placeholder breaks the recursion for self-referencing
+		// messages, and it is replaced once the message is visited.
+		g.definitions[string(name)] = Schema{}
+		g.definitions[string(name)] = g.message(md)
+	}
+	return g.ref(name)
+}
+
+// message produces the schema of the given message.
+func (g *generator) message(md protoreflect.MessageDescriptor) Schema {
+
+	properties := Schema{}
+	required := []string{}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+
+		fd := fields.Get(i)
+		schema := g.field(fd)
+		describe(schema, fd)
+		properties[string(fd.Name())] = schema
+		if fd.Cardinality() == protoreflect.Required {
+			required = append(required, string(fd.Name()))
+		}
+	}
+
+	schema := Schema{
+		"type":                 "object",
+		"title":                string(md.Name()),
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	describe(schema, md)
+
+	// oneof declarations, at most one of the members is rendered by
+	// the parser, hence either one member is present or none.
+	constraints := []interface{}{}
+	oneofs := md.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+
+		od := oneofs.Get(i)
+		if od.IsSynthetic() {
+			continue
+		}
+		members := []interface{}{}
+		for j := 0; j < od.Fields().Len(); j++ {
+			members = append(members, Schema{"required": []string{string(od.Fields().Get(j).Name())}})
+		}
+		none := Schema{"not": Schema{"anyOf": append([]interface{}{}, members...)}}
+		constraints = append(constraints, Schema{"oneOf": append(members, none)})
+	}
+	switch len(constraints) {
+	case 0:
+	case 1:
+		schema["oneOf"] = constraints[0].(Schema)["oneOf"]
+	default:
+		schema["allOf"] = constraints
+	}
+
+	return schema
+}
+
+// field produces the schema of the value of the given field.
+func (g *generator) field(fd protoreflect.FieldDescriptor) Schema {
+
+	switch {
+	case fd.IsMap():
+		return Schema{
+			"type":                 "object",
+			"propertyNames":        mapKeySchema(fd.MapKey()),
+			"additionalProperties": g.value(fd.MapValue()),
+		}
+	case fd.IsList():
+		return Schema{
+			"type":  "array",
+			"items": g.value(fd),
+		}
+	default:
+		return g.value(fd)
+	}
+}
+
+// value produces the schema of a single value of the given field.
+func (g *generator) value(fd protoreflect.FieldDescriptor) Schema {
+
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return g.messageRef(fd.Message())
+	case protoreflect.EnumKind:
+		return g.enumRef(fd.Enum())
+	default:
+		return scalarSchema(fd.Kind())
+	}
+}
+
+// enumRef returns the schema used to reference the given enum, which is
+// added to the definitions. Values are rendered with their names.
+func (g *generator) enumRef(ed protoreflect.EnumDescriptor) Schema {
+
+	if ed.FullName() == "google.protobuf.NullValue" {
+		return Schema{"type": "null"}
+	}
+
+	name := ed.FullName()
+	if _, isPresent := g.definitions[string(name)]; !isPresent {
+		names := []string{}
+		for i := 0; i < ed.Values().Len(); i++ {
+			names = append(names, string(ed.Values().Get(i).Name()))
+		}
+		schema := Schema{
+			"type":  "string",
+			"title": string(ed.Name()),
+			"enum":  names,
+		}
+		describe(schema, ed)
+		g.definitions[string(name)] = schema
+	}
+	return g.ref(name)
+}
+
+// scalarSchema produces the schema of a scalar value of the given kind,
+// according to the JSON mapping used by protojson.
+func scalarSchema(kind protoreflect.Kind) Schema {
+
+	switch kind {
+	case protoreflect.BoolKind:
+		return Schema{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return Schema{"type": "integer", "minimum": -2147483648, "maximum": 2147483647}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return Schema{"type": "integer", "minimum": 0, "maximum": 4294967295}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return Schema{"type": "string", "pattern": "^-?[0-9]+$"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return Schema{"type": "string", "pattern": "^[0-9]+$"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return Schema{"oneOf": []interface{}{
+			Schema{"type": "number"},
+			Schema{"type": "string", "enum": []string{"NaN", "Infinity", "-Infinity"}},
+		}}
+	case protoreflect.BytesKind:
+		return Schema{"type": "string", "contentEncoding": "base64"}
+	default:
+		return Schema{"type": "string"}
+	}
+}
+
+// mapKeySchema produces the schema of the keys of a map, which are always
+// rendered as strings in JSON.
+func mapKeySchema(fd protoreflect.FieldDescriptor) Schema {
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return Schema{"enum": []string{"true", "false"}}
+	case protoreflect.StringKind:
+		return Schema{"type": "string"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return Schema{"pattern": "^[0-9]+$"}
+	default:
+		return Schema{"pattern": "^-?[0-9]+$"}
+	}
+}
+
+// wellKnownSchema produces the schema of the well known types that have a
+// special JSON mapping, or returns nil for any other message.
+func wellKnownSchema(md protoreflect.MessageDescriptor) Schema {
+
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return Schema{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return Schema{"type": "string", "pattern": "^-?[0-9]+(\\.[0-9]+)?s$"}
+	case "google.protobuf.FieldMask":
+		return Schema{"type": "string"}
+	case "google.protobuf.Struct":
+		return Schema{"type": "object"}
+	case "google.protobuf.ListValue":
+		return Schema{"type": "array"}
+	case "google.protobuf.Value":
+		return Schema{}
+	case "google.protobuf.Empty":
+		return Schema{"type": "object", "maxProperties": 0}
+	case "google.protobuf.Any":
+		return Schema{
+			"type":       "object",
+			"properties": Schema{"@type": Schema{"type": "string"}},
+			"required":   []string{"@type"},
+		}
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		return scalarSchema(md.Fields().ByNumber(1).Kind())
+	}
+	return nil
+}
+
+// describe sets the description of the given schema to the leading
+// comments of the descriptor, when source information is available.
+func describe(schema Schema, descriptor protoreflect.Descriptor) {
+
+	location := descriptor.ParentFile().SourceLocations().ByDescriptor(descriptor)
+	comments := strings.TrimSpace(location.LeadingComments)
+	if len(comments) > 0 {
+		schema["description"] = comments
+	}
+}
@@ -0,0 +1,315 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// the well known types are referenced by the test schemas.
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// field creates a field with the given name, number, label and type.
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+
+	fdp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     kind.Enum(),
+	}
+	if len(typeName) > 0 {
+		fdp.TypeName = proto.String(typeName)
+	}
+	return fdp
+}
+
+// testFile builds a file with the given syntax and messages, which may
+// reference the well known types linked in the binary.
+func testFile(t *testing.T, syntax string, messages ...*descriptorpb.DescriptorProto) protoreflect.FileDescriptor {
+
+	t.Helper()
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("jsonschema/test_" + syntax + ".proto"),
+		Package: proto.String("jsonschema.test"),
+		Syntax:  proto.String(syntax),
+		Dependency: []string{
+			"google/protobuf/any.proto",
+			"google/protobuf/duration.proto",
+			"google/protobuf/empty.proto",
+			"google/protobuf/field_mask.proto",
+			"google/protobuf/struct.proto",
+			"google/protobuf/timestamp.proto",
+			"google/protobuf/wrappers.proto",
+		},
+		MessageType: messages,
+	}
+	file, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return file
+}
+
+// encode renders the given schema fragment as JSON, for comparisons.
+func encode(t *testing.T, schema interface{}) string {
+
+	t.Helper()
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// definition returns the definition of the message with the given name.
+func definition(t *testing.T, schema Schema, name string) Schema {
+
+	t.Helper()
+	definition, isPresent := schema["$defs"].(Schema)[name].(Schema)
+	if !isPresent {
+		t.Fatalf("missing definition %s in %s", name, encode(t, schema))
+	}
+	return definition
+}
+
+// property returns the schema of the property with the given name.
+func property(t *testing.T, definition Schema, name string) Schema {
+
+	t.Helper()
+	property, isPresent := definition["properties"].(Schema)[name].(Schema)
+	if !isPresent {
+		t.Fatalf("missing property %s in %s", name, encode(t, definition))
+	}
+	return property
+}
+
+func TestGenerateRoot(t *testing.T) {
+
+	schema := Generate((&events.ComposedMessage{}).ProtoReflect().Descriptor())
+
+	if schema["$schema"] != Draft || schema["title"] != "hyp0th3rmi4.protobuf.sample.ComposedMessage" || schema["$ref"] != "#/$defs/hyp0th3rmi4.protobuf.sample.ComposedMessage" {
+		t.Errorf("unexpected root: %s", encode(t, schema))
+	}
+	// the referenced messages are collected too.
+	if len(schema["$defs"].(Schema)) != 3 {
+		t.Errorf("unexpected definitions: %s", encode(t, schema["$defs"]))
+	}
+	composed := definition(t, schema, "hyp0th3rmi4.protobuf.sample.ComposedMessage")
+	if actual := encode(t, property(t, composed, "param_01")); actual != `{"$ref":"#/$defs/hyp0th3rmi4.protobuf.sample.SimpleMessage"}` {
+		t.Errorf("unexpected property: %s", actual)
+	}
+	if composed["additionalProperties"] != false {
+		t.Errorf("unexpected definition: %s", encode(t, composed))
+	}
+
+	root, definitions := Definitions((&events.ComposedMessage{}).ProtoReflect().Descriptor(), "#/components/schemas/")
+	if actual := encode(t, root); actual != `{"$ref":"#/components/schemas/hyp0th3rmi4.protobuf.sample.ComposedMessage"}` {
+		t.Errorf("unexpected root: %s", actual)
+	}
+	if len(definitions) != 3 {
+		t.Errorf("unexpected definitions: %s", encode(t, definitions))
+	}
+}
+
+func TestGenerate64BitIntegersAsStrings(t *testing.T) {
+
+	schema := Generate((&events.SimpleMessage{}).ProtoReflect().Descriptor())
+	simple := definition(t, schema, "hyp0th3rmi4.protobuf.sample.SimpleMessage")
+
+	for name, expected := range map[string]string{
+		"param_04": `{"maximum":2147483647,"minimum":-2147483648,"type":"integer"}`,
+		"param_05": `{"pattern":"^-?[0-9]+$","type":"string"}`,
+		"param_06": `{"maximum":4294967295,"minimum":0,"type":"integer"}`,
+		"param_07": `{"pattern":"^[0-9]+$","type":"string"}`,
+		"param_09": `{"pattern":"^-?[0-9]+$","type":"string"}`,
+		"param_11": `{"pattern":"^[0-9]+$","type":"string"}`,
+		"param_13": `{"pattern":"^-?[0-9]+$","type":"string"}`,
+	} {
+		if actual := encode(t, property(t, simple, name)); actual != expected {
+			t.Errorf("unexpected schema of %s: %s", name, actual)
+		}
+	}
+
+	// the values rendered by protojson match the patterns.
+	message := &events.SimpleMessage{
+		Param_05: -9223372036854775808,
+		Param_07: 18446744073709551615,
+		Param_09: -1,
+		Param_11: 18446744073709551615,
+		Param_13: 9223372036854775807,
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := map[string]interface{}{}
+	if err := json.Unmarshal(data, &rendered); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"param_05", "param_07", "param_09", "param_11", "param_13"} {
+		value, isString := rendered[name].(string)
+		pattern := property(t, simple, name)["pattern"].(string)
+		if !isString || !regexp.MustCompile(pattern).MatchString(value) {
+			t.Errorf("value of %s does not match the schema: %v", name, rendered[name])
+		}
+	}
+}
+
+func TestGenerateWellKnownTypes(t *testing.T) {
+
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	file := testFile(t, "proto3", &descriptorpb.DescriptorProto{
+		Name: proto.String("Known"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			field("timestamp", 1, optional, message, ".google.protobuf.Timestamp"),
+			field("duration", 2, optional, message, ".google.protobuf.Duration"),
+			field("mask", 3, optional, message, ".google.protobuf.FieldMask"),
+			field("struct", 4, optional, message, ".google.protobuf.Struct"),
+			field("list", 5, optional, message, ".google.protobuf.ListValue"),
+			field("value", 6, optional, message, ".google.protobuf.Value"),
+			field("empty", 7, optional, message, ".google.protobuf.Empty"),
+			field("any", 8, optional, message, ".google.protobuf.Any"),
+			field("int64", 9, optional, message, ".google.protobuf.Int64Value"),
+			field("string", 10, optional, message, ".google.protobuf.StringValue"),
+			field("bytes", 11, optional, message, ".google.protobuf.BytesValue"),
+			field("null", 12, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".google.protobuf.NullValue"),
+		},
+	})
+
+	schema := Generate(file.Messages().ByName("Known"))
+	known := definition(t, schema, "jsonschema.test.Known")
+	for name, expected := range map[string]string{
+		"timestamp": `{"format":"date-time","type":"string"}`,
+		"duration":  `{"pattern":"^-?[0-9]+(\\.[0-9]+)?s$","type":"string"}`,
+		"mask":      `{"type":"string"}`,
+		"struct":    `{"type":"object"}`,
+		"list":      `{"type":"array"}`,
+		"value":     `{}`,
+		"empty":     `{"maxProperties":0,"type":"object"}`,
+		"any":       `{"properties":{"@type":{"type":"string"}},"required":["@type"],"type":"object"}`,
+		"int64":     `{"pattern":"^-?[0-9]+$","type":"string"}`,
+		"string":    `{"type":"string"}`,
+		"bytes":     `{"contentEncoding":"base64","type":"string"}`,
+		"null":      `{"type":"null"}`,
+	} {
+		if actual := encode(t, property(t, known, name)); actual != expected {
+			t.Errorf("unexpected schema of %s: %s", name, actual)
+		}
+	}
+	// the well known types are rendered inline rather than defined.
+	if len(schema["$defs"].(Schema)) != 1 {
+		t.Errorf("unexpected definitions: %s", encode(t, schema["$defs"]))
+	}
+
+	imported := definition(t, Generate((&events.ImportMessage{}).ProtoReflect().Descriptor()), "hyp0th3rmi4.protobuf.sample.ImportMessage")
+	if actual := encode(t, property(t, imported, "param_01")); actual != `{"format":"date-time","type":"string"}` {
+		t.Errorf("unexpected schema of the timestamp: %s", actual)
+	}
+}
+
+func TestGenerateOneofConstraints(t *testing.T) {
+
+	// a single oneof constrains the message directly.
+	complex := definition(t, Generate((&events.ComplexMessage{}).ProtoReflect().Descriptor()), "hyp0th3rmi4.protobuf.sample.ComplexMessage")
+	members := complex["oneOf"].([]interface{})
+	if len(members) != 3 {
+		t.Fatalf("unexpected oneof: %s", encode(t, members))
+	}
+	none := Schema{"not": Schema{"anyOf": members[:2]}}
+	if encode(t, members[2]) != encode(t, none) {
+		t.Errorf("unexpected oneof: %s", encode(t, members))
+	}
+	if _, isPresent := complex["allOf"]; isPresent {
+		t.Errorf("unexpected definition: %s", encode(t, complex))
+	}
+
+	// several oneofs are all enforced, while the synthetic oneof of a
+	// proto3 optional field is not a constraint.
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	inOneof := func(fdp *descriptorpb.FieldDescriptorProto, index int32) *descriptorpb.FieldDescriptorProto {
+		fdp.OneofIndex = proto.Int32(index)
+		return fdp
+	}
+	nickname := inOneof(field("nickname", 5, optional, str, ""), 2)
+	nickname.Proto3Optional = proto.Bool(true)
+	file := testFile(t, "proto3", &descriptorpb.DescriptorProto{
+		Name: proto.String("Choices"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			inOneof(field("a", 1, optional, str, ""), 0),
+			inOneof(field("b", 2, optional, str, ""), 0),
+			inOneof(field("c", 3, optional, str, ""), 1),
+			inOneof(field("d", 4, optional, str, ""), 1),
+			nickname,
+		},
+		OneofDecl: []*descriptorpb.OneofDescriptorProto{
+			{Name: proto.String("first")}, {Name: proto.String("second")}, {Name: proto.String("_nickname")},
+		},
+	})
+
+	choices := definition(t, Generate(file.Messages().ByName("Choices")), "jsonschema.test.Choices")
+	expected := `[` +
+		`{"oneOf":[{"required":["a"]},{"required":["b"]},{"not":{"anyOf":[{"required":["a"]},{"required":["b"]}]}}]},` +
+		`{"oneOf":[{"required":["c"]},{"required":["d"]},{"not":{"anyOf":[{"required":["c"]},{"required":["d"]}]}}]}` +
+		`]`
+	if actual := encode(t, choices["allOf"]); actual != expected {
+		t.Errorf("unexpected constraints: %s", actual)
+	}
+	if _, isPresent := choices["oneOf"]; isPresent {
+		t.Errorf("unexpected definition: %s", encode(t, choices))
+	}
+}
+
+func TestGenerateRequiredAndRecursion(t *testing.T) {
+
+	file := testFile(t, "proto2", &descriptorpb.DescriptorProto{
+		Name: proto.String("Node"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			field("name", 1, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("children", 2, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".jsonschema.test.Node"),
+			field("labels", 3, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".jsonschema.test.Node.LabelsEntry"),
+		},
+		NestedType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("LabelsEntry"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_UINT64, ""),
+				field("value", 2, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}},
+	})
+
+	schema := Generate(file.Messages().ByName("Node"))
+	node := definition(t, schema, "jsonschema.test.Node")
+	if actual := encode(t, node["required"]); actual != `["name"]` {
+		t.Errorf("unexpected required fields: %s", actual)
+	}
+	if actual := encode(t, property(t, node, "children")); actual != `{"items":{"$ref":"#/$defs/jsonschema.test.Node"},"type":"array"}` {
+		t.Errorf("unexpected schema of the children: %s", actual)
+	}
+	// map entries are not definitions, and keys are strings.
+	if actual := encode(t, property(t, node, "labels")); actual != `{"additionalProperties":{"type":"boolean"},"propertyNames":{"pattern":"^[0-9]+$"},"type":"object"}` {
+		t.Errorf("unexpected schema of the labels: %s", actual)
+	}
+	if len(schema["$defs"].(Schema)) != 1 {
+		t.Errorf("unexpected definitions: %s", encode(t, schema["$defs"]))
+	}
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// registryEntry is a registry of descriptors that is loaded once, and shared
+// by all the lookups of the same schema.
+type registryEntry struct {
+	once     sync.Once
+	registry *protoregistry.Files
+	err      error
+}
+
+// cacheLock guards the access to the cached registries.
+var cacheLock sync.Mutex
+
+// registries caches the registries of descriptors loaded when the cache is
+// enabled, indexed by schema URI (without fragment) and, for registries
+// resolved through reflection, by the symbols requested.
+var registries map[string]*registryEntry
+
+// EnableRegistryCache makes the parser load the registry of descriptors of
+// each schema only once, and share it among all the messages (and goroutines)
+// that reference the schema. This is meant for batches of messages, as any
+// change of the schemas during the lifetime of the process is ignored. The
+// cache is emptied whenever the policy (see SetPolicy) or the trusted
+// digests (see TrustDigests) change.
+func EnableRegistryCache() {
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if registries == nil {
+		registries = map[string]*registryEntry{}
+	}
+}
+
+// resetRegistryCache discards the registries cached so far, if the cache is
+// enabled, as they were loaded under the policy and the trusted digests that
+// were in force at the time.
+func resetRegistryCache() {
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if registries != nil {
+		registries = map[string]*registryEntry{}
+	}
+}
+
+// cachedRegistry returns the registry of descriptors of the given schema
+// from the cache, loading it on first use. When the cache is not enabled,
+// the registry is always loaded.
+func cachedRegistry(schemaUrl *url.URL, symbols []protoreflect.FullName) (*protoregistry.Files, error) {
+
+	cacheLock.Lock()
+	if registries == nil {
+		cacheLock.Unlock()
+		return openRegistry(schemaUrl, symbols...)
+	}
+
+	location := *schemaUrl
+	location.Fragment = ""
+	key := location.String()
+	if schemaUrl.Scheme == ReflectionScheme {
+		names := []string{}
+		for _, symbol := range symbols {
+			names = append(names, string(symbol))
+		}
+		sort.Strings(names)
+		key += "#" + strings.Join(names, ",")
+	}
+
+	entry, isPresent := registries[key]
+	if !isPresent {
+		entry = &registryEntry{}
+		registries[key] = entry
+	}
+	cacheLock.Unlock()
+
+	entry.once.Do(func() {
+		entry.registry, entry.err = openRegistry(schemaUrl, symbols...)
+	})
+	return entry.registry, entry.err
+}
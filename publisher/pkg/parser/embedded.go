@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"publisher/pkg/envelope"
+	"publisher/pkg/logging"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// embeddedRegistries caches the registries of descriptors built out of the
+// schemas embedded in the messages, indexed by digest. Since the schemas are
+// verified against their digest before being used, the same digest always
+// identifies the same schema.
+var embeddedRegistries sync.Map
+
+// decodeEvent unmarshals the payload of the given cloud event into a dynamic
+// message. The schema embedded in the event is preferred, when present, to
+// the one referenced by its `dataschema` attribute, unless the attribute pins
+// the digest of the schema (see pinsSchema).
+func decodeEvent(ce cloudevents.Event, isDynamic bool) (*dynamicpb.Message, error) {
+
+	descriptor, digest, err := envelope.EmbeddedSchema(ce)
+	if err != nil {
+		return nil, err
+	}
+	if len(descriptor) == 0 {
+		return decode(ce.Data(), ce.DataSchema(), isDynamic)
+	}
+	if pinsSchema(ce.DataSchema()) {
+		return decode(ce.Data(), ce.DataSchema(), true)
+	}
+
+	messageType := ce.Type()
+	if schemaUrl, err := url.Parse(ce.DataSchema()); err == nil && len(schemaUrl.Fragment) > 0 {
+		messageType = schemaUrl.Fragment
+	}
+	return decodeEmbedded(ce.Data(), descriptor, digest, QualifiedName(messageType))
+}
+
+// pinsSchema determines whether the given schema URI pins the digest of the
+// schema it references, in which case the schema embedded in the message is
+// ignored and the message is decoded with the pinned schema, which is loaded
+// (i.e. resolved dynamically, unless Resolution is static) and verified. The
+// digest of an embedded schema is supplied by the sender along with it, so it
+// only detects corruption: an embedded schema is trusted only when its digest
+// is among the trusted digests (see TrustDigests).
+func pinsSchema(schemaUri string) bool {
+
+	schemaUrl, err := url.Parse(schemaUri)
+	if err != nil || len(schemaUrl.Query().Get(IntegrityParameter)) == 0 {
+		return false
+	}
+	logging.SugarLog.Warnf("Ignoring the schema embedded in the message, as the schema URI pins its digest (schema: %s)", schemaUri)
+	return true
+}
+
+// decodeEmbedded unmarshals the given protobuf binary into a dynamic message
+// of the given type, which is resolved in the given (serialised) descriptor
+// set after verifying it against its digest.
+func decodeEmbedded(protobuf []byte, descriptor []byte, digest string, typeName protoreflect.FullName) (*dynamicpb.Message, error) {
+
+	registry, err := embeddedRegistry(descriptor, digest)
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Infof("Using schema embedded in the message (digest: %s)", digest)
+
+	found, err := registry.FindDescriptorByName(typeName)
+	if err != nil {
+		return nil, fmt.Errorf("the embedded schema does not define type %s", typeName)
+	}
+	md, isMessage := found.(protoreflect.MessageDescriptor)
+	if !isMessage {
+		return nil, fmt.Errorf("%s is not a message", typeName)
+	}
+
+	protobuf, err = unframe(protobuf)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	err = proto.Unmarshal(protobuf, msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// embeddedRegistry verifies the given descriptor set against its digest, and
+// builds the registry of the descriptors it contains. Schemas without digest
+// are rejected, as their integrity cannot be verified, as well as schemas
+// whose digest is not trusted (see TrustDigests). Without trusted digests,
+// any schema matching the digest sent along with it is accepted.
+func embeddedRegistry(descriptor []byte, digest string) (*protoregistry.Files, error) {
+
+	if len(digest) == 0 {
+		return nil, &IntegrityError{Location: "embedded in the message", Reason: "the schema has no digest"}
+	}
+	if cached, isPresent := embeddedRegistries.Load(digest); isPresent {
+		return cached.(*protoregistry.Files), verifyTrusted("embedded in the message", strings.TrimPrefix(digest, envelope.DigestAlgorithm))
+	}
+
+	computed := envelope.Digest(descriptor)
+	if computed != digest {
+		return nil, &IntegrityError{Location: "embedded in the message", Expected: digest, Computed: computed, Reason: "the content does not match its digest"}
+	}
+	err := verifyTrusted("embedded in the message", strings.TrimPrefix(computed, envelope.DigestAlgorithm))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	err = proto.Unmarshal(descriptor, set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded schema: %v", err)
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded schema: %v", err)
+	}
+
+	embeddedRegistries.Store(digest, registry)
+	return registry, nil
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"publisher/pkg/envelope"
+	"publisher/pkg/logging"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ParseEnvelope reads the content of the file specified by `sourcePath` and
+// unwraps the messages it carries with the envelope registered under the
+// given name. With `envelope.Auto` the envelope is detected by sniffing the
+// content of the file (see envelope.Detect). The result is described by Parse.
+func ParseEnvelope(sourcePath string, name string, schemaUri string, isDynamic bool) (interface{}, error) {
+
+	data, err := readSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.SugarLog.Infof("Read file (path: %s, size: %d bytes)", sourcePath, len(data))
+
+	if name == envelope.Auto {
+		name, data, err = envelope.Detect(data)
+		if err != nil {
+			return nil, err
+		}
+		logging.SugarLog.Infof("Detected envelope (name: %s)", name)
+	}
+
+	env, err := envelope.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, env, schemaUri, isDynamic)
+}
+
+// Parse unwraps the messages carried by the given data with the envelope, and
+// deserialises them according to the schema they embed, the schema they
+// reference or, when they do not reference any, the one pointed by `schemaUri`.
+// Embedded schemas are ignored when the schema URI pins a digest (see
+// pinsSchema). Messages whose envelope
+// has a header (e.g. cloud events) are rendered as the header with the JSON
+// form of the message as `data`, other messages as their JSON form. A single
+// message is returned as it is, multiple messages as an array.
+func Parse(data []byte, env envelope.Envelope, schemaUri string, isDynamic bool) (interface{}, error) {
+
+	messages, err := env.Unwrap(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, errors.New("the input does not carry any message")
+	}
+
+	results := []interface{}{}
+	for i, message := range messages {
+
+		uri := message.SchemaURI
+		if len(uri) == 0 {
+			uri = schemaUri
+		}
+
+		var structure map[string]interface{}
+		switch {
+		case len(message.Descriptor) > 0 && pinsSchema(uri):
+			structure, err = deserialize(message.Data, uri, true)
+		case len(message.Descriptor) > 0:
+			structure, err = deserializeEmbedded(message, uri)
+		case len(uri) == 0:
+			return nil, fmt.Errorf("message %d does not reference a schema and no schema URI is given", i+1)
+		default:
+			structure, err = deserialize(message.Data, uri, isDynamic)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not deserialise message %d: %w", i+1, err)
+		}
+
+		if message.Header == nil {
+			results = append(results, structure)
+			continue
+		}
+		container := map[string]interface{}{}
+		for key, value := range message.Header {
+			container[key] = value
+		}
+		container["datacontenttype"] = "application/json"
+		container["data"] = structure
+		results = append(results, container)
+	}
+
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	return results, nil
+}
+
+// deserializeEmbedded deserialises the given message according to the schema
+// it embeds. The type of the message is the one given by the envelope or, if
+// the envelope does not name it, the fragment of the schema URI.
+func deserializeEmbedded(message envelope.Message, schemaUri string) (map[string]interface{}, error) {
+
+	typeName := protoreflect.FullName(message.TypeName)
+	if len(typeName) == 0 {
+		schemaUrl, err := url.Parse(schemaUri)
+		if err != nil {
+			return nil, err
+		}
+		if len(schemaUrl.Fragment) == 0 {
+			return nil, errors.New("the message embeds its schema, but its type is unknown")
+		}
+		typeName = QualifiedName(schemaUrl.Fragment)
+	}
+
+	msg, err := decodeEmbedded(message.Data, message.Descriptor, message.Digest, typeName)
+	if err != nil {
+		return nil, err
+	}
+	return render(msg)
+}
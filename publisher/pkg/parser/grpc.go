@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"publisher/pkg/grpcframe"
+	"publisher/pkg/logging"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Directions of the messages exchanged by a gRPC method.
+const (
+	// DirectionRequest selects the input type of the method.
+	DirectionRequest = "request"
+	// DirectionResponse selects the output type of the method.
+	DirectionResponse = "response"
+)
+
+// ParseGRPC reads the content of the file specified by `sourcePath`, which is
+// a capture of the messages exchanged by a gRPC call (or a gRPC-Web call, also
+// in its base64 text form), and splits it into its length-prefixed frames. The
+// type of the messages is the input or output type (according to `direction`)
+// of the method, given as `/package.Service/Method` and resolved through the
+// service descriptors available at `schemaUri`. Compressed frames are expected
+// to use gzip, and the trailers of gRPC-Web responses are logged. A single
+// message is returned as its JSON form, multiple messages as an array.
+func ParseGRPC(sourcePath string, schemaUri string, method string, direction string) (interface{}, error) {
+
+	md, err := ResolveMethod(schemaUri, method)
+	if err != nil {
+		return nil, err
+	}
+
+	var descriptor protoreflect.MessageDescriptor
+	switch direction {
+	case DirectionRequest:
+		descriptor = md.Input()
+	case DirectionResponse:
+		descriptor = md.Output()
+	default:
+		return nil, fmt.Errorf("unknown direction: '%s' (expected %s or %s)", direction, DirectionRequest, DirectionResponse)
+	}
+	logging.SugarLog.Infof("Resolved %s type of method %s: %s", direction, md.FullName(), descriptor.FullName())
+
+	data, err := readSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.SugarLog.Infof("Read file (path: %s, size: %d bytes)", sourcePath, len(data))
+
+	frames, err := grpcframe.Split(data)
+	if err != nil {
+		decoded, textErr := grpcframe.DecodeText(data)
+		if textErr != nil {
+			return nil, err
+		}
+		frames, err = grpcframe.Split(decoded)
+		if err != nil {
+			return nil, err
+		}
+		logging.SugarLog.Info("Decoded gRPC-Web text stream")
+	}
+
+	results := []interface{}{}
+	for i, frame := range frames {
+
+		if frame.Trailer {
+			logging.SugarLog.Infof("Read trailers (frame: %d): %v", i+1, frame.Trailers())
+			continue
+		}
+
+		message, err := frame.Message()
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", i+1, err)
+		}
+
+		msg := dynamicpb.NewMessage(descriptor)
+		err = proto.Unmarshal(message, msg)
+		if err != nil {
+			return nil, fmt.Errorf("could not deserialise frame %d: %v", i+1, err)
+		}
+		logging.SugarLog.Infof("Unmarshalled frame %d (size: %d bytes, compressed: %t)", i+1, len(frame.Payload), frame.Compressed)
+
+		structure, err := render(msg)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, structure)
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("the capture does not contain any message")
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	return results, nil
+}
+
+// ResolveMethod resolves the descriptor of the gRPC method with the given name
+// (`/package.Service/Method`, or `package.Service.Method`) through the service
+// descriptors available at the given schema URI, whose fragment is ignored.
+func ResolveMethod(schemaUri string, method string) (protoreflect.MethodDescriptor, error) {
+
+	schemaUrl, err := url.Parse(schemaUri)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimPrefix(method, "/")
+	separator := strings.LastIndexAny(name, "/.")
+	if separator <= 0 || separator == len(name)-1 {
+		return nil, fmt.Errorf("invalid gRPC method: '%s' (expected /package.Service/Method)", method)
+	}
+	serviceName := protoreflect.FullName(name[:separator])
+	methodName := protoreflect.Name(name[separator+1:])
+
+	registry, err := cachedRegistry(schemaUrl, []protoreflect.FullName{serviceName})
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := registry.FindDescriptorByName(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("could not find service %s: %v", serviceName, err)
+	}
+	service, isService := descriptor.(protoreflect.ServiceDescriptor)
+	if !isService {
+		return nil, fmt.Errorf("%s is not a service", serviceName)
+	}
+
+	md := service.Methods().ByName(methodName)
+	if md == nil {
+		return nil, fmt.Errorf("service %s does not define method %s", serviceName, methodName)
+	}
+	return md, nil
+}
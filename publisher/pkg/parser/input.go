@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"publisher/pkg/confluent"
+	"publisher/pkg/logging"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Encodings of the content read from the source files.
+const (
+	// InputBinary reads the content as it is.
+	InputBinary = "binary"
+	// InputBase64 decodes the content from base64 text in the standard
+	// alphabet, with or without padding.
+	InputBase64 = "base64"
+	// InputBase64URL decodes the content from base64 text in the URL-safe
+	// alphabet, with or without padding.
+	InputBase64URL = "base64url"
+	// InputHex decodes the content from hexadecimal text, optionally
+	// prefixed by `0x`.
+	InputHex = "hex"
+	// InputAuto decodes the content from hexadecimal or base64 text when
+	// it is valid in either encoding, and reads it as it is otherwise.
+	// Text that is valid in both encodings is decoded with the one that
+	// yields a well formed protobuf binary (see decodeAuto).
+	InputAuto = "auto"
+)
+
+// StdinPath is the source path that reads the content from the standard
+// input rather than from a file.
+const StdinPath = "-"
+
+// InputEncoding is the encoding of the content read from the source files
+// by the parsing functions (e.g. ParseRaw), which is decoded before being
+// interpreted. Payloads copied from logs or from Kafka UIs are usually text
+// rather than binary.
+var InputEncoding = InputBinary
+
+// DecodeInput decodes the given content according to the encoding. White
+// spaces and line breaks are ignored by the text encodings.
+func DecodeInput(data []byte, encoding string) ([]byte, error) {
+
+	if encoding == InputBinary || len(encoding) == 0 {
+		return data, nil
+	}
+
+	text := string(bytes.Join(bytes.Fields(data), nil))
+	switch encoding {
+	case InputBase64:
+		return decodeBase64(text, base64.StdEncoding, base64.RawStdEncoding)
+	case InputBase64URL:
+		return decodeBase64(text, base64.URLEncoding, base64.RawURLEncoding)
+	case InputHex:
+		return decodeHex(text)
+	case InputAuto:
+		return decodeAuto(data, text)
+	}
+	return nil, fmt.Errorf("unknown input encoding: '%s' (expected %s, %s, %s, %s or %s)", encoding, InputBinary, InputBase64, InputBase64URL, InputHex, InputAuto)
+}
+
+// decodeAuto decodes the given text, which is the data without white spaces,
+// as hexadecimal or base64 text, or returns the data as it is when the text
+// is valid in neither encoding. Hexadecimal digits are also base64 symbols,
+// hence text made of an even number of digits whose length is a multiple of
+// 4 is valid in both encodings (e.g. `CAA4ABAA`): such text is decoded with
+// the encoding that yields a well formed protobuf binary, and is rejected
+// when both or neither do. Text prefixed by `0x` is always hexadecimal.
+func decodeAuto(data []byte, text string) ([]byte, error) {
+
+	hexDecoded, hexErr := decodeHex(text)
+	base64Decoded, base64Err := base64.StdEncoding.Strict().DecodeString(text)
+	isPrefixed := len(text) > 1 && text[0] == '0' && (text[1] == 'x' || text[1] == 'X')
+
+	if hexErr == nil && base64Err == nil && !isPrefixed {
+		isHex, isBase64 := isWellFormed(hexDecoded), isWellFormed(base64Decoded)
+		if isHex == isBase64 {
+			return nil, fmt.Errorf("ambiguous input, valid as both %s and %s text: use the %s or %s encoding", InputHex, InputBase64, InputHex, InputBase64)
+		}
+		if isBase64 {
+			logging.SugarLog.Infof("Detected input encoding: %s", InputBase64)
+			return base64Decoded, nil
+		}
+	}
+	if hexErr == nil {
+		logging.SugarLog.Infof("Detected input encoding: %s", InputHex)
+		return hexDecoded, nil
+	}
+	if decoded, err := decodeBase64(text, base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding); err == nil {
+		logging.SugarLog.Infof("Detected input encoding: %s", InputBase64)
+		return decoded, nil
+	}
+	logging.SugarLog.Infof("Detected input encoding: %s", InputBinary)
+	return data, nil
+}
+
+// isWellFormed determines whether the data is a sequence of well formed
+// protobuf fields, once stripped of the Confluent framing if any.
+func isWellFormed(data []byte) bool {
+
+	if frame, err := confluent.Decode(data); err == nil {
+		data = frame.Payload
+	}
+	for len(data) > 0 {
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 || number < 1 {
+			return false
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(number, kind, data)
+		if n < 0 {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
+
+// readSource reads the content of the file specified by `sourcePath`, or
+// of the standard input when the path is StdinPath, and decodes it
+// according to InputEncoding.
+func readSource(sourcePath string) ([]byte, error) {
+
+	var data []byte
+	var err error
+	if sourcePath == StdinPath {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(sourcePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return DecodeInput(data, InputEncoding)
+}
+
+// decodeBase64 decodes the text with the first of the given encodings that
+// accepts it.
+func decodeBase64(text string, encodings ...*base64.Encoding) ([]byte, error) {
+
+	if len(text) == 0 {
+		return nil, errors.New("empty base64 input")
+	}
+	var err error
+	for _, encoding := range encodings {
+		var decoded []byte
+		decoded, err = encoding.DecodeString(text)
+		if err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64 input: %v", err)
+}
+
+// decodeHex decodes hexadecimal text, optionally prefixed by `0x`.
+func decodeHex(text string) ([]byte, error) {
+
+	if len(text) > 1 && text[0] == '0' && (text[1] == 'x' || text[1] == 'X') {
+		text = text[2:]
+	}
+	if len(text) == 0 {
+		return nil, errors.New("empty hex input")
+	}
+	decoded, err := hex.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex input: %v", err)
+	}
+	return decoded, nil
+}
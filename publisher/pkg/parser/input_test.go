@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"publisher/pkg/confluent"
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// sampleBinary returns the protobuf binary of a sample message.
+func sampleBinary(t *testing.T) []byte {
+
+	t.Helper()
+	data, err := proto.Marshal(&events.SimpleMessage{Param_01: "first parameter", Param_02: true, Param_04: -32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// breakLines splits the text into indented lines of the given width, as
+// payloads copied from logs often are.
+func breakLines(text string, width int) string {
+
+	lines := []string{}
+	for len(text) > width {
+		lines = append(lines, "  "+text[:width])
+		text = text[width:]
+	}
+	return strings.Join(append(lines, "  "+text), "\r\n") + "\n"
+}
+
+func TestDecodeInput(t *testing.T) {
+
+	data := sampleBinary(t)
+	// base64 text whose symbols are only hexadecimal digits.
+	hexLike := []byte{0x08, 0x00, 0x38, 0x00, 0x10, 0x00}
+
+	for _, test := range []struct {
+		name     string
+		encoding string
+		input    string
+		expected []byte
+	}{
+		{"binary", InputBinary, string(data), data},
+		{"default", "", string(data), data},
+		{"base64", InputBase64, base64.StdEncoding.EncodeToString(data), data},
+		{"base64 without padding", InputBase64, base64.RawStdEncoding.EncodeToString(data), data},
+		{"base64 with line breaks", InputBase64, breakLines(base64.StdEncoding.EncodeToString(data), 8), data},
+		{"base64url", InputBase64URL, base64.URLEncoding.EncodeToString([]byte{0xfb, 0xff}), []byte{0xfb, 0xff}},
+		{"base64url without padding", InputBase64URL, base64.RawURLEncoding.EncodeToString([]byte{0xfb, 0xff}), []byte{0xfb, 0xff}},
+		{"hex", InputHex, hex.EncodeToString(data), data},
+		{"hex prefixed", InputHex, "0x" + hex.EncodeToString(data), data},
+		{"hex upper case with spaces", InputHex, breakLines(strings.ToUpper(hex.EncodeToString(data)), 6), data},
+		{"auto hex", InputAuto, hex.EncodeToString(data), data},
+		{"auto hex with line breaks", InputAuto, breakLines(hex.EncodeToString(data), 10), data},
+		{"auto hex valid as base64", InputAuto, "08011001", []byte{0x08, 0x01, 0x10, 0x01}},
+		{"auto hex prefixed", InputAuto, "0x08961234", []byte{0x08, 0x96, 0x12, 0x34}},
+		{"auto base64", InputAuto, base64.StdEncoding.EncodeToString(data), data},
+		{"auto base64 of hex digits", InputAuto, base64.StdEncoding.EncodeToString(hexLike), hexLike},
+		{"auto base64 of hex digits with spaces", InputAuto, " CAA4\n ABAA\n", hexLike},
+		{"auto base64url", InputAuto, base64.RawURLEncoding.EncodeToString([]byte{0xfb, 0xff}), []byte{0xfb, 0xff}},
+		{"auto confluent base64", InputAuto, base64.StdEncoding.EncodeToString(confluent.Encode(0x0d, nil, hexLike)), confluent.Encode(0x0d, nil, hexLike)},
+		{"auto binary", InputAuto, string(data), data},
+		{"auto JSON", InputAuto, `{"id": "1"}`, []byte(`{"id": "1"}`)},
+	} {
+		decoded, err := DecodeInput([]byte(test.input), test.encoding)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(decoded, test.expected) {
+			t.Errorf("%s: expected %x, got %x", test.name, test.expected, decoded)
+		}
+	}
+}
+
+func TestDecodeInputErrors(t *testing.T) {
+
+	for _, test := range []struct {
+		name     string
+		encoding string
+		input    string
+		message  string
+	}{
+		{"invalid base64", InputBase64, "not base64!", "invalid base64"},
+		{"url-safe symbols in standard base64", InputBase64, "-_8=", "invalid base64"},
+		{"empty base64", InputBase64, " \n ", "empty base64"},
+		{"invalid hex", InputHex, "0a0", "invalid hex"},
+		{"empty hex", InputHex, "0x", "empty hex"},
+		{"unknown encoding", "base32", "AAAA", "unknown input encoding"},
+		// valid in both encodings, a protobuf binary in neither.
+		{"auto ambiguous", InputAuto, "1234", "ambiguous input"},
+	} {
+		_, err := DecodeInput([]byte(test.input), test.encoding)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected an error containing %q, got: %v", test.name, test.message, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"publisher/pkg/envelope"
+)
+
+// IntegrityParameter is the query parameter of the schema URIs that pins the
+// content of the schema to its SHA-256 digest, in hexadecimal (e.g.
+// `file:///schemas/root.pb?sha256=9f86d0...#SimpleMessage`).
+const IntegrityParameter = "sha256"
+
+// IntegrityError is returned when the content of a schema cannot be trusted:
+// its digest does not match the one pinned by the schema URI, or it is not
+// among the trusted digests.
+type IntegrityError struct {
+	// Location is the location of the schema (the schema URI without its
+	// fragment), or the digest of the schema embedded in a message.
+	Location string
+	// Expected is the digest pinned by the schema URI, which is empty when
+	// the schema is rejected because it is not trusted.
+	Expected string
+	// Computed is the digest of the content of the schema, which is empty
+	// when it could not be computed.
+	Computed string
+	// Reason explains why the schema is rejected.
+	Reason string
+}
+
+// Error describes the schema rejected and the digests compared.
+func (e *IntegrityError) Error() string {
+
+	message := fmt.Sprintf("integrity check failed for schema %s: %s", e.Location, e.Reason)
+	if len(e.Expected) > 0 {
+		message += fmt.Sprintf(" (expected: %s", e.Expected)
+		if len(e.Computed) > 0 {
+			message += fmt.Sprintf(", computed: %s", e.Computed)
+		}
+		return message + ")"
+	}
+	if len(e.Computed) > 0 {
+		message += fmt.Sprintf(" (computed: %s)", e.Computed)
+	}
+	return message
+}
+
+// trustedLock guards the access to the trusted digests.
+var trustedLock sync.RWMutex
+
+// trustedDigests is the allowlist of the digests of the schemas that can be
+// used, indexed by digest (hexadecimal). When it is nil, any schema can be
+// used, unless its URI pins a different digest.
+var trustedDigests map[string]bool
+
+// TrustDigests restricts the schemas that can be used to those whose SHA-256
+// digest is among the given ones, which are hexadecimal strings optionally
+// prefixed by `sha256:` (the format of the digests of embedded schemas). The
+// allowlist applies to the schemas loaded from their location as well as to
+// the schemas embedded in the messages. An empty list lifts the restriction.
+func TrustDigests(digests []string) error {
+
+	trusted := map[string]bool{}
+	for _, digest := range digests {
+		normalised, err := normaliseDigest(digest)
+		if err != nil {
+			return err
+		}
+		trusted[normalised] = true
+	}
+
+	trustedLock.Lock()
+	trustedDigests = trusted
+	if len(trusted) == 0 {
+		trustedDigests = nil
+	}
+	trustedLock.Unlock()
+	resetRegistryCache()
+	return nil
+}
+
+// SchemaDigest computes the SHA-256 digest (hexadecimal) of the content of
+// the file descriptor set pointed by the given schema URI. The schema is
+// located as the resolver does, so the URI must be accepted by the resolver
+// policy (see SetPolicy), and its content must be a valid descriptor set.
+func SchemaDigest(schemaUri string) (string, error) {
+
+	schemaUrl, err := url.Parse(schemaUri)
+	if err != nil {
+		return "", err
+	}
+	path, err := checkPolicy(schemaUrl)
+	if err != nil {
+		return "", err
+	}
+	if schemaUrl.Scheme == ReflectionScheme {
+		return "", fmt.Errorf("the digest of schemas resolved through %s cannot be computed", ReflectionScheme)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	_, err = buildRegistry(content)
+	if err != nil {
+		return "", fmt.Errorf("invalid schema %s: %v", path, err)
+	}
+	return digestOf(content), nil
+}
+
+// PinSchemaURI adds to the given schema URI the integrity parameter pinning
+// the current content of the schema, replacing the digest previously pinned,
+// if any. The fragment of the URI is preserved.
+func PinSchemaURI(schemaUri string) (string, error) {
+
+	digest, err := SchemaDigest(schemaUri)
+	if err != nil {
+		return "", err
+	}
+	schemaUrl, err := url.Parse(schemaUri)
+	if err != nil {
+		return "", err
+	}
+	query := schemaUrl.Query()
+	query.Set(IntegrityParameter, digest)
+	schemaUrl.RawQuery = query.Encode()
+	return schemaUrl.String(), nil
+}
+
+// verifyIntegrity verifies the given content of the schema pointed by the
+// given URL against the digest pinned by the URL, if any, and against the
+// trusted digests, if any.
+func verifyIntegrity(schemaUrl *url.URL, content []byte) error {
+
+	location := *schemaUrl
+	location.Fragment = ""
+	computed := digestOf(content)
+
+	if pinned := schemaUrl.Query().Get(IntegrityParameter); len(pinned) > 0 {
+		expected, err := normaliseDigest(pinned)
+		if err != nil {
+			return &IntegrityError{Location: location.String(), Reason: err.Error()}
+		}
+		if expected != computed {
+			return &IntegrityError{Location: location.String(), Expected: expected, Computed: computed, Reason: "the content does not match the pinned digest"}
+		}
+	}
+	return verifyTrusted(location.String(), computed)
+}
+
+// verifyReflectionIntegrity rejects the schemas resolved through reflection
+// when their integrity is required, as their content cannot be verified.
+func verifyReflectionIntegrity(schemaUrl *url.URL) error {
+
+	trustedLock.RLock()
+	restricted := trustedDigests != nil
+	trustedLock.RUnlock()
+
+	location := *schemaUrl
+	location.Fragment = ""
+	if restricted || len(schemaUrl.Query().Get(IntegrityParameter)) > 0 {
+		return &IntegrityError{Location: location.String(), Reason: fmt.Sprintf("the integrity of schemas resolved through %s cannot be verified", ReflectionScheme)}
+	}
+	return nil
+}
+
+// verifyTrusted verifies that the given digest (hexadecimal) of the schema
+// at the given location is trusted, when an allowlist is defined.
+func verifyTrusted(location string, digest string) error {
+
+	trustedLock.RLock()
+	defer trustedLock.RUnlock()
+	if trustedDigests != nil && !trustedDigests[digest] {
+		return &IntegrityError{Location: location, Computed: digest, Reason: "the digest is not trusted"}
+	}
+	return nil
+}
+
+// digestOf computes the SHA-256 digest (hexadecimal) of the given content.
+func digestOf(content []byte) string {
+
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+// normaliseDigest validates the given SHA-256 digest, in hexadecimal and
+// optionally prefixed by `sha256:`, and returns it in lowercase without
+// prefix.
+func normaliseDigest(digest string) (string, error) {
+
+	normalised := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(digest), envelope.DigestAlgorithm))
+	decoded, err := hex.DecodeString(normalised)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 digest: '%s' (expected 64 hexadecimal characters)", digest)
+	}
+	return normalised, nil
+}
@@ -0,0 +1,290 @@
+package parser
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"publisher/pkg/bundle"
+	"publisher/pkg/envelope"
+	events "publisher/pkg/events/v1"
+	"publisher/pkg/export"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// otherDigest is a valid digest of none of the schemas of the tests.
+const otherDigest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// pinnedSchemaURI writes the schema of the sample messages to a temporary
+// directory, and returns its schema URI and its digest.
+func pinnedSchemaURI(t *testing.T) (string, string) {
+
+	t.Helper()
+	path := writeSchema(t, t.TempDir(), (&events.SimpleMessage{}).ProtoReflect().Descriptor())
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + path, digestOf(content)
+}
+
+// expectIntegrityError fails the test if the error is not an IntegrityError
+// whose reason contains the given text.
+func expectIntegrityError(t *testing.T, name string, err error, reason string) *IntegrityError {
+
+	t.Helper()
+	integrityErr := &IntegrityError{}
+	if !errors.As(err, &integrityErr) {
+		t.Errorf("%s: expected an integrity error, got: %v", name, err)
+		return nil
+	}
+	if !strings.Contains(integrityErr.Reason, reason) {
+		t.Errorf("%s: unexpected reason: %s", name, integrityErr.Reason)
+	}
+	return integrityErr
+}
+
+func TestNormaliseDigest(t *testing.T) {
+
+	for _, test := range []struct {
+		digest   string
+		expected string
+	}{
+		{otherDigest, otherDigest},
+		{"sha256:" + otherDigest, otherDigest},
+		{" SHA256:" + strings.ToUpper(otherDigest) + "\n", ""},
+		{strings.ToUpper(otherDigest), otherDigest},
+		{"sha256:" + strings.ToUpper(otherDigest), otherDigest},
+		{"md5:" + otherDigest, ""},
+		{otherDigest[:62], ""},
+		{otherDigest + "00", ""},
+		{"sha256:", ""},
+		{"", ""},
+	} {
+		normalised, err := normaliseDigest(test.digest)
+		if len(test.expected) == 0 {
+			if err == nil {
+				t.Errorf("expected %q to be rejected, got: %s", test.digest, normalised)
+			}
+			continue
+		}
+		if err != nil || normalised != test.expected {
+			t.Errorf("unexpected digest of %q: %s (%v)", test.digest, normalised, err)
+		}
+	}
+}
+
+func TestResolvePinnedSchema(t *testing.T) {
+
+	schemaUri, digest := pinnedSchemaURI(t)
+
+	for _, pinned := range []string{digest, "sha256:" + digest, strings.ToUpper(digest)} {
+		pinnedUri := schemaUri + "?" + url.Values{IntegrityParameter: {pinned}}.Encode() + "#SimpleMessage"
+		if _, err := ResolveDescriptor(pinnedUri, true); err != nil {
+			t.Errorf("unexpected error for pinned digest %s: %v", pinned, err)
+		}
+	}
+
+	_, err := ResolveDescriptor(schemaUri+"?sha256="+otherDigest+"#SimpleMessage", true)
+	if integrityErr := expectIntegrityError(t, "mismatch", err, "does not match"); integrityErr != nil {
+		if integrityErr.Expected != otherDigest || integrityErr.Computed != digest || integrityErr.Location != schemaUri+"?sha256="+otherDigest {
+			t.Errorf("unexpected error: %+v", integrityErr)
+		}
+	}
+
+	_, err = ResolveDescriptor(schemaUri+"?sha256=1234#SimpleMessage", true)
+	expectIntegrityError(t, "invalid pinned digest", err, "invalid SHA-256 digest")
+}
+
+func TestTrustDigests(t *testing.T) {
+
+	schemaUri, digest := pinnedSchemaURI(t)
+	defer TrustDigests(nil)
+
+	if err := TrustDigests([]string{"sha256:1234"}); err == nil {
+		t.Errorf("expected the invalid digest to be rejected")
+	}
+
+	// the digests of embedded schemas are accepted as they are.
+	if err := TrustDigests([]string{otherDigest, "sha256:" + strings.ToUpper(digest)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ResolveDescriptor(schemaUri+"#SimpleMessage", true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := TrustDigests([]string{otherDigest}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ResolveDescriptor(schemaUri+"#SimpleMessage", true)
+	if integrityErr := expectIntegrityError(t, "untrusted", err, "not trusted"); integrityErr != nil && integrityErr.Computed != digest {
+		t.Errorf("unexpected computed digest: %s", integrityErr.Computed)
+	}
+
+	// lifting the restriction.
+	if err := TrustDigests(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveDescriptor(schemaUri+"#SimpleMessage", true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEmbeddedSchemaIntegrity(t *testing.T) {
+
+	message := &events.SimpleMessage{Param_01: "first parameter"}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := bundle.Build(message.ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor, err := export.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := envelope.Digest(descriptor)
+	typeName := message.ProtoReflect().Descriptor().FullName()
+	defer TrustDigests(nil)
+
+	_, err = decodeEmbedded(payload, descriptor, "", typeName)
+	expectIntegrityError(t, "no digest", err, "no digest")
+	_, err = decodeEmbedded(payload, descriptor, envelope.DigestAlgorithm+otherDigest, typeName)
+	expectIntegrityError(t, "mismatch", err, "does not match")
+
+	// untrusted before and after being cached.
+	for _, isCached := range []bool{false, true} {
+		if err := TrustDigests([]string{otherDigest}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = decodeEmbedded(payload, descriptor, digest, typeName)
+		expectIntegrityError(t, "untrusted embedded schema", err, "not trusted")
+
+		if err := TrustDigests([]string{digest}); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeEmbedded(payload, descriptor, digest, typeName)
+		if err != nil {
+			t.Fatalf("unexpected error (cached: %t): %v", isCached, err)
+		}
+		if value := decoded.Get(decoded.Descriptor().Fields().ByName("param_01")).String(); value != "first parameter" {
+			t.Errorf("unexpected value: %s", value)
+		}
+	}
+}
+
+func TestEmbeddedSchemaIgnoredWhenPinned(t *testing.T) {
+
+	message := &events.SimpleMessage{Param_01: "first parameter"}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := bundle.Build(message.ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor, err := export.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemaUri, digest := pinnedSchemaURI(t)
+
+	embedding := func(uri string) envelope.Message {
+		return envelope.Message{
+			Data:       payload,
+			SchemaURI:  uri,
+			Header:     map[string]interface{}{"id": "1", "source": "test"},
+			Descriptor: descriptor,
+			Digest:     envelope.Digest(descriptor),
+			TypeName:   string(message.ProtoReflect().Descriptor().FullName()),
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		uri    string
+		reason string
+	}{
+		// the embedded schema is used, whatever the schema URI points to.
+		{"not pinned", "file:///missing/root.pb#SimpleMessage", ""},
+		// the pinned schema is used, and verified.
+		{"pinned", schemaUri + "?sha256=" + digest + "#SimpleMessage", ""},
+		{"pinned mismatch", schemaUri + "?sha256=" + otherDigest + "#SimpleMessage", "does not match"},
+	} {
+		ce, err := envelope.NewEvent(embedding(test.uri))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeEvent(ce, false)
+		if len(test.reason) > 0 {
+			expectIntegrityError(t, test.name, err, test.reason)
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if value := decoded.Get(decoded.Descriptor().Fields().ByName("param_01")).String(); value != "first parameter" {
+			t.Errorf("%s: unexpected value: %s", test.name, value)
+		}
+
+		// the envelopes follow the same rules, whether the schema URI is
+		// carried by the envelope or given by the caller.
+		env, err := envelope.Lookup(envelope.SelfDescribing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := env.Wrap([]envelope.Message{embedding("")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Parse(data, env, test.uri, false)
+		if len(test.reason) > 0 {
+			expectIntegrityError(t, test.name+" (envelope)", err, test.reason)
+		} else if err != nil {
+			t.Errorf("%s (envelope): unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestPinSchemaURI(t *testing.T) {
+
+	schemaUri, digest := pinnedSchemaURI(t)
+
+	pinned, err := PinSchemaURI(schemaUri + "?sha256=" + otherDigest + "#SimpleMessage")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pinned != schemaUri+"?sha256="+digest+"#SimpleMessage" {
+		t.Errorf("unexpected schema URI: %s", pinned)
+	}
+	if _, err := ResolveDescriptor(pinned, true); err != nil {
+		t.Errorf("unexpected error resolving the pinned schema: %v", err)
+	}
+
+	// only descriptor sets are pinned.
+	invalid := filepath.Join(t.TempDir(), "invalid.pb")
+	if err := os.WriteFile(invalid, []byte("not a descriptor set"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SchemaDigest("file://" + invalid); err == nil || !strings.Contains(err.Error(), "invalid schema") {
+		t.Errorf("expected the file to be rejected, got: %v", err)
+	}
+	if _, err := SchemaDigest("grpc+reflect://localhost:50051#SimpleMessage"); err == nil {
+		t.Errorf("expected the reflection schema to be rejected")
+	}
+
+	// the schema is located as the resolver does.
+	if err := SetPolicy(&Policy{SandboxRoot: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetPolicy(nil)
+	_, err = PinSchemaURI(schemaUri + "#SimpleMessage")
+	policyErr := &PolicyError{}
+	if !errors.As(err, &policyErr) || policyErr.Rule != RuleSandbox {
+		t.Errorf("expected the schema out of the sandbox to be denied, got: %v", err)
+	}
+}
@@ -1,12 +1,19 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"strings"
 
-	events "publisher/pkg/events/v1"
+	"publisher/pkg/confluent"
+	// the sample types are linked, so that they can be resolved statically.
+	_ "publisher/pkg/events/v1"
+	"publisher/pkg/pubsub"
+	"publisher/pkg/transcoder"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -36,7 +43,7 @@ const FullNameFormat = "hyp0th3rmi4.protobuf.sample.%s"
 // URI.
 func ParseRaw(sourcePath string, schemaUri string, isDynamic bool) (map[string]interface{}, error) {
 
-	data, err := os.ReadFile(sourcePath)
+	data, err := readSource(sourcePath)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +53,81 @@ func ParseRaw(sourcePath string, schemaUri string, isDynamic bool) (map[string]i
 	return deserialize(data, schemaUri, isDynamic)
 }
 
+// ParseConfluent reads the content of the file specified by `sourcePath` and
+// interprets it as a protobuf binary framed according to the Confluent wire
+// format. The schema identifier in the framing is resolved against the given
+// Schema Registry, and the message indexes select the message type within
+// the schema. It then renders a map containing the values and attributes of
+// the message, as done by ParseRaw.
+func ParseConfluent(sourcePath string, registry *confluent.Registry) (map[string]interface{}, error) {
+
+	data, err := readSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.SugarLog.Infof("Read file (path: %s, size: %d bytes)", sourcePath, len(data))
+
+	return ParseFramed(data, registry)
+}
+
+// ParseFramed interprets the given data as a protobuf binary framed according
+// to the Confluent wire format, whose schema is resolved against the given
+// Schema Registry, and renders a map containing the values and attributes of
+// the message.
+func ParseFramed(data []byte, registry *confluent.Registry) (map[string]interface{}, error) {
+
+	descriptor, payload, err := registry.Resolve(data)
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Infof("Resolved type descriptor via schema registry: %s", descriptor.FullName())
+
+	msg := dynamicpb.NewMessage(descriptor)
+	err = proto.Unmarshal(payload, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return render(msg)
+}
+
+// ParsePubSub reads the content of the file specified by `sourcePath` and
+// interprets it as the JSON representation of a Pub/Sub message (or of the
+// body of a push request), whose data is a base64 protobuf binary or JSON
+// document. The schema of the data is identified by the schema attributes
+// of the message, and is resolved through the given local directory of
+// schemas. The method returns the map representation of the entire message,
+// whose data has been exploded into JSON.
+func ParsePubSub(sourcePath string, schemas *pubsub.SchemaDirectory) (map[string]interface{}, error) {
+
+	data, err := readSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.SugarLog.Infof("Read Pub/Sub message (path: %s, size: %d bytes)", sourcePath, len(data))
+
+	container, message, err := pubsub.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := schemas.Decode(message)
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Infof("Decoded Pub/Sub message data (type: %s)", msg.Descriptor().FullName())
+
+	structure, err := render(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	container["data"] = structure
+	return container, nil
+}
+
 // ParseCloudEvent reads the content of the file specified by `sourcePath` and
 // interprets it as a JSON document containing the definition of a CloudEvent,
 // whose payload is a base64 binary of a protobuf. It then deserialises the
@@ -58,23 +140,95 @@ func ParseRaw(sourcePath string, schemaUri string, isDynamic bool) (map[string]i
 // that are linked to the executable will be used based on the schema URI.
 func ParseCloudEvent(sourcePath string, schemaUri string, isDynamic bool) (map[string]interface{}, error) {
 
-	ce := cloudevents.Event{}
-	data, err := os.ReadFile(sourcePath)
+	ce, data, err := readCloudEvent(sourcePath)
 	if err != nil {
 		return nil, err
 	}
 
-	logging.SugarLog.Infof("Read cloud event (path: %s, size: %d bytes)", sourcePath, len(data))
+	return explode(ce, data, isDynamic)
+}
 
-	err = json.Unmarshal(data, &ce)
+// ParseEvent deserialises the protobuf payload of the given CloudEvent based
+// on the schema referenced by its `dataschema` attribute, and returns the map
+// representation of the entire event whose payload has been exploded into
+// JSON, as done by ParseCloudEvent for events read from files.
+func ParseEvent(ce cloudevents.Event, isDynamic bool) (map[string]interface{}, error) {
+
+	data, err := json.Marshal(ce)
 	if err != nil {
 		return nil, err
 	}
 
-	var structure map[string]interface{}
-	logging.SugarLog.Infof("Unmarshalled file content into CloudEvent: %v", ce)
+	return explode(ce, data, isDynamic)
+}
+
+// ParsePayload interprets the given protobuf binary as an instance of the
+// message whose schema is defined in the location pointed by `schemaUri`,
+// and renders a map containing the values and attributes for the message,
+// as done by ParseRaw for binaries read from files.
+func ParsePayload(protobuf []byte, schemaUri string, isDynamic bool) (map[string]interface{}, error) {
 
-	structure, err = deserialize(ce.Data(), ce.DataSchema(), isDynamic)
+	return deserialize(protobuf, schemaUri, isDynamic)
+}
+
+// TranscodeRaw reads the content of the file specified by `sourcePath` and
+// interprets it as a protobuf binary, as done by ParseRaw. Rather than
+// building a message and rendering it into a map, the binary is transcoded
+// into JSON in a single pass: the document returned is the same that is
+// obtained by marshalling the map produced by ParseRaw.
+func TranscodeRaw(sourcePath string, schemaUri string, isDynamic bool) (json.RawMessage, error) {
+
+	data, err := readSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.SugarLog.Infof("Read file (path: %s, size: %d bytes)", sourcePath, len(data))
+
+	buffer := &bytes.Buffer{}
+	err = TranscodePayload(buffer, data, schemaUri, isDynamic)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(buffer.Bytes()), nil
+}
+
+// TranscodePayload interprets the given protobuf binary as an instance of
+// the message whose schema is defined in the location pointed by `schemaUri`
+// and writes its JSON form to the writer, reading the binary only once (see
+// the transcoder package). The JSON is the same produced by ParsePayload.
+func TranscodePayload(w io.Writer, protobuf []byte, schemaUri string, isDynamic bool) error {
+
+	descriptor, err := resolveDescriptor(schemaUri, isDynamic)
+	if err != nil {
+		return err
+	}
+	logging.SugarLog.Info("Resolved type descriptor for specified schema")
+
+	protobuf, err = unframe(protobuf)
+	if err != nil {
+		return err
+	}
+
+	err = transcoder.Transcode(w, descriptor, protobuf)
+	if err != nil {
+		return err
+	}
+	logging.SugarLog.Info("Transcoded protobuf binary into JSON format")
+
+	return nil
+}
+
+// explode deserialises the payload of the given CloudEvent and replaces
+// it in the JSON representation of the event (`data`) with its map form.
+// The schema embedded in the event, if any, is preferred to `dataschema`.
+func explode(ce cloudevents.Event, data []byte, isDynamic bool) (map[string]interface{}, error) {
+
+	msg, err := decodeEvent(ce, isDynamic)
+	if err != nil {
+		return nil, err
+	}
+	structure, err := render(msg)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +241,62 @@ func ParseCloudEvent(sourcePath string, schemaUri string, isDynamic bool) (map[s
 	container["data"] = structure
 
 	return container, nil
+}
+
+// DecodeRaw reads the content of the file specified by `sourcePath` and
+// interprets it as protobuf binary containing an instance of the message
+// whose schema is defined in the location pointed by `schemaUri`. Unlike
+// ParseRaw, the method returns the decoded message rather than its JSON
+// representation, so that callers can inspect its content via reflection.
+func DecodeRaw(sourcePath string, schemaUri string, isDynamic bool) (*dynamicpb.Message, error) {
 
+	data, err := readSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.SugarLog.Infof("Read file (path: %s, size: %d bytes)", sourcePath, len(data))
+
+	return decode(data, schemaUri, isDynamic)
+}
+
+// DecodeCloudEvent reads the content of the file specified by `sourcePath`
+// and interprets it as a JSON document containing the definition of a
+// CloudEvent, whose payload is decoded according to the schema referenced
+// by the `dataschema` attribute of the event. Unlike ParseCloudEvent, the
+// method returns the decoded payload rather than the JSON representation
+// of the entire event.
+func DecodeCloudEvent(sourcePath string, isDynamic bool) (*dynamicpb.Message, error) {
+
+	ce, _, err := readCloudEvent(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeEvent(ce, isDynamic)
+}
+
+// readCloudEvent reads the content of the file specified by `sourcePath`
+// and unmarshals it into a CloudEvent. The method returns both the event
+// and the original content of the file.
+func readCloudEvent(sourcePath string) (cloudevents.Event, []byte, error) {
+
+	ce := cloudevents.Event{}
+	data, err := readSource(sourcePath)
+	if err != nil {
+		return ce, nil, err
+	}
+
+	logging.SugarLog.Infof("Read cloud event (path: %s, size: %d bytes)", sourcePath, len(data))
+
+	err = json.Unmarshal(data, &ce)
+	if err != nil {
+		return ce, nil, err
+	}
+
+	logging.SugarLog.Infof("Unmarshalled file content into CloudEvent: %v", ce)
+
+	return ce, data, nil
 }
 
 // deserilize interprets the content of the given protobuf binary array according
@@ -99,20 +308,17 @@ func ParseCloudEvent(sourcePath string, schemaUri string, isDynamic bool) (map[s
 // it then into a JSON document, returned as a map.
 func deserialize(protobuf []byte, schemaUri string, isDynamic bool) (map[string]interface{}, error) {
 
-	descriptor, err := resolveDescriptor(schemaUri, isDynamic)
+	msg, err := decode(protobuf, schemaUri, isDynamic)
 	if err != nil {
 		return nil, err
 	}
-	logging.SugarLog.Info("Resolved type descriptor for specified schema")
 
-	msg := dynamicpb.NewMessage(descriptor)
-	logging.SugarLog.Info("Created dynamic message container with descriptor")
+	return render(msg)
+}
 
-	err = proto.Unmarshal(protobuf, msg)
-	if err != nil {
-		return nil, err
-	}
-	logging.SugarLog.Info("Unmarshalled protobuf binary into dynamic message")
+// render converts the given message into a JSON document, returned
+// as a map.
+func render(msg protoreflect.ProtoMessage) (map[string]interface{}, error) {
 
 	options := protojson.MarshalOptions{
 		Multiline:     true,
@@ -133,7 +339,67 @@ func deserialize(protobuf []byte, schemaUri string, isDynamic bool) (map[string]
 	logging.SugarLog.Info("Unmarshalled JSON format into map[string]interface{}")
 
 	return structure, nil
+}
+
+// decode resolves the message descriptor pointed by `schemaUri` and uses it
+// to unmarshal the given `protobuf` binary array into a dynamic message.
+func decode(protobuf []byte, schemaUri string, isDynamic bool) (*dynamicpb.Message, error) {
+
+	descriptor, err := resolveDescriptor(schemaUri, isDynamic)
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Info("Resolved type descriptor for specified schema")
+
+	protobuf, err = unframe(protobuf)
+	if err != nil {
+		return nil, err
+	}
 
+	msg := dynamicpb.NewMessage(descriptor)
+	logging.SugarLog.Info("Created dynamic message container with descriptor")
+
+	err = proto.Unmarshal(protobuf, msg)
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Info("Unmarshalled protobuf binary into dynamic message")
+
+	return msg, nil
+}
+
+// StripFraming determines whether the binaries decoded against a schema URI
+// are unframed when they start with the header of the Confluent wire format.
+// It is enabled when a Schema Registry is configured, since only then binaries
+// are expected to be framed: otherwise a binary starting with a zero byte is
+// malformed, and is reported as such rather than silently truncated.
+var StripFraming = false
+
+// unframe strips the Confluent framing from the given binary, if any and if
+// StripFraming is enabled. A protobuf binary never starts with a zero byte
+// (field number 0 is not valid), hence such binaries are framed according
+// to the Confluent wire format, which is stripped since the type is given by
+// the schema.
+func unframe(protobuf []byte) ([]byte, error) {
+
+	if !StripFraming || !confluent.IsFramed(protobuf) {
+		return protobuf, nil
+	}
+	frame, err := confluent.Decode(protobuf)
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Infof("Stripped Confluent framing (schema id: %d)", frame.SchemaID)
+
+	return frame.Payload, nil
+}
+
+// ResolveDescriptor resolves the message descriptor pointed by the given
+// `schemaUri`, whose fragment identifies the message type. The resolution
+// follows the same rules applied when parsing messages, which are based
+// on the value of `isDynamic`.
+func ResolveDescriptor(schemaUri string, isDynamic bool) (protoreflect.MessageDescriptor, error) {
+	return resolveDescriptor(schemaUri, isDynamic)
 }
 
 // resolveDescriptor examines the given schemaUri and extracts the
@@ -143,8 +409,9 @@ func deserialize(protobuf []byte, schemaUri string, isDynamic bool) (map[string]
 // type registry built out of it, which is then queried by using
 // the fragment of the schema URI interpreted as type name. If the
 // value of `isDynamic` is `false` only the fragment of the URI is
-// extracted and mapped to the corresponding statically linked type
-// in the executable, from which a message descriptor is resolved.
+// extracted and looked up among the types linked to the executable.
+// The choice is overridden by `Resolution`, which also enables the
+// hybrid resolution (see resolveHybrid).
 func resolveDescriptor(schemaUri string, isDynamic bool) (protoreflect.MessageDescriptor, error) {
 
 	schemaUrl, err := url.Parse(schemaUri)
@@ -152,75 +419,99 @@ func resolveDescriptor(schemaUri string, isDynamic bool) (protoreflect.MessageDe
 		return nil, err
 	}
 
-	var descriptor protoreflect.MessageDescriptor
-
-	if isDynamic {
+	switch {
+	case Resolution == ResolutionHybrid:
+		return resolveHybrid(schemaUrl)
+	case Resolution == ResolutionStatic, len(Resolution) == 0 && !isDynamic:
+		return resolveStatic(schemaUrl.Fragment)
+	}
+	return resolveDynamic(schemaUrl)
+}
 
-		logging.SugarLog.Infof("Using DYNAMIC type resolution, via type registry")
+// resolveDynamic builds a type registry out of the file descriptor set
+// pointed by the schema URI, and looks up the message type identified by
+// the fragment of the URI.
+func resolveDynamic(schemaUrl *url.URL) (protoreflect.MessageDescriptor, error) {
 
-		var registry *protoregistry.Files
-		registry, err = createRegistry(schemaUrl.Path)
-		if err != nil {
-			return nil, err
-		}
-		logging.SugarLog.Info("Resolved type registry")
+	logging.SugarLog.Infof("Using DYNAMIC type resolution, via type registry")
 
-		messageType := schemaUrl.Fragment
-		messageTypeFullName := protoreflect.FullName(fmt.Sprintf(FullNameFormat, messageType))
+	messageTypeFullName := QualifiedName(schemaUrl.Fragment)
 
-		logging.SugarLog.Infof("Message full type name is: %s", messageTypeFullName)
+	registry, err := cachedRegistry(schemaUrl, []protoreflect.FullName{messageTypeFullName})
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Info("Resolved type registry")
 
-		var pd protoreflect.Descriptor
-		pd, err = registry.FindDescriptorByName(messageTypeFullName)
-		if err != nil {
-			return nil, err
-		}
-		logging.SugarLog.Info("Found descritptor")
-		descriptor = pd.(protoreflect.MessageDescriptor)
+	logging.SugarLog.Infof("Message full type name is: %s", messageTypeFullName)
 
-	} else {
+	pd, err := registry.FindDescriptorByName(messageTypeFullName)
+	if err != nil {
+		return nil, err
+	}
+	logging.SugarLog.Info("Found descritptor")
 
-		logging.SugarLog.Info("Using STATIC type resolution, via compiled types descriptor")
+	descriptor, isMessage := pd.(protoreflect.MessageDescriptor)
+	if !isMessage {
+		return nil, fmt.Errorf("%s is not a message", messageTypeFullName)
+	}
+	return descriptor, nil
+}
 
-		var msg protoreflect.ProtoMessage
-		switch schemaUrl.Fragment {
-		case "SimpleMessage":
-			msg = &events.SimpleMessage{}
-		case "ComplexMessage":
-			msg = &events.ComplexMessage{}
-		case "ImportMessage":
-			msg = &events.ImportMessage{}
-		case "ComposedMessage":
-			msg = &events.ComposedMessage{}
-		case "EnumtMessage":
-			msg = &events.EnumMessage{}
-		case "NestedMessage":
-			msg = &events.NestedMessage{}
-		default:
-			return nil, fmt.Errorf("no message matching type: %s", schemaUrl.Fragment)
-		}
+// QualifiedName returns the fully qualified name of the protobuf
+// message identified by `messageType`. Simple names are expanded by
+// using `FullNameFormat`, while names that already contain a package
+// qualifier are returned unchanged.
+func QualifiedName(messageType string) protoreflect.FullName {
 
-		descriptor = msg.ProtoReflect().Descriptor()
+	if strings.Contains(messageType, ".") {
+		return protoreflect.FullName(messageType)
 	}
+	return protoreflect.FullName(fmt.Sprintf(FullNameFormat, messageType))
+}
 
-	return descriptor, nil
+// LoadRegistry builds a registry of descriptors out of the file
+// descriptor set pointed by `schemaUri`. Only the path component
+// of the URI is considered, the fragment (if any) is ignored. For
+// `grpc+reflect` URIs the registry contains the files defining the
+// services exposed by the server, and their dependencies.
+func LoadRegistry(schemaUri string) (*protoregistry.Files, error) {
 
+	schemaUrl, err := url.Parse(schemaUri)
+	if err != nil {
+		return nil, err
+	}
+	return openRegistry(schemaUrl)
 }
 
 // createRegistry builds a registry of descriptor out of the protobuf
-// file pointed by `pbFilePath`. The content of the file is unmarshalled
-// as a `FileDescriptorSet`, which is then used to initialise the registry
-// providing lookup capabilities for the descriptors in the set.
-func createRegistry(pbFilePath string) (*protoregistry.Files, error) {
-
-	buffer, err := os.ReadFile(pbFilePath)
+// file at the given path, which is pointed by `schemaUrl`. The content of the file is
+// verified against the digest pinned by the URL and the trusted digests
+// (see verifyIntegrity), and unmarshalled as a `FileDescriptorSet`, which
+// is then used to initialise the registry providing lookup capabilities
+// for the descriptors in the set.
+func createRegistry(schemaUrl *url.URL, path string) (*protoregistry.Files, error) {
+
+	buffer, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 	logging.SugarLog.Infof("Read file descriptor set metadata (size: %d bytes)", len(buffer))
 
+	err = verifyIntegrity(schemaUrl, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildRegistry(buffer)
+}
+
+// buildRegistry unmarshals the given content as a `FileDescriptorSet`, and
+// builds the registry of the descriptors it contains.
+func buildRegistry(content []byte) (*protoregistry.Files, error) {
+
 	fds := descriptorpb.FileDescriptorSet{}
-	err = proto.Unmarshal(buffer, &fds)
+	err := proto.Unmarshal(content, &fds)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"publisher/pkg/bundle"
+	"publisher/pkg/confluent"
+	events "publisher/pkg/events/v1"
+	"publisher/pkg/export"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// writeSchema writes the bundle of the schema of the given message to the
+// directory, and returns the path of the file.
+func writeSchema(t *testing.T, directory string, md protoreflect.MessageDescriptor) string {
+
+	t.Helper()
+	set, err := bundle.Build(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := export.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(directory, "root.pb")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUnframeRequiresRegistry(t *testing.T) {
+
+	message := &events.SimpleMessage{Param_01: "first parameter"}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	framed := confluent.Encode(7, []int{0}, payload)
+	schemaUri := "file://" + writeSchema(t, t.TempDir(), message.ProtoReflect().Descriptor()) + "#SimpleMessage"
+
+	// without a registry a leading zero byte is malformed protobuf.
+	if err := TranscodePayload(&bytes.Buffer{}, framed, schemaUri, true); err == nil {
+		t.Errorf("expected the framed binary to be rejected without a registry")
+	}
+	if _, err := ParsePayload(framed, schemaUri, true); err == nil {
+		t.Errorf("expected the framed binary to be rejected without a registry")
+	}
+
+	StripFraming = true
+	defer func() { StripFraming = false }()
+
+	buffer := &bytes.Buffer{}
+	if err := TranscodePayload(buffer, framed, schemaUri, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`"param_01":"first parameter"`)) {
+		t.Errorf("unexpected JSON: %s", buffer.String())
+	}
+	result, err := ParsePayload(framed, schemaUri, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result["param_01"] != "first parameter" {
+		t.Errorf("unexpected result: %v", result)
+	}
+}
@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileScheme is the scheme of the schema URIs pointing to local files. Schema
+// URIs without scheme (i.e. plain paths) are local files too.
+const FileScheme = "file"
+
+// Rules of the resolver policy, named by the errors of the URIs they deny.
+const (
+	// RuleScheme denies the URIs whose scheme is not allowed.
+	RuleScheme = "scheme"
+	// RuleHost denies the URIs whose host is not allowed.
+	RuleHost = "host"
+	// RulePath denies the URIs whose path is not under an allowed prefix.
+	RulePath = "path"
+	// RuleSandbox denies the file URIs that traverse or escape the root of
+	// the sandbox.
+	RuleSandbox = "sandbox"
+)
+
+// Policy restricts the schema URIs that the resolver accepts, which matters
+// as the `dataschema` of an event comes from the event itself: an untrusted
+// event could otherwise make the parser read any local file or reach any
+// host. Empty lists allow any value.
+type Policy struct {
+	// AllowedSchemes lists the schemes of the URIs accepted (e.g. `file`
+	// or `grpc+reflect`). URIs without scheme have the `file` scheme.
+	AllowedSchemes []string
+	// AllowedHosts lists the hosts of the URIs accepted, either as host
+	// name or as host and port. URIs without host (e.g. `file:///path`)
+	// are always accepted.
+	AllowedHosts []string
+	// AllowedPaths lists the prefixes of the paths of the URIs accepted,
+	// which are matched on whole path segments.
+	AllowedPaths []string
+	// SandboxRoot is the directory which the files pointed by file URIs
+	// must be in. Paths containing `..` segments are rejected, as well as
+	// paths that reach a file out of the root through symbolic links.
+	SandboxRoot string
+
+	// sandboxPath is the absolute path of the root of the sandbox as it
+	// was given, which differs from SandboxRoot when it is (or crosses) a
+	// symbolic link.
+	sandboxPath string
+}
+
+// PolicyError is returned when a schema URI is denied by the resolver policy.
+type PolicyError struct {
+	// URI is the schema URI denied, without fragment.
+	URI string
+	// Rule is the name of the rule denying the URI (e.g. RuleSandbox).
+	Rule string
+	// Reason explains why the rule denies the URI.
+	Reason string
+}
+
+// Error names the URI denied and the rule that fired.
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("schema URI %s denied by %s rule: %s", e.URI, e.Rule, e.Reason)
+}
+
+// policyLock guards the access to the resolver policy.
+var policyLock sync.RWMutex
+
+// policy is the resolver policy in force, or nil if any URI is accepted.
+var policy *Policy
+
+// SetPolicy makes the resolver enforce the given policy, or accept any URI
+// when it is nil. The root of the sandbox must be an existing directory, and
+// is resolved to its absolute path, without symbolic links. Paths under the
+// root as given are accepted as well, as long as the files they point to are
+// in the resolved root. Setting the policy empties the registry cache.
+func SetPolicy(p *Policy) error {
+
+	if p != nil {
+		normalised := Policy{AllowedHosts: p.AllowedHosts, SandboxRoot: p.SandboxRoot}
+		for _, scheme := range p.AllowedSchemes {
+			normalised.AllowedSchemes = append(normalised.AllowedSchemes, strings.ToLower(scheme))
+		}
+		for _, prefix := range p.AllowedPaths {
+			normalised.AllowedPaths = append(normalised.AllowedPaths, filepath.ToSlash(filepath.Clean(prefix)))
+		}
+		if len(normalised.SandboxRoot) > 0 {
+			root, err := realPath(normalised.SandboxRoot)
+			if err != nil {
+				return fmt.Errorf("invalid sandbox root: %v", err)
+			}
+			normalised.sandboxPath, _ = filepath.Abs(normalised.SandboxRoot)
+			normalised.SandboxRoot = root
+		}
+		p = &normalised
+	}
+
+	policyLock.Lock()
+	policy = p
+	policyLock.Unlock()
+	resetRegistryCache()
+	return nil
+}
+
+// ConfinesFiles determines whether the policy restricts the local files that
+// schema URIs can point to: file URIs are denied, or confined to the sandbox
+// root or to the allowed path prefixes.
+func (p Policy) ConfinesFiles() bool {
+
+	if len(p.SandboxRoot) > 0 || len(p.AllowedPaths) > 0 {
+		return true
+	}
+	if len(p.AllowedSchemes) == 0 {
+		return false
+	}
+	for _, scheme := range p.AllowedSchemes {
+		if len(scheme) == 0 || strings.EqualFold(scheme, FileScheme) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckSchemaFile verifies the path of a schema file found by other means
+// than a schema URI (e.g. in the directory of Pub/Sub schemas) against the
+// policy in force, as a file URI would be, and returns the path of the file
+// to read. It is meant to be used as a pubsub.PathCheck.
+func CheckSchemaFile(path string) (string, error) {
+
+	return checkPolicy(&url.URL{Path: filepath.ToSlash(path)})
+}
+
+// checkPolicy verifies the given schema URL against the policy in force, if
+// any, and returns the path of the file to read for file URIs. The path is
+// the one of the URL, or the real path of the file (without symbolic links)
+// when a sandbox is defined, so that the file checked is the file read.
+func checkPolicy(schemaUrl *url.URL) (string, error) {
+
+	policyLock.RLock()
+	p := policy
+	policyLock.RUnlock()
+	if p == nil {
+		return schemaUrl.Path, nil
+	}
+
+	location := *schemaUrl
+	location.Fragment = ""
+	deny := func(rule string, format string, args ...interface{}) error {
+		return &PolicyError{URI: location.String(), Rule: rule, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	scheme := schemaUrl.Scheme
+	if len(scheme) == 0 {
+		scheme = FileScheme
+	}
+	if len(p.AllowedSchemes) > 0 && !contains(p.AllowedSchemes, scheme) {
+		return "", deny(RuleScheme, "scheme '%s' is not allowed (allowed: %s)", scheme, strings.Join(p.AllowedSchemes, ", "))
+	}
+
+	if len(schemaUrl.Host) > 0 && len(p.AllowedHosts) > 0 && !contains(p.AllowedHosts, schemaUrl.Host) && !contains(p.AllowedHosts, schemaUrl.Hostname()) {
+		return "", deny(RuleHost, "host '%s' is not allowed (allowed: %s)", schemaUrl.Host, strings.Join(p.AllowedHosts, ", "))
+	}
+
+	path := schemaUrl.Path
+	if scheme != FileScheme {
+		if len(path) > 0 && len(p.AllowedPaths) > 0 && !hasPrefix(p.AllowedPaths, path) {
+			return "", deny(RulePath, "path '%s' is not under an allowed prefix (allowed: %s)", path, strings.Join(p.AllowedPaths, ", "))
+		}
+		return path, nil
+	}
+
+	if len(p.SandboxRoot) > 0 {
+		for _, segment := range strings.Split(filepath.ToSlash(path), "/") {
+			if segment == ".." {
+				return "", deny(RuleSandbox, "path '%s' traverses parent directories", path)
+			}
+		}
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if len(p.AllowedPaths) > 0 && !hasPrefix(p.AllowedPaths, filepath.ToSlash(absolute)) {
+		return "", deny(RulePath, "path '%s' is not under an allowed prefix (allowed: %s)", absolute, strings.Join(p.AllowedPaths, ", "))
+	}
+	if len(p.SandboxRoot) == 0 {
+		return path, nil
+	}
+
+	if !isWithin(p.SandboxRoot, absolute) && !isWithin(p.sandboxPath, absolute) {
+		return "", deny(RuleSandbox, "path '%s' is out of the sandbox root '%s'", absolute, p.SandboxRoot)
+	}
+	resolved, err := realPath(absolute)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(p.SandboxRoot, resolved) {
+		return "", deny(RuleSandbox, "path '%s' escapes the sandbox root '%s' through symbolic links (target: %s)", absolute, p.SandboxRoot, resolved)
+	}
+	return resolved, nil
+}
+
+// realPath returns the absolute path of the given file, with all symbolic
+// links resolved.
+func realPath(path string) (string, error) {
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absolute)
+}
+
+// isWithin determines whether the given absolute path is the root or is in
+// the root directory (or one of its subdirectories).
+func isWithin(root string, path string) bool {
+
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// hasPrefix determines whether the given path (with forward slashes) is one
+// of the prefixes, or is under one of them.
+func hasPrefix(prefixes []string, path string) bool {
+
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package parser
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	events "publisher/pkg/events/v1"
+)
+
+// sandbox creates a directory with the schema of the sample messages in
+// `root/root.pb`, next to a copy of it out of the root in `outside/root.pb`,
+// and returns the directory (without symbolic links).
+func sandbox(t *testing.T) string {
+
+	t.Helper()
+	directory, err := realPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	for _, name := range []string{"root", "outside"} {
+		if err := os.MkdirAll(filepath.Join(directory, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeSchema(t, filepath.Join(directory, name), md)
+	}
+	return directory
+}
+
+// enforcePolicy makes the resolver enforce the given policy until the end of
+// the test.
+func enforcePolicy(t *testing.T, p *Policy) {
+
+	t.Helper()
+	if err := SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetPolicy(nil) })
+}
+
+// checkURI verifies the given schema URI against the policy in force.
+func checkURI(t *testing.T, schemaUri string) (string, error) {
+
+	t.Helper()
+	schemaUrl, err := url.Parse(schemaUri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checkPolicy(schemaUrl)
+}
+
+// expectDenied fails the test if the schema URI is not denied by the given
+// rule of the policy in force.
+func expectDenied(t *testing.T, schemaUri string, rule string) {
+
+	t.Helper()
+	path, err := checkURI(t, schemaUri)
+	policyErr := &PolicyError{}
+	if !errors.As(err, &policyErr) {
+		t.Errorf("expected %s to be denied by the %s rule, got: %s (%v)", schemaUri, rule, path, err)
+		return
+	}
+	if policyErr.Rule != rule {
+		t.Errorf("expected %s to be denied by the %s rule, got: %v", schemaUri, rule, err)
+	}
+	if strings.Contains(policyErr.URI, "#") {
+		t.Errorf("unexpected fragment in the denied URI: %s", policyErr.URI)
+	}
+}
+
+// expectAllowed fails the test if the schema URI is denied by the policy in
+// force, or if the path to read is not the expected one.
+func expectAllowed(t *testing.T, schemaUri string, expected string) {
+
+	t.Helper()
+	path, err := checkURI(t, schemaUri)
+	if err != nil {
+		t.Errorf("unexpected error for %s: %v", schemaUri, err)
+	} else if path != expected {
+		t.Errorf("unexpected path for %s: %s", schemaUri, path)
+	}
+}
+
+func TestPolicyDeniesSchemes(t *testing.T) {
+
+	enforcePolicy(t, &Policy{AllowedSchemes: []string{"GRPC+Reflect"}})
+
+	expectAllowed(t, "grpc+reflect://localhost:50051#SimpleMessage", "")
+	expectDenied(t, "file:///schemas/root.pb#SimpleMessage", RuleScheme)
+	expectDenied(t, "/schemas/root.pb#SimpleMessage", RuleScheme)
+	expectDenied(t, "https://schemas.example.com/root.pb", RuleScheme)
+
+	enforcePolicy(t, &Policy{AllowedSchemes: []string{"file"}})
+	expectAllowed(t, "file:///schemas/root.pb#SimpleMessage", "/schemas/root.pb")
+	expectAllowed(t, "schemas/root.pb#SimpleMessage", "schemas/root.pb")
+	expectDenied(t, "grpc+reflect://localhost:50051#SimpleMessage", RuleScheme)
+}
+
+func TestPolicyDeniesHosts(t *testing.T) {
+
+	enforcePolicy(t, &Policy{AllowedHosts: []string{"schemas.internal:50051", "reflection.internal"}})
+
+	expectAllowed(t, "grpc+reflect://schemas.internal:50051#SimpleMessage", "")
+	// a host name allows any port.
+	expectAllowed(t, "grpc+reflect://reflection.internal:9000#SimpleMessage", "")
+	expectDenied(t, "grpc+reflect://schemas.internal:9000#SimpleMessage", RuleHost)
+	expectDenied(t, "grpc+reflect://169.254.169.254:80#SimpleMessage", RuleHost)
+	expectDenied(t, "file://attacker.example.com/root.pb", RuleHost)
+	// URIs without host are not restricted by hosts.
+	expectAllowed(t, "file:///schemas/root.pb", "/schemas/root.pb")
+}
+
+func TestPolicyDeniesPaths(t *testing.T) {
+
+	enforcePolicy(t, &Policy{AllowedPaths: []string{"/schemas/", "/opt/protos"}})
+
+	expectAllowed(t, "file:///schemas/root.pb#SimpleMessage", "/schemas/root.pb")
+	expectAllowed(t, "/opt/protos/sub/root.pb", "/opt/protos/sub/root.pb")
+	// the prefixes match whole segments.
+	expectDenied(t, "file:///schemas-private/root.pb", RulePath)
+	expectDenied(t, "/opt/protos.bak/root.pb", RulePath)
+	expectDenied(t, "file:///etc/passwd", RulePath)
+	// the paths are cleaned before being matched.
+	expectDenied(t, "file:///schemas/../etc/passwd", RulePath)
+
+	// relative paths are matched once absolute.
+	working, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcePolicy(t, &Policy{AllowedPaths: []string{working}})
+	expectAllowed(t, "schemas/root.pb", "schemas/root.pb")
+	expectDenied(t, "../root.pb", RulePath)
+}
+
+func TestPolicySandbox(t *testing.T) {
+
+	directory := sandbox(t)
+	root := filepath.Join(directory, "root")
+	enforcePolicy(t, &Policy{SandboxRoot: root})
+
+	expectAllowed(t, "file://"+root+"/root.pb#SimpleMessage", filepath.Join(root, "root.pb"))
+	expectDenied(t, "file://"+directory+"/outside/root.pb#SimpleMessage", RuleSandbox)
+	expectDenied(t, "file:///etc/passwd", RuleSandbox)
+
+	// traversal, even when the target is in the root.
+	expectDenied(t, "file://"+root+"/../outside/root.pb", RuleSandbox)
+	expectDenied(t, "file://"+root+"/../root/root.pb", RuleSandbox)
+	expectDenied(t, root+"/sub/../root.pb", RuleSandbox)
+
+	// symbolic links escaping the root, to a file or to a directory.
+	if err := os.Symlink(filepath.Join(directory, "outside", "root.pb"), filepath.Join(root, "link.pb")); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(directory, "outside"), filepath.Join(root, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	expectDenied(t, "file://"+root+"/link.pb#SimpleMessage", RuleSandbox)
+	expectDenied(t, "file://"+root+"/linked/root.pb#SimpleMessage", RuleSandbox)
+
+	// symbolic links in the root resolve to their target.
+	if err := os.Symlink(filepath.Join(root, "root.pb"), filepath.Join(root, "alias.pb")); err != nil {
+		t.Fatal(err)
+	}
+	expectAllowed(t, "file://"+root+"/alias.pb", filepath.Join(root, "root.pb"))
+
+	// the resolution of the descriptors is denied as well.
+	if _, err := ResolveDescriptor("file://"+root+"/link.pb#SimpleMessage", true); err == nil {
+		t.Errorf("expected the resolution to be denied")
+	}
+	if _, err := ResolveDescriptor("file://"+root+"/root.pb#SimpleMessage", true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPolicySandboxRoot(t *testing.T) {
+
+	directory := sandbox(t)
+	if err := SetPolicy(&Policy{SandboxRoot: filepath.Join(directory, "missing")}); err == nil {
+		t.Errorf("expected the missing root to be rejected")
+	}
+
+	// the root is resolved without symbolic links.
+	if err := os.Symlink(filepath.Join(directory, "root"), filepath.Join(directory, "current")); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+	enforcePolicy(t, &Policy{SandboxRoot: filepath.Join(directory, "current")})
+	expectAllowed(t, "file://"+directory+"/current/root.pb", filepath.Join(directory, "root", "root.pb"))
+	expectDenied(t, "file://"+directory+"/outside/root.pb", RuleSandbox)
+}
+
+func TestConfinesFiles(t *testing.T) {
+
+	for _, test := range []struct {
+		policy   Policy
+		expected bool
+	}{
+		{Policy{}, false},
+		{Policy{AllowedHosts: []string{"localhost"}}, false},
+		{Policy{AllowedSchemes: []string{"file", "grpc+reflect"}}, false},
+		{Policy{AllowedSchemes: []string{"FILE"}}, false},
+		{Policy{AllowedSchemes: []string{"grpc+reflect"}}, true},
+		{Policy{AllowedPaths: []string{"/schemas"}}, true},
+		{Policy{SandboxRoot: "/schemas"}, true},
+	} {
+		if confines := test.policy.ConfinesFiles(); confines != test.expected {
+			t.Errorf("unexpected result for %+v: %t", test.policy, confines)
+		}
+	}
+}
+
+func TestCheckSchemaFile(t *testing.T) {
+
+	directory := sandbox(t)
+	root := filepath.Join(directory, "root")
+
+	// without policy the path is used as it is.
+	if path, err := CheckSchemaFile(filepath.Join(root, "root.pb")); err != nil || path != filepath.Join(root, "root.pb") {
+		t.Errorf("unexpected path: %s (%v)", path, err)
+	}
+
+	enforcePolicy(t, &Policy{SandboxRoot: root})
+	if path, err := CheckSchemaFile(filepath.Join(root, "root.pb")); err != nil || path != filepath.Join(root, "root.pb") {
+		t.Errorf("unexpected path: %s (%v)", path, err)
+	}
+	_, err := CheckSchemaFile(filepath.Join(directory, "outside", "root.pb"))
+	policyErr := &PolicyError{}
+	if !errors.As(err, &policyErr) || policyErr.Rule != RuleSandbox {
+		t.Errorf("expected the file to be denied, got: %v", err)
+	}
+}
+
+func TestCachedRegistriesAreChecked(t *testing.T) {
+
+	EnableRegistryCache()
+	defer func() {
+		cacheLock.Lock()
+		registries = nil
+		cacheLock.Unlock()
+	}()
+	directory := sandbox(t)
+	schemaUri := "file://" + directory + "/outside/root.pb#SimpleMessage"
+
+	if _, err := ResolveDescriptor(schemaUri, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the registry cached before the policy is not used.
+	enforcePolicy(t, &Policy{SandboxRoot: filepath.Join(directory, "root")})
+	_, err := ResolveDescriptor(schemaUri, true)
+	policyErr := &PolicyError{}
+	if !errors.As(err, &policyErr) || policyErr.Rule != RuleSandbox {
+		t.Errorf("expected the cached schema to be denied, got: %v", err)
+	}
+
+	// nor the registry cached before the trusted digests.
+	if err := SetPolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveDescriptor(schemaUri, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := TrustDigests([]string{otherDigest}); err != nil {
+		t.Fatal(err)
+	}
+	defer TrustDigests(nil)
+	_, err = ResolveDescriptor(schemaUri, true)
+	expectIntegrityError(t, "cached untrusted schema", err, "not trusted")
+}
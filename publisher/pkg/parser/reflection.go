@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"publisher/pkg/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ReflectionScheme is the scheme of the schema URIs that are resolved by
+// querying the gRPC server reflection service of the server pointed by
+// the host and port of the URI (e.g. `grpc+reflect://localhost:50051#Type`).
+const ReflectionScheme = "grpc+reflect"
+
+// ReflectionTimeout is the maximum time granted to the reflection service
+// to return the descriptors requested.
+var ReflectionTimeout = 10 * time.Second
+
+// openRegistry builds the registry of descriptors referenced by the given
+// schema URL. For the `grpc+reflect` scheme the descriptors of the files
+// defining the given symbols are fetched from the reflection service,
+// otherwise the file descriptor set pointed by the path is read. The URL
+// must be accepted by the resolver policy (see SetPolicy) beforehand.
+func openRegistry(schemaUrl *url.URL, symbols ...protoreflect.FullName) (*protoregistry.Files, error) {
+
+	path, err := checkPolicy(schemaUrl)
+	if err != nil {
+		return nil, err
+	}
+	if schemaUrl.Scheme == ReflectionScheme {
+		if err := verifyReflectionIntegrity(schemaUrl); err != nil {
+			return nil, err
+		}
+		return reflectRegistry(schemaUrl.Host, symbols)
+	}
+	return createRegistry(schemaUrl, path)
+}
+
+// reflectRegistry connects to the gRPC server reflection service exposed by
+// the server at `target` and fetches the descriptors of the files defining
+// the given symbols, together with all their transitive dependencies. When
+// no symbol is given, the files defining the services listed by the server
+// are fetched. The descriptors are then used to build the registry.
+func reflectRegistry(target string, symbols []protoreflect.FullName) (*protoregistry.Files, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), ReflectionTimeout)
+	defer cancel()
+
+	// grpc.NewClient, which supersedes DialContext, is only available from
+	// grpc-go v1.63, while the module still requires v1.51.
+	conn, err := grpc.DialContext(ctx, target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+	logging.SugarLog.Infof("Connected to reflection service (target: %s)", target)
+
+	client := reflectionClient{stream: stream, files: map[string]*descriptorpb.FileDescriptorProto{}}
+
+	if len(symbols) == 0 {
+		symbols, err = client.listServices()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, symbol := range symbols {
+		err = client.fetch(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: string(symbol)},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve symbol %s via reflection: %v", symbol, err)
+		}
+	}
+
+	// the server may omit dependencies it has already sent, or may not
+	// send them at all, hence missing files are requested by name.
+	for missing := client.missing(); len(missing) > 0; missing = client.missing() {
+		for _, name := range missing {
+			err = client.fetch(&rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not resolve file %s via reflection: %v", name, err)
+			}
+		}
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	for _, file := range client.files {
+		fds.File = append(fds.File, file)
+	}
+	logging.SugarLog.Infof("Fetched file descriptors via reflection (files: %d)", len(fds.File))
+
+	return protodesc.NewFiles(fds)
+}
+
+// reflectionClient collects the file descriptors returned by a stream of
+// the reflection service, indexed by file name.
+type reflectionClient struct {
+	stream rpb.ServerReflection_ServerReflectionInfoClient
+	files  map[string]*descriptorpb.FileDescriptorProto
+}
+
+// exchange sends the request and waits for the response, converting error
+// responses into errors.
+func (c *reflectionClient) exchange(request *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+
+	err := c.stream.Send(request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if failure := response.GetErrorResponse(); failure != nil {
+		return nil, fmt.Errorf("%s (code: %d)", failure.ErrorMessage, failure.ErrorCode)
+	}
+	return response, nil
+}
+
+// fetch sends a request for file descriptors and collects the descriptors
+// contained in the response.
+func (c *reflectionClient) fetch(request *rpb.ServerReflectionRequest) error {
+
+	response, err := c.exchange(request)
+	if err != nil {
+		return err
+	}
+	descriptors := response.GetFileDescriptorResponse()
+	if descriptors == nil {
+		return fmt.Errorf("unexpected response from reflection service")
+	}
+	for _, data := range descriptors.FileDescriptorProto {
+		file := &descriptorpb.FileDescriptorProto{}
+		err = proto.Unmarshal(data, file)
+		if err != nil {
+			return err
+		}
+		c.files[file.GetName()] = file
+	}
+	return nil
+}
+
+// listServices returns the full names of the services exposed by the
+// server.
+func (c *reflectionClient) listServices() ([]protoreflect.FullName, error) {
+
+	response, err := c.exchange(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	services := response.GetListServicesResponse()
+	if services == nil {
+		return nil, fmt.Errorf("unexpected response from reflection service")
+	}
+	names := []protoreflect.FullName{}
+	for _, service := range services.Service {
+		names = append(names, protoreflect.FullName(service.Name))
+	}
+	return names, nil
+}
+
+// missing returns the names of the dependencies of the collected files
+// that have not been collected yet.
+func (c *reflectionClient) missing() []string {
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, file := range c.files {
+		for _, dependency := range file.Dependency {
+			if _, isPresent := c.files[dependency]; !isPresent && !seen[dependency] {
+				seen[dependency] = true
+				names = append(names, dependency)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	events "publisher/pkg/events/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// startReflectionServer starts an in-process gRPC server exposing the
+// reflection service, which serves the descriptors of the linked types, and
+// returns its address.
+func startReflectionServer(t *testing.T) string {
+
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	reflection.Register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+// startSilentServer starts a TCP server that accepts connections and never
+// replies, and returns its address.
+func startSilentServer(t *testing.T) string {
+
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the accepting goroutine owns the channel, and closes it once the
+	// listener is closed, so that no connection is sent after the close.
+	connections := make(chan net.Conn, 16)
+	go func() {
+		defer close(connections)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connections <- conn
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		for conn := range connections {
+			conn.Close()
+		}
+	})
+	return listener.Addr().String()
+}
+
+func TestResolveThroughReflection(t *testing.T) {
+
+	address := startReflectionServer(t)
+	md, err := ResolveDescriptor(ReflectionScheme+"://"+address+"#SimpleMessage", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	linked := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	if md.FullName() != linked.FullName() || md.Fields().Len() != linked.Fields().Len() {
+		t.Errorf("unexpected descriptor: %s (%d fields)", md.FullName(), md.Fields().Len())
+	}
+	// the descriptor is resolved from the reflection service, not linked.
+	if md == linked {
+		t.Errorf("the descriptor was not fetched via reflection")
+	}
+}
+
+func TestResolveThroughReflectionWithDependencies(t *testing.T) {
+
+	address := startReflectionServer(t)
+	md, err := ResolveDescriptor(ReflectionScheme+"://"+address+"#ImportMessage", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	timestamp := md.Fields().ByName("param_01")
+	if timestamp == nil || timestamp.Message() == nil || timestamp.Message().FullName() != "google.protobuf.Timestamp" {
+		t.Errorf("the imported types were not resolved: %v", timestamp)
+	}
+}
+
+func TestLoadRegistryThroughReflectionListsServices(t *testing.T) {
+
+	address := startReflectionServer(t)
+	registry, err := LoadRegistry(ReflectionScheme + "://" + address)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	descriptor, err := registry.FindDescriptorByName("grpc.reflection.v1alpha.ServerReflection")
+	if err != nil {
+		t.Fatalf("the services of the server were not fetched: %v", err)
+	}
+	if _, isService := descriptor.(protoreflect.ServiceDescriptor); !isService {
+		t.Errorf("unexpected descriptor: %v", descriptor)
+	}
+}
+
+func TestReflectionUnknownSymbol(t *testing.T) {
+
+	address := startReflectionServer(t)
+	_, err := ResolveDescriptor(ReflectionScheme+"://"+address+"#DoesNotExist", true)
+	if err == nil || !strings.Contains(err.Error(), "could not resolve symbol "+string(QualifiedName("DoesNotExist"))) {
+		t.Fatalf("expected the unknown symbol to be reported, got: %v", err)
+	}
+}
+
+func TestReflectionTimeout(t *testing.T) {
+
+	previous := ReflectionTimeout
+	ReflectionTimeout = 200 * time.Millisecond
+	defer func() { ReflectionTimeout = previous }()
+
+	address := startSilentServer(t)
+	started := time.Now()
+	_, err := ResolveDescriptor(ReflectionScheme+"://"+address+"#SimpleMessage", true)
+	if err == nil {
+		t.Fatal("expected the resolution to time out")
+	}
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Errorf("expected a deadline error, got: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("the timeout was not honoured (%v)", elapsed)
+	}
+}
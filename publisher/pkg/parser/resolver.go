@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"publisher/pkg/compat"
+	"publisher/pkg/logging"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Strategies of resolution of the message descriptors.
+const (
+	// ResolutionStatic resolves the message types among the types linked
+	// to the executable, ignoring the location of the schema.
+	ResolutionStatic = "static"
+	// ResolutionDynamic resolves the message types from the descriptors
+	// loaded from the location of the schema.
+	ResolutionDynamic = "dynamic"
+	// ResolutionHybrid prefers the types linked to the executable, and
+	// falls back to the descriptors loaded from the location of the schema
+	// for the types that are not linked. When both are available the two
+	// descriptors are compared, and the differences reported as drift.
+	ResolutionHybrid = "hybrid"
+)
+
+// Policies applied to the drift detected in hybrid resolution.
+const (
+	// DriftWarn logs the differences and uses the linked type.
+	DriftWarn = "warn"
+	// DriftFail rejects the messages whose linked type differs from the
+	// descriptor loaded from the schema.
+	DriftFail = "error"
+	// DriftIgnore uses the linked type without comparing the descriptors.
+	DriftIgnore = "ignore"
+)
+
+// Resolution is the strategy of resolution of the message descriptors. When
+// it is empty, the `isDynamic` argument of the parsing functions selects the
+// static or the dynamic resolution, otherwise the strategy overrides it.
+var Resolution = ""
+
+// DriftPolicy is the policy applied to the drift detected between the linked
+// types and the descriptors loaded from the schemas in hybrid resolution.
+var DriftPolicy = DriftWarn
+
+// Resolutions returns the names of the strategies of resolution.
+func Resolutions() []string {
+	return []string{ResolutionStatic, ResolutionDynamic, ResolutionHybrid}
+}
+
+// DriftPolicies returns the names of the policies applied to the drift.
+func DriftPolicies() []string {
+	return []string{DriftWarn, DriftFail, DriftIgnore}
+}
+
+// CheckResolution verifies that the given strategy of resolution and drift
+// policy are known. An empty strategy is accepted and means that the choice
+// is left to the callers of the parsing functions.
+func CheckResolution(resolution string, policy string) error {
+
+	if !contains(append(Resolutions(), ""), resolution) {
+		return fmt.Errorf("unknown resolution: '%s' (expected %s)", resolution, strings.Join(Resolutions(), ", "))
+	}
+	if !contains(DriftPolicies(), policy) {
+		return fmt.Errorf("unknown drift policy: '%s' (expected %s)", policy, strings.Join(DriftPolicies(), ", "))
+	}
+	return nil
+}
+
+// DriftError is the error returned in hybrid resolution, when the drift policy
+// is DriftFail, for message types whose linked descriptor differs from the one
+// loaded from the schema.
+type DriftError struct {
+	// Type is the full name of the message type.
+	Type protoreflect.FullName
+	// Report lists the differences between the linked descriptor (previous)
+	// and the descriptor loaded from the schema (current).
+	Report *compat.Report
+}
+
+// Error lists the differences detected.
+func (e *DriftError) Error() string {
+
+	lines := []string{}
+	for _, change := range e.Report.Changes {
+		lines = append(lines, change.String())
+	}
+	return fmt.Sprintf("linked type %s drifted from its schema (%d difference(s)):\n%s", e.Type, len(lines), strings.Join(lines, "\n"))
+}
+
+// resolveStatic looks up the message type identified by the given fragment of
+// a schema URI (a simple name expanded with FullNameFormat, or a fully
+// qualified name) among the types linked to the executable.
+func resolveStatic(fragment string) (protoreflect.MessageDescriptor, error) {
+
+	logging.SugarLog.Info("Using STATIC type resolution, via compiled types descriptor")
+
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(QualifiedName(fragment))
+	if err != nil {
+		return nil, fmt.Errorf("no message matching type: %s", fragment)
+	}
+	return messageType.Descriptor(), nil
+}
+
+// resolveHybrid resolves the message type identified by the fragment of the
+// given schema URI among the linked types first, and from the schema when the
+// type is not linked. When both descriptors are available, the differences
+// between them are handled according to the drift policy. The linked type is
+// also used when the schema does not declare it, while the errors loading the
+// schema are returned, so that schemas denied by the policy (PolicyError) or
+// failing their integrity check (IntegrityError) fail the resolution.
+func resolveHybrid(schemaUrl *url.URL) (protoreflect.MessageDescriptor, error) {
+
+	linked, err := resolveStatic(schemaUrl.Fragment)
+	if err != nil {
+		logging.SugarLog.Infof("Type %s is not linked, falling back to the schema", schemaUrl.Fragment)
+		return resolveDynamic(schemaUrl)
+	}
+	if DriftPolicy == DriftIgnore {
+		return linked, nil
+	}
+
+	loaded, err := resolveDynamic(schemaUrl)
+	if errors.Is(err, protoregistry.NotFound) {
+		logging.SugarLog.Warnf("Type %s is not declared by the schema, using the linked type", linked.FullName())
+		return linked, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := compat.CompareMessages(linked, loaded, compat.Full)
+	if len(report.Changes) == 0 {
+		return linked, nil
+	}
+	if DriftPolicy == DriftFail {
+		return nil, &DriftError{Type: linked.FullName(), Report: report}
+	}
+	for _, change := range report.Changes {
+		logging.SugarLog.Warnf("Linked type %s drifted from its schema: %s", linked.FullName(), change)
+	}
+	return linked, nil
+}
+
+// contains determines whether the given value is among the values.
+func contains(values []string, value string) bool {
+
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
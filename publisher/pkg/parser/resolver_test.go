@@ -0,0 +1,229 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"publisher/pkg/bundle"
+	events "publisher/pkg/events/v1"
+	"publisher/pkg/export"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// withResolution sets the strategy of resolution and the drift policy for
+// the duration of the test.
+func withResolution(t *testing.T, resolution string, policy string) {
+
+	t.Helper()
+	previousResolution, previousPolicy := Resolution, DriftPolicy
+	t.Cleanup(func() { Resolution, DriftPolicy = previousResolution, previousPolicy })
+	Resolution, DriftPolicy = resolution, policy
+}
+
+// driftedSchemaURI writes the schema of the sample messages, where the
+// simple message is changed by `drift`, and returns its schema URI without
+// fragment. The schema also declares `UnlinkedMessage`, which is not linked
+// to the executable.
+func driftedSchemaURI(t *testing.T, drift func(*descriptorpb.DescriptorProto)) string {
+
+	t.Helper()
+	set, err := bundle.Build((&events.SimpleMessage{}).ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range set.File {
+		for _, message := range file.MessageType {
+			if message.GetName() == "SimpleMessage" {
+				drift(message)
+				unlinked := proto.Clone(message).(*descriptorpb.DescriptorProto)
+				unlinked.Name = proto.String("UnlinkedMessage")
+				file.MessageType = append(file.MessageType, unlinked)
+				break
+			}
+		}
+	}
+	data, err := export.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "drifted.pb")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + path
+}
+
+// renameField renames the first field of the message.
+func renameField(message *descriptorpb.DescriptorProto) {
+
+	message.Field[0].Name = proto.String("param_01_renamed")
+	message.Field[0].JsonName = proto.String("param01Renamed")
+}
+
+// retypeField changes the type of the `int32` field of the message into a
+// string.
+func retypeField(message *descriptorpb.DescriptorProto) {
+
+	for _, field := range message.Field {
+		if field.GetName() == "param_04" {
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+		}
+	}
+}
+
+func TestResolveStatic(t *testing.T) {
+
+	withResolution(t, ResolutionStatic, DriftWarn)
+	linked := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+
+	// the location of the schema is ignored, even for dynamic callers.
+	for _, schemaUri := range []string{
+		"file:///missing/root.pb#SimpleMessage",
+		"file:///missing/root.pb#hyp0th3rmi4.protobuf.sample.SimpleMessage",
+	} {
+		md, err := ResolveDescriptor(schemaUri, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if md != linked {
+			t.Errorf("%s: the linked type was not used", schemaUri)
+		}
+	}
+
+	if _, err := ResolveDescriptor(driftedSchemaURI(t, renameField)+"#UnlinkedMessage", true); err == nil || !strings.Contains(err.Error(), "no message matching type: UnlinkedMessage") {
+		t.Errorf("expected the type to be missing, got: %v", err)
+	}
+
+	// without a strategy, the caller chooses.
+	withResolution(t, "", DriftWarn)
+	md, err := ResolveDescriptor(driftedSchemaURI(t, renameField)+"#SimpleMessage", false)
+	if err != nil || md != linked {
+		t.Errorf("the linked type was not used (error: %v)", err)
+	}
+	md, err = ResolveDescriptor(driftedSchemaURI(t, renameField)+"#SimpleMessage", true)
+	if err != nil || md == linked || md.Fields().ByName("param_01_renamed") == nil {
+		t.Errorf("the type was not loaded from the schema (error: %v)", err)
+	}
+}
+
+func TestResolveHybridFallback(t *testing.T) {
+
+	withResolution(t, ResolutionHybrid, DriftFail)
+	linked := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	schemaUri := driftedSchemaURI(t, func(*descriptorpb.DescriptorProto) {})
+
+	// types that are not linked are loaded from the schema.
+	md, err := ResolveDescriptor(schemaUri+"#UnlinkedMessage", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if md.FullName() != "hyp0th3rmi4.protobuf.sample.UnlinkedMessage" || md.Fields().Len() != linked.Fields().Len() {
+		t.Errorf("unexpected descriptor: %s", md.FullName())
+	}
+
+	// linked types matching the schema are used as they are.
+	md, err = ResolveDescriptor(schemaUri+"#SimpleMessage", false)
+	if err != nil || md != linked {
+		t.Errorf("the linked type was not used (error: %v)", err)
+	}
+
+	// linked types are used when the schema does not declare them.
+	other := "file://" + writeSchema(t, t.TempDir(), (&events.SubMessage{}).ProtoReflect().Descriptor())
+	md, err = ResolveDescriptor(other+"#SimpleMessage", false)
+	if err != nil || md != linked {
+		t.Errorf("the linked type was not used (error: %v)", err)
+	}
+
+	// but not when the schema cannot be loaded.
+	if _, err := ResolveDescriptor("file:///missing/root.pb#SimpleMessage", false); err == nil {
+		t.Errorf("expected the schema to be missing")
+	}
+
+	// types that are neither linked nor in the schema are missing.
+	if _, err := ResolveDescriptor(schemaUri+"#MissingMessage", false); err == nil {
+		t.Errorf("expected the type to be missing")
+	}
+	if _, err := ResolveDescriptor("file:///missing/root.pb#UnlinkedMessage", false); err == nil {
+		t.Errorf("expected the schema to be missing")
+	}
+}
+
+func TestResolveHybridDrift(t *testing.T) {
+
+	linked := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	for _, test := range []struct {
+		name   string
+		drift  func(*descriptorpb.DescriptorProto)
+		change string
+	}{
+		{"renamed field", renameField, "field 1 renamed from 'param_01' to 'param_01_renamed'"},
+		{"retyped field", retypeField, "type changed from int32 to string"},
+	} {
+		schemaUri := driftedSchemaURI(t, test.drift) + "#SimpleMessage"
+
+		// the drift is reported, and the linked type used.
+		for _, policy := range []string{DriftWarn, DriftIgnore} {
+			withResolution(t, ResolutionHybrid, policy)
+			md, err := ResolveDescriptor(schemaUri, false)
+			if err != nil || md != linked {
+				t.Errorf("%s (%s): the linked type was not used (error: %v)", test.name, policy, err)
+			}
+		}
+
+		// the drift is rejected.
+		withResolution(t, ResolutionHybrid, DriftFail)
+		_, err := ResolveDescriptor(schemaUri, false)
+		driftErr := &DriftError{}
+		if !errors.As(err, &driftErr) {
+			t.Errorf("%s: expected a drift error, got: %v", test.name, err)
+			continue
+		}
+		if driftErr.Type != linked.FullName() || len(driftErr.Report.Changes) == 0 {
+			t.Errorf("%s: unexpected error: %+v", test.name, driftErr)
+		}
+		if !strings.Contains(driftErr.Error(), "linked type hyp0th3rmi4.protobuf.sample.SimpleMessage drifted from its schema") || !strings.Contains(driftErr.Error(), test.change) {
+			t.Errorf("%s: unexpected message: %s", test.name, driftErr.Error())
+		}
+	}
+}
+
+func TestResolveHybridReturnsSchemaErrors(t *testing.T) {
+
+	withResolution(t, ResolutionHybrid, DriftFail)
+	schemaUri, _ := pinnedSchemaURI(t)
+
+	// a schema failing its integrity check fails the resolution of the
+	// linked types too, as with dynamic resolution.
+	_, err := ResolveDescriptor(schemaUri+"?sha256="+otherDigest+"#SimpleMessage", false)
+	expectIntegrityError(t, "mismatch", err, "does not match")
+
+	// and so does a schema denied by the policy.
+	enforcePolicy(t, &Policy{AllowedSchemes: []string{ReflectionScheme}})
+	_, err = ResolveDescriptor(schemaUri+"#SimpleMessage", false)
+	policyErr := &PolicyError{}
+	if !errors.As(err, &policyErr) || policyErr.Rule != RuleScheme {
+		t.Errorf("expected the schema to be denied by the scheme rule, got: %v", err)
+	}
+}
+
+func TestCheckResolution(t *testing.T) {
+
+	for _, resolution := range append(Resolutions(), "") {
+		for _, policy := range DriftPolicies() {
+			if err := CheckResolution(resolution, policy); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	}
+	if err := CheckResolution("lazy", DriftWarn); err == nil || !strings.Contains(err.Error(), "unknown resolution: 'lazy'") {
+		t.Errorf("expected the resolution to be rejected, got: %v", err)
+	}
+	if err := CheckResolution(ResolutionHybrid, "panic"); err == nil || !strings.Contains(err.Error(), "unknown drift policy: 'panic'") {
+		t.Errorf("expected the policy to be rejected, got: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"publisher/pkg/confluent"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Attributes set by Pub/Sub on the messages published to topics that are
+// associated with a schema.
+const (
+	// SchemaNameAttribute is the full name of the schema
+	// (e.g. `projects/my-project/schemas/my-schema`).
+	SchemaNameAttribute = "googclient_schemaname"
+	// SchemaRevisionAttribute is the identifier of the revision of the
+	// schema used to validate the message.
+	SchemaRevisionAttribute = "googclient_schemarevisionid"
+	// SchemaEncodingAttribute is the encoding of the message data.
+	SchemaEncodingAttribute = "googclient_schemaencoding"
+)
+
+// Encodings of the message data supported by Pub/Sub.
+const (
+	// EncodingBinary identifies data encoded as protobuf binary.
+	EncodingBinary = "BINARY"
+	// EncodingJSON identifies data encoded as protobuf JSON.
+	EncodingJSON = "JSON"
+)
+
+// Message is the JSON representation of a Pub/Sub message, where the data
+// is encoded in base64.
+type Message struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	MessageID   string            `json:"messageId,omitempty"`
+	PublishTime string            `json:"publishTime,omitempty"`
+}
+
+// Schema identifies the revision of a Pub/Sub schema and the encoding of
+// the data of the messages.
+type Schema struct {
+	Name       string
+	RevisionID string
+	Encoding   string
+}
+
+// Attributes returns the attributes describing the schema of a message.
+func (s Schema) Attributes() map[string]string {
+
+	attributes := map[string]string{SchemaNameAttribute: s.Name, SchemaEncodingAttribute: s.Encoding}
+	if len(s.RevisionID) > 0 {
+		attributes[SchemaRevisionAttribute] = s.RevisionID
+	}
+	return attributes
+}
+
+// Unmarshal interprets the given JSON document as a Pub/Sub message. Both
+// the message and the body of push requests, which wraps the message into
+// the `message` attribute, are accepted.
+func Unmarshal(data []byte) (map[string]interface{}, *Message, error) {
+
+	container := map[string]interface{}{}
+	err := json.Unmarshal(data, &container)
+	if err != nil {
+		return nil, nil, err
+	}
+	if wrapped, isPush := container["message"].(map[string]interface{}); isPush {
+		container = wrapped
+		data, _ = json.Marshal(wrapped)
+	}
+
+	message := &Message{}
+	err = json.Unmarshal(data, message)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, isPresent := message.Attributes[SchemaNameAttribute]; !isPresent {
+		return nil, nil, fmt.Errorf("the message does not define the '%s' attribute", SchemaNameAttribute)
+	}
+	return container, message, nil
+}
+
+// Marshal encodes the given message into a Pub/Sub message carrying the
+// attributes of the schema.
+func Marshal(message protoreflect.ProtoMessage, schema Schema, options proto.MarshalOptions) (*Message, error) {
+
+	var data []byte
+	var err error
+	switch schema.Encoding {
+	case EncodingBinary:
+		data, err = options.Marshal(message)
+	case EncodingJSON:
+		data, err = protojson.Marshal(message)
+	default:
+		err = fmt.Errorf("unknown schema encoding: '%s' (expected %s or %s)", schema.Encoding, EncodingBinary, EncodingJSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Data: data, Attributes: schema.Attributes()}, nil
+}
+
+// SchemaDirectory maps the revisions of Pub/Sub schemas to the descriptors
+// of their messages, by looking up the schemas in a local directory. The
+// schema `projects/p/schemas/s` with revision `r` is looked up, in order, in:
+//
+//   - `<directory>/s/r.proto` or `<directory>/s/r.pb`
+//   - `<directory>/s.proto` or `<directory>/s.pb`
+//
+// where `.proto` files are the source of the schema, and `.pb` files are
+// file descriptor sets whose last file is the schema. Following the rules
+// of Pub/Sub, the message of the schema is its first top-level message.
+// Since the schema and the revision are taken from the attributes of the
+// messages, those that are not plain file names (e.g. `..`) are rejected.
+// The files found are also subject to the PathCheck of the directory, if
+// any, which is applied on every lookup, including those served from the
+// schemas already loaded.
+type SchemaDirectory struct {
+	directory string
+	check     PathCheck
+
+	lock        sync.Mutex
+	descriptors map[string]schemaFile
+}
+
+// PathCheck verifies the path of a schema file before it is used, and returns
+// the path of the file to read (e.g. without symbolic links), or an error if
+// the file must not be used.
+type PathCheck func(path string) (string, error)
+
+// schemaFile is a schema loaded from the directory, with the path of the
+// file it was found in.
+type schemaFile struct {
+	path string
+	md   protoreflect.MessageDescriptor
+}
+
+// NewSchemaDirectory creates a lookup of schemas in the given directory,
+// whose files are verified by the given check (or used as they are, when
+// the check is nil).
+func NewSchemaDirectory(directory string, check PathCheck) *SchemaDirectory {
+
+	return &SchemaDirectory{directory: directory, check: check, descriptors: map[string]schemaFile{}}
+}
+
+// Resolve returns the descriptor of the message defined by the given
+// revision of the schema.
+func (d *SchemaDirectory) Resolve(name string, revision string) (protoreflect.MessageDescriptor, error) {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := name + "@" + revision
+	if file, isPresent := d.descriptors[key]; isPresent {
+		if _, err := d.checkPath(file.path); err != nil {
+			return nil, err
+		}
+		return file.md, nil
+	}
+
+	id := name[strings.LastIndex(name, "/")+1:]
+	err := checkSegment("schema identifier", id)
+	if err == nil && len(revision) > 0 {
+		err = checkSegment("schema revision", revision)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{}
+	if len(revision) > 0 {
+		candidates = append(candidates, filepath.Join(d.directory, id, revision+".proto"), filepath.Join(d.directory, id, revision+".pb"))
+	}
+	candidates = append(candidates, filepath.Join(d.directory, id+".proto"), filepath.Join(d.directory, id+".pb"))
+
+	for _, candidate := range candidates {
+		if !isWithin(d.directory, candidate) {
+			return nil, fmt.Errorf("schema %s (revision: '%s') resolves outside of %s", name, revision, d.directory)
+		}
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		path, err := d.checkPath(candidate)
+		if err != nil {
+			return nil, err
+		}
+		fd, err := loadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load schema %s: %v", candidate, err)
+		}
+		if fd.Messages().Len() == 0 {
+			return nil, fmt.Errorf("schema %s does not define any message", candidate)
+		}
+		md := fd.Messages().Get(0)
+		d.descriptors[key] = schemaFile{path: candidate, md: md}
+		return md, nil
+	}
+	return nil, fmt.Errorf("no schema found for %s (revision: '%s') in %s", name, revision, d.directory)
+}
+
+// checkPath verifies the given path of a schema file with the check of the
+// directory, if any, and returns the path of the file to read.
+func (d *SchemaDirectory) checkPath(path string) (string, error) {
+
+	if d.check == nil {
+		return path, nil
+	}
+	return d.check(path)
+}
+
+// checkSegment verifies that the given value, which is taken from the
+// attributes of a message, can be used as a single element of a path: the
+// attributes are set by whoever publishes the message, and must not lead
+// the lookup outside of the directory of schemas.
+func checkSegment(kind string, value string) error {
+
+	if len(value) == 0 || value == "." || value == ".." || strings.ContainsAny(value, "/\\\x00") {
+		return fmt.Errorf("invalid %s: '%s'", kind, value)
+	}
+	return nil
+}
+
+// isWithin determines whether the given path, once cleaned, is located
+// under the directory.
+func isWithin(directory string, path string) bool {
+
+	relative, err := filepath.Rel(filepath.Clean(directory), filepath.Clean(path))
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) && !filepath.IsAbs(relative)
+}
+
+// Decode resolves the schema of the given message and decodes its data
+// according to the encoding declared by the attributes.
+func (d *SchemaDirectory) Decode(message *Message) (*dynamicpb.Message, error) {
+
+	md, err := d.Resolve(message.Attributes[SchemaNameAttribute], message.Attributes[SchemaRevisionAttribute])
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	switch encoding := message.Attributes[SchemaEncodingAttribute]; encoding {
+	case EncodingBinary:
+		err = proto.Unmarshal(message.Data, msg)
+	case EncodingJSON:
+		err = protojson.Unmarshal(message.Data, msg)
+	default:
+		err = fmt.Errorf("unknown schema encoding: '%s' (expected %s or %s)", encoding, EncodingBinary, EncodingJSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// loadFile reads the schema stored in the given path, either as source
+// (`.proto`) or as file descriptor set (`.pb`).
+func loadFile(path string) (protoreflect.FileDescriptor, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if filepath.Ext(path) == ".proto" {
+		name := filepath.Base(path)
+		return confluent.Compile(name, map[string]string{name: string(data)})
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	err = proto.Unmarshal(data, fds)
+	if err != nil {
+		return nil, err
+	}
+	if len(fds.File) == 0 {
+		return nil, errors.New("empty file descriptor set")
+	}
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, err
+	}
+	return files.FindFileByPath(fds.File[len(fds.File)-1].GetName())
+}
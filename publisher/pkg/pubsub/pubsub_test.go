@@ -0,0 +1,136 @@
+package pubsub
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeFile writes the given content to the path, creating its directory.
+func writeFile(t *testing.T, path string, content string) {
+
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestDirectory creates a directory of schemas containing the schema `s`
+// (with the revision `r1`), next to a schema that is outside of it.
+func newTestDirectory(t *testing.T) string {
+
+	root := t.TempDir()
+	directory := filepath.Join(root, "schemas")
+	writeFile(t, filepath.Join(directory, "s.proto"), `syntax = "proto3"; package test; message Latest { string name = 1; }`)
+	writeFile(t, filepath.Join(directory, "s", "r1.proto"), `syntax = "proto3"; package test; message Revision { string name = 1; }`)
+	writeFile(t, filepath.Join(root, "secret.proto"), `syntax = "proto3"; package test; message Secret { string name = 1; }`)
+	writeFile(t, filepath.Join(directory, "s", "secret.proto"), `syntax = "proto3"; package test; message Nested { string name = 1; }`)
+	return directory
+}
+
+func TestSchemaDirectoryResolve(t *testing.T) {
+
+	schemas := NewSchemaDirectory(newTestDirectory(t), nil)
+
+	md, err := schemas.Resolve("projects/p/schemas/s", "r1")
+	if err != nil || md.FullName() != "test.Revision" {
+		t.Errorf("unexpected revision: %v (%v)", md, err)
+	}
+	md, err = schemas.Resolve("projects/p/schemas/s", "r2")
+	if err != nil || md.FullName() != "test.Latest" {
+		t.Errorf("the schema was not used for an unknown revision: %v (%v)", md, err)
+	}
+	if _, err := schemas.Resolve("projects/p/schemas/other", ""); err == nil || !strings.Contains(err.Error(), "no schema found") {
+		t.Errorf("expected the schema not to be found, got: %v", err)
+	}
+}
+
+func TestSchemaDirectoryRejectsTraversal(t *testing.T) {
+
+	schemas := NewSchemaDirectory(newTestDirectory(t), nil)
+
+	for _, test := range []struct{ name, revision string }{
+		{"projects/p/schemas/..", ""},
+		{"projects/p/schemas/.", ""},
+		{"projects/p/schemas/", ""},
+		{"projects/p/schemas/s", "../../secret"},
+		{"projects/p/schemas/s", "../secret"},
+		{"projects/p/schemas/s", ".."},
+		{"projects/p/schemas/s", "."},
+		{"projects/p/schemas/s", "r1/../../../secret"},
+		{"projects/p/schemas/..\\secret", ""},
+		{"projects/p/schemas/s", "..\\..\\secret"},
+		{"projects/p/schemas/s", "r1\x00"},
+	} {
+		md, err := schemas.Resolve(test.name, test.revision)
+		if err == nil || !strings.Contains(err.Error(), "invalid schema") {
+			t.Errorf("expected %s (revision: %q) to be rejected, got: %v (%v)", test.name, test.revision, md, err)
+		}
+	}
+}
+
+func TestSchemaDirectoryDecode(t *testing.T) {
+
+	schemas := NewSchemaDirectory(newTestDirectory(t), nil)
+	md, err := schemas.Resolve("projects/p/schemas/s", "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("name"), protoreflect.ValueOfString("alice"))
+
+	for _, encoding := range []string{EncodingBinary, EncodingJSON} {
+		message, err := Marshal(msg, Schema{Name: "projects/p/schemas/s", RevisionID: "r1", Encoding: encoding}, proto.MarshalOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := schemas.Decode(message)
+		if err != nil {
+			t.Fatalf("unexpected error (encoding: %s): %v", encoding, err)
+		}
+		if !proto.Equal(decoded, msg) {
+			t.Errorf("unexpected message (encoding: %s): %v", encoding, decoded)
+		}
+	}
+}
+
+func TestSchemaDirectoryChecksPaths(t *testing.T) {
+
+	directory := newTestDirectory(t)
+	checked := []string{}
+	isDenied := false
+	schemas := NewSchemaDirectory(directory, func(path string) (string, error) {
+		checked = append(checked, path)
+		if isDenied {
+			return "", errors.New("denied")
+		}
+		return path, nil
+	})
+
+	if _, err := schemas.Resolve("projects/p/schemas/s", "r1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(checked) != 1 || checked[0] != filepath.Join(directory, "s", "r1.proto") {
+		t.Errorf("unexpected paths checked: %v", checked)
+	}
+
+	// the check applies to the schemas already loaded too.
+	isDenied = true
+	for _, revision := range []string{"r1", "r2"} {
+		if _, err := schemas.Resolve("projects/p/schemas/s", revision); err == nil || err.Error() != "denied" {
+			t.Errorf("expected revision %s to be denied, got: %v", revision, err)
+		}
+	}
+	if len(checked) != 3 {
+		t.Errorf("unexpected paths checked: %v", checked)
+	}
+}
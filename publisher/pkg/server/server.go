@@ -0,0 +1,297 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"publisher/pkg/confluent"
+	"publisher/pkg/logging"
+	"publisher/pkg/parser"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// SchemaHeader is the header that carries the schema URI (with the message
+// type as fragment) of requests whose body is a raw protobuf binary.
+const SchemaHeader = "X-Schema-URI"
+
+// Default limits applied by the server.
+const (
+	// DefaultMaxBodySize is the default maximum size of a request body.
+	DefaultMaxBodySize = 1 << 20
+	// DefaultMaxConcurrency is the default maximum number of requests
+	// decoded at the same time.
+	DefaultMaxConcurrency = 16
+	// DefaultShutdownTimeout is the default time granted to the requests
+	// in flight to complete when the server shuts down.
+	DefaultShutdownTimeout = 10 * time.Second
+	// DefaultReadHeaderTimeout is the default time granted to clients to
+	// send the headers of a request.
+	DefaultReadHeaderTimeout = 10 * time.Second
+	// DefaultReadTimeout is the default time granted to clients to send
+	// a whole request, including its body.
+	DefaultReadTimeout = 30 * time.Second
+)
+
+// Options configures the server.
+type Options struct {
+	// Address is the TCP address the server listens on (e.g. `:8080`).
+	Address string
+	// IsDynamic determines whether messages are decoded with the type
+	// descriptors referenced by their schema or with static types.
+	IsDynamic bool
+	// SchemaURI is the schema used for raw protobuf requests that do
+	// not carry the SchemaHeader, if any.
+	SchemaURI string
+	// Registry is the Schema Registry resolving raw protobuf requests
+	// framed according to the Confluent wire format, if any.
+	Registry *confluent.Registry
+	// ForwardURL is the endpoint the JSON form of the decoded messages
+	// is posted to. When empty, the JSON form is sent as the response.
+	ForwardURL string
+	// MaxBodySize is the maximum size in bytes of a request body, larger
+	// requests are rejected with `413 Request Entity Too Large`.
+	MaxBodySize int64
+	// MaxConcurrency is the maximum number of requests decoded at the
+	// same time, further requests are rejected with `503 Service
+	// Unavailable` until a slot frees up.
+	MaxConcurrency int
+	// ShutdownTimeout is the time granted to the requests in flight to
+	// complete when the server shuts down.
+	ShutdownTimeout time.Duration
+	// ReadHeaderTimeout is the time granted to clients to send the
+	// headers of a request, which protects the server from clients
+	// holding connections open by sending headers slowly.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is the time granted to clients to send a whole
+	// request, including its body.
+	ReadTimeout time.Duration
+}
+
+// Server is an HTTP endpoint decoding the protobuf messages it receives,
+// which can be CloudEvents in structured mode (`application/cloudevents+json`),
+// CloudEvents in binary mode (attributes carried by `ce-` headers and the
+// protobuf binary as body), or raw protobuf binaries whose schema is given
+// by the SchemaHeader (or by the Schema Registry, when they are framed
+// according to the Confluent wire format). The JSON form of the messages
+// (the same produced by the `parse` command) is either sent back as
+// response or forwarded.
+type Server struct {
+	options Options
+	slots   chan struct{}
+	client  *http.Client
+}
+
+// New creates a server configured with the given options. Limits that are
+// not set are replaced by their defaults.
+func New(options Options) *Server {
+
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultMaxBodySize
+	}
+	if options.MaxConcurrency <= 0 {
+		options.MaxConcurrency = DefaultMaxConcurrency
+	}
+	if options.ShutdownTimeout <= 0 {
+		options.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if options.ReadHeaderTimeout <= 0 {
+		options.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if options.ReadTimeout <= 0 {
+		options.ReadTimeout = DefaultReadTimeout
+	}
+	return &Server{
+		options: options,
+		slots:   make(chan struct{}, options.MaxConcurrency),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Run listens for requests until the given context is cancelled, then shuts
+// the server down gracefully: the listener is closed and the requests in
+// flight are granted the shutdown timeout to complete.
+func (s *Server) Run(ctx context.Context) error {
+
+	server := &http.Server{
+		Addr:              s.options.Address,
+		Handler:           s,
+		ReadHeaderTimeout: s.options.ReadHeaderTimeout,
+		ReadTimeout:       s.options.ReadTimeout,
+	}
+
+	failure := make(chan error, 1)
+	go func() {
+		logging.SugarLog.Infof("Listening for messages (address: %s)", s.options.Address)
+		failure <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-failure:
+		return err
+	case <-ctx.Done():
+	}
+
+	logging.SugarLog.Info("Shutting down server")
+	shutdown, cancel := context.WithTimeout(context.Background(), s.options.ShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdown)
+}
+
+// ServeHTTP decodes the message carried by the request and replies with, or
+// forwards, its JSON form.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet && r.URL.Path == "/healthz" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		replyError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		replyError(w, http.StatusServiceUnavailable, errors.New("too many concurrent requests"))
+		return
+	}
+
+	body, err := s.readBody(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errBodyTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		replyError(w, status, err)
+		return
+	}
+
+	result, err := s.decode(r, body)
+	if err != nil {
+		logging.SugarLog.Infof("Could not decode message: %v", err)
+		replyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		replyError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(s.options.ForwardURL) > 0 {
+		status, err := s.forward(data)
+		if err != nil {
+			replyError(w, http.StatusBadGateway, err)
+			return
+		}
+		logging.SugarLog.Infof("Forwarded message (endpoint: %s, status: %d)", s.options.ForwardURL, status)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// errBodyTooLarge is returned when a request body exceeds the maximum size.
+var errBodyTooLarge = errors.New("request body too large")
+
+// readBody reads the body of the request, which must not exceed the maximum
+// size. A byte more than the maximum is read, so that bodies exceeding the
+// limit are told apart from bodies that could not be read (e.g. because the
+// client sent a truncated body, or did not send it in time).
+func (s *Server) readBody(r *http.Request) ([]byte, error) {
+
+	if r.ContentLength > s.options.MaxBodySize {
+		return nil, fmt.Errorf("%w: the body exceeds %d bytes", errBodyTooLarge, s.options.MaxBodySize)
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.options.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read request body: %v", err)
+	}
+	if int64(len(body)) > s.options.MaxBodySize {
+		return nil, fmt.Errorf("%w: the body exceeds %d bytes", errBodyTooLarge, s.options.MaxBodySize)
+	}
+	return body, nil
+}
+
+// decode interprets the body of the request according to its encoding: a
+// CloudEvent in structured or binary mode, or a raw protobuf binary.
+func (s *Server) decode(r *http.Request, body []byte) (interface{}, error) {
+
+	message := cehttp.NewMessage(r.Header, io.NopCloser(bytes.NewReader(body)))
+	if message.ReadEncoding() != binding.EncodingUnknown {
+
+		ce, err := binding.ToEvent(r.Context(), message)
+		if err != nil {
+			return nil, err
+		}
+		if len(ce.DataSchema()) == 0 {
+			return nil, errors.New("the event does not define the 'dataschema' attribute")
+		}
+		return parser.ParseEvent(*ce, s.options.IsDynamic)
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/cloudevents") {
+		return nil, errors.New("unsupported CloudEvent format (batches are not supported)")
+	}
+
+	if s.options.Registry != nil && confluent.IsFramed(body) {
+		return parser.ParseFramed(body, s.options.Registry)
+	}
+
+	schemaURI := r.Header.Get(SchemaHeader)
+	if len(schemaURI) == 0 {
+		schemaURI = s.options.SchemaURI
+	}
+	if len(schemaURI) == 0 {
+		return nil, fmt.Errorf("raw protobuf messages require the %s header", SchemaHeader)
+	}
+	buffer := &bytes.Buffer{}
+	err := parser.TranscodePayload(buffer, body, schemaURI, s.options.IsDynamic)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(buffer.Bytes()), nil
+}
+
+// forward posts the JSON form of a message to the forward URL, and returns
+// the status code of the response. Responses other than 2xx are errors.
+func (s *Server) forward(data []byte) (int, error) {
+
+	response, err := s.client.Post(s.options.ForwardURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("forward endpoint replied with status: %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// replyError sends a JSON document describing the error with the given
+// status code.
+func replyError(w http.ResponseWriter, status int, err error) {
+
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"publisher/pkg/bundle"
+	events "publisher/pkg/events/v1"
+	"publisher/pkg/export"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"google.golang.org/protobuf/proto"
+)
+
+// sample is the message carried by the requests of the tests.
+var sample = &events.SimpleMessage{Param_01: "first parameter", Param_02: true, Param_04: -32}
+
+// writeSchema writes the bundle of the schema of the sample message to a
+// temporary directory, and returns the schema URI referencing the message.
+func writeSchema(t *testing.T) string {
+
+	t.Helper()
+	set, err := bundle.Build(sample.ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := export.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "root.pb")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + path + "#SimpleMessage"
+}
+
+// newSampleEvent creates a cloud event carrying the sample message.
+func newSampleEvent(t *testing.T, schemaURI string) cloudevents.Event {
+
+	t.Helper()
+	data, err := proto.Marshal(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ce := cloudevents.NewEvent()
+	ce.SetID("1")
+	ce.SetSource("http://localhost/test")
+	ce.SetType("SimpleMessage")
+	ce.SetDataSchema(schemaURI)
+	if err := ce.SetData("application/protobuf", data); err != nil {
+		t.Fatal(err)
+	}
+	return ce
+}
+
+// serve sends the request to a server created with the given options.
+func serve(s *Server, request *http.Request) *httptest.ResponseRecorder {
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// expectSample fails the test if the response is not the JSON form of the
+// sample message or, for cloud events, of an event whose data is the sample.
+func expectSample(t *testing.T, response *httptest.ResponseRecorder, isEvent bool) {
+
+	t.Helper()
+	if response.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", response.Code, response.Body.String())
+	}
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if isEvent {
+		if decoded["id"] != "1" || decoded["type"] != "SimpleMessage" {
+			t.Errorf("unexpected event attributes: %v", decoded)
+		}
+		decoded, _ = decoded["data"].(map[string]interface{})
+	}
+	if decoded["param_01"] != "first parameter" || decoded["param_02"] != true || decoded["param_04"] != float64(-32) {
+		t.Errorf("unexpected response: %v", decoded)
+	}
+}
+
+// expectError fails the test if the response does not have the given status
+// and a JSON error document.
+func expectError(t *testing.T, response *httptest.ResponseRecorder, status int) {
+
+	t.Helper()
+	if response.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, response.Code, response.Body.String())
+	}
+	document := map[string]string{}
+	if err := json.Unmarshal(response.Body.Bytes(), &document); err != nil || len(document["error"]) == 0 {
+		t.Errorf("expected an error document, got: %s", response.Body.String())
+	}
+}
+
+func TestServeStructuredCloudEvent(t *testing.T) {
+
+	body, err := json.Marshal(newSampleEvent(t, writeSchema(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/cloudevents+json")
+
+	expectSample(t, serve(New(Options{IsDynamic: true}), request), true)
+}
+
+func TestServeBinaryCloudEvent(t *testing.T) {
+
+	ce := newSampleEvent(t, writeSchema(t))
+	request := httptest.NewRequest(http.MethodPost, "/", nil)
+	if err := cehttp.WriteRequest(context.Background(), binding.ToMessage(&ce), request); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Header.Get("Ce-Dataschema")) == 0 {
+		t.Fatalf("the request is not in binary mode: %v", request.Header)
+	}
+
+	expectSample(t, serve(New(Options{IsDynamic: true}), request), true)
+}
+
+func TestServeRawWithSchemaHeader(t *testing.T) {
+
+	data, err := proto.Marshal(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/protobuf")
+	request.Header.Set(SchemaHeader, writeSchema(t))
+
+	expectSample(t, serve(New(Options{IsDynamic: true}), request), false)
+}
+
+func TestServeRawWithDefaultSchema(t *testing.T) {
+
+	data, err := proto.Marshal(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+
+	expectSample(t, serve(New(Options{IsDynamic: true, SchemaURI: writeSchema(t)}), request), false)
+}
+
+func TestServeRawWithoutSchema(t *testing.T) {
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("\x0a\x01a"))
+	response := serve(New(Options{IsDynamic: true}), request)
+	expectError(t, response, http.StatusBadRequest)
+	if !strings.Contains(response.Body.String(), SchemaHeader) {
+		t.Errorf("the error does not mention the schema header: %s", response.Body.String())
+	}
+}
+
+func TestServeInvalidPayload(t *testing.T) {
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("\x0a\x05a"))
+	request.Header.Set(SchemaHeader, writeSchema(t))
+	expectError(t, serve(New(Options{IsDynamic: true}), request), http.StatusBadRequest)
+}
+
+func TestServeEventWithoutSchema(t *testing.T) {
+
+	ce := newSampleEvent(t, "")
+	ce.SetDataSchema("")
+	body, _ := json.Marshal(ce)
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/cloudevents+json")
+	expectError(t, serve(New(Options{IsDynamic: true}), request), http.StatusBadRequest)
+}
+
+func TestServeBodyTooLarge(t *testing.T) {
+
+	s := New(Options{IsDynamic: true, MaxBodySize: 16})
+
+	// declared length exceeding the limit.
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("a", 17)))
+	expectError(t, serve(s, request), http.StatusRequestEntityTooLarge)
+
+	// unknown length (chunked body) exceeding the limit.
+	request = httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader(strings.Repeat("a", 17))))
+	request.ContentLength = -1
+	expectError(t, serve(s, request), http.StatusRequestEntityTooLarge)
+
+	// a body of the maximum size is read, then rejected as invalid.
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("a", 16)))
+	request.Header.Set(SchemaHeader, writeSchema(t))
+	expectError(t, serve(s, request), http.StatusBadRequest)
+}
+
+// failingReader fails after returning part of the body.
+type failingReader struct{ sent bool }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+
+	if r.sent {
+		return 0, errors.New("connection reset by peer")
+	}
+	r.sent = true
+	return copy(p, "\x0a\x01"), nil
+}
+
+func TestServeBodyReadError(t *testing.T) {
+
+	request := httptest.NewRequest(http.MethodPost, "/", &failingReader{})
+	request.ContentLength = -1
+	response := serve(New(Options{IsDynamic: true}), request)
+	expectError(t, response, http.StatusBadRequest)
+	if !strings.Contains(response.Body.String(), "could not read request body") {
+		t.Errorf("unexpected error: %s", response.Body.String())
+	}
+}
+
+func TestServeMethodAndHealth(t *testing.T) {
+
+	s := New(Options{})
+	if response := serve(s, httptest.NewRequest(http.MethodGet, "/healthz", nil)); response.Code != http.StatusOK {
+		t.Errorf("unexpected health status: %d", response.Code)
+	}
+	response := serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	expectError(t, response, http.StatusMethodNotAllowed)
+	if response.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("missing Allow header")
+	}
+}
+
+func TestServeConcurrencyLimit(t *testing.T) {
+
+	s := New(Options{MaxConcurrency: 1})
+	s.slots <- struct{}{}
+	response := serve(s, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("")))
+	expectError(t, response, http.StatusServiceUnavailable)
+	if response.Header().Get("Retry-After") != "1" {
+		t.Errorf("missing Retry-After header")
+	}
+}
+
+func TestServeForward(t *testing.T) {
+
+	forwarded := make(chan []byte, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	data, _ := proto.Marshal(sample)
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	request.Header.Set(SchemaHeader, writeSchema(t))
+	response := serve(New(Options{IsDynamic: true, ForwardURL: target.URL}), request)
+	if response.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status %d: %s", response.Code, response.Body.String())
+	}
+	if body := <-forwarded; !bytes.Contains(body, []byte(`"param_01":"first parameter"`)) {
+		t.Errorf("unexpected forwarded body: %s", body)
+	}
+}
+
+func TestServeSlowHeadersAreCut(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- New(Options{Address: address, ReadHeaderTimeout: 100 * time.Millisecond}).Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", address); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the headers are never completed, the server closes the connection.
+	conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	started := time.Now()
+	io.ReadAll(conn)
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("the connection was not closed by the read header timeout (%v)", elapsed)
+	}
+}
@@ -0,0 +1,693 @@
+package transcoder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// wellKnownPrefix is the prefix of the full names of the well known types,
+// whose JSON form is special (e.g. timestamps are RFC 3339 strings) and is
+// delegated to protojson.
+const wellKnownPrefix = "google.protobuf."
+
+// errInvalid is the error returned for malformed binaries, which reads as the
+// one returned by proto.Unmarshal.
+var errInvalid = errors.New("proto: cannot parse invalid wire-format data")
+
+// errRecursion is the error returned for messages nested deeper than the
+// limit applied by proto.Unmarshal (protowire.DefaultRecursionLimit), which
+// reads as the one it returns for dynamic messages.
+var errRecursion = errors.New("proto: exceeded max recursion depth")
+
+// Transcode reads the protobuf binary of a message of the given type and
+// writes its JSON form to the writer. The binary is read once, without
+// building a message, and the JSON is the same produced by the parser when
+// it renders a message through protojson (with proto names) and marshals
+// the resulting map: keys are sorted, strings are HTML-escaped, 64-bit
+// integers are strings and floating point numbers are formatted as float64.
+func Transcode(w io.Writer, md protoreflect.MessageDescriptor, data []byte) error {
+
+	buffer, err := Append(make([]byte, 0, 2*len(data)+16), md, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buffer)
+	return err
+}
+
+// Append appends the JSON form of the protobuf binary of a message of the
+// given type to the buffer, and returns the extended buffer.
+func Append(buffer []byte, md protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+
+	return appendMessage(buffer, md, [][]byte{data}, protowire.DefaultRecursionLimit)
+}
+
+// appendMessage appends the JSON form of a message whose binary is made of
+// the given segments, which are the occurrences of a message field: merging
+// them is the same as scanning them one after the other, hence each byte is
+// scanned once whatever the number of occurrences and the depth. The depth
+// is the number of nested messages that can still be entered, as limited by
+// proto.Unmarshal, which stops untrusted binaries from exhausting the stack.
+func appendMessage(buffer []byte, md protoreflect.MessageDescriptor, segments [][]byte, depth int) ([]byte, error) {
+
+	depth--
+	if depth < 0 {
+		return nil, errRecursion
+	}
+	if strings.HasPrefix(string(md.FullName()), wellKnownPrefix) {
+		return appendWellKnown(buffer, md, segments, depth)
+	}
+
+	occurrences := make([][]value, md.Fields().Len())
+	for _, segment := range segments {
+		err := scan(md, segment, occurrences, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	buffer = append(buffer, '{')
+	first := true
+	for _, fd := range sortedFields(md) {
+		values := occurrences[fd.Index()]
+		if values == nil {
+			if fd.Cardinality() == protoreflect.Required {
+				return nil, fmt.Errorf("proto: required field %s not set", fd.FullName())
+			}
+			continue
+		}
+		if !isPopulated(fd, values) {
+			continue
+		}
+		if !first {
+			buffer = append(buffer, ',')
+		}
+		first = false
+		buffer = appendString(buffer, fieldName(fd))
+		buffer = append(buffer, ':')
+		buffer, err = appendField(buffer, fd, values, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(buffer, '}'), nil
+}
+
+// layouts caches the fields of the messages sorted by JSON name, indexed by
+// message descriptor.
+var layouts sync.Map
+
+// sortedFields returns the fields of the message sorted by JSON name, which
+// is the order of the keys of the JSON objects.
+func sortedFields(md protoreflect.MessageDescriptor) []protoreflect.FieldDescriptor {
+
+	if fields, isPresent := layouts.Load(md); isPresent {
+		return fields.([]protoreflect.FieldDescriptor)
+	}
+	fields := make([]protoreflect.FieldDescriptor, md.Fields().Len())
+	for i := range fields {
+		fields[i] = md.Fields().Get(i)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fieldName(fields[i]) < fieldName(fields[j]) })
+	layouts.Store(md, fields)
+	return fields
+}
+
+// fieldName returns the JSON name of the field, which is its proto name or,
+// for groups, the name of the group message.
+func fieldName(fd protoreflect.FieldDescriptor) string {
+
+	if fd.Kind() == protoreflect.GroupKind {
+		return string(fd.Message().Name())
+	}
+	return string(fd.Name())
+}
+
+// value is an occurrence of a field in the wire format: the wire type and
+// the encoded value (the content for length-delimited values and groups).
+type value struct {
+	kind protowire.Type
+	data []byte
+}
+
+// scan appends the occurrences of the known fields of the message to those
+// indexed by field index, keeping only the last member set for each oneof.
+// Unknown fields, and fields whose wire type does not match their declaration,
+// are skipped as done by proto.Unmarshal, which also rejects invalid UTF-8 in
+// proto3 strings and malformed messages even when they are then discarded.
+func scan(md protoreflect.MessageDescriptor, data []byte, occurrences [][]value, depth int) error {
+
+	fields := md.Fields()
+	for len(data) > 0 {
+
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errInvalid
+		}
+		if number > protowire.MaxValidNumber {
+			return errInvalid
+		}
+		data = data[n:]
+
+		var content []byte
+		if kind == protowire.BytesType {
+			content, n = protowire.ConsumeBytes(data)
+		} else if kind == protowire.StartGroupType {
+			content, n = protowire.ConsumeGroup(number, data)
+		} else {
+			n = protowire.ConsumeFieldValue(number, kind, data)
+			if n >= 0 {
+				content = data[:n]
+			}
+		}
+		if n < 0 {
+			return errInvalid
+		}
+		data = data[n:]
+
+		fd := fields.ByNumber(number)
+		if fd == nil || !accepts(fd, kind) {
+			continue
+		}
+		if fd.Kind() == protoreflect.StringKind && fd.Syntax() == protoreflect.Proto3 && !utf8.Valid(content) {
+			return fmt.Errorf("proto: field %s contains invalid UTF-8", fd.FullName())
+		}
+		if oneof := fd.ContainingOneof(); oneof != nil {
+			for i := 0; i < oneof.Fields().Len(); i++ {
+				member := oneof.Fields().Get(i)
+				if member.Number() == number {
+					continue
+				}
+				if err := discard(member, occurrences[member.Index()], depth); err != nil {
+					return err
+				}
+				occurrences[member.Index()] = nil
+			}
+		}
+		occurrences[fd.Index()] = append(occurrences[fd.Index()], value{kind: kind, data: content})
+	}
+	return nil
+}
+
+// discard validates the occurrences of a field that are not rendered, since
+// they are overridden by other occurrences.
+func discard(fd protoreflect.FieldDescriptor, values []value, depth int) error {
+
+	for _, v := range values {
+		var err error
+		switch {
+		case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+			err = validate(fd.Message(), v.data, depth)
+		case fd.IsList():
+			_, err = scalars(fd, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks that the binary is a well formed message of the given
+// type, as proto.Unmarshal does, without rendering it.
+func validate(md protoreflect.MessageDescriptor, data []byte, depth int) error {
+
+	depth--
+	if depth < 0 {
+		return errRecursion
+	}
+	occurrences := make([][]value, md.Fields().Len())
+	err := scan(md, data, occurrences, depth)
+	if err != nil {
+		return err
+	}
+	for i, values := range occurrences {
+		err = discard(md.Fields().Get(i), values, depth)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accepts determines whether a field can be decoded from the wire type.
+func accepts(fd protoreflect.FieldDescriptor, kind protowire.Type) bool {
+
+	expected := wireType(fd.Kind())
+	if kind == expected {
+		return true
+	}
+	// repeated scalars are accepted both packed and unpacked
+	return fd.IsList() && kind == protowire.BytesType && expected != protowire.BytesType && expected != protowire.StartGroupType
+}
+
+// wireType returns the wire type of the values of the given kind.
+func wireType(kind protoreflect.Kind) protowire.Type {
+
+	switch kind {
+	case protoreflect.StringKind, protoreflect.BytesKind, protoreflect.MessageKind:
+		return protowire.BytesType
+	case protoreflect.GroupKind:
+		return protowire.StartGroupType
+	case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind, protoreflect.FloatKind:
+		return protowire.Fixed32Type
+	case protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind, protoreflect.DoubleKind:
+		return protowire.Fixed64Type
+	}
+	return protowire.VarintType
+}
+
+// isPopulated determines whether protojson renders the field: fields without
+// presence (proto3 scalars) are omitted when their last value is the default,
+// and lists when they are empty.
+func isPopulated(fd protoreflect.FieldDescriptor, values []value) bool {
+
+	if fd.IsMap() {
+		return true
+	}
+	if fd.IsList() {
+		for _, v := range values {
+			// malformed packed values are reported when rendering
+			if elements, err := scalars(fd, v); err != nil || len(elements) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	last := values[len(values)-1]
+	if fd.HasPresence() {
+		return true
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return len(last.data) > 0
+	case protoreflect.FloatKind, protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+		return decodeFixed32(last.data) != 0
+	case protoreflect.DoubleKind, protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		return decodeFixed64(last.data) != 0
+	case protoreflect.Int32Kind, protoreflect.Uint32Kind, protoreflect.Sint32Kind, protoreflect.EnumKind:
+		// 32-bit values are truncated from the varint
+		return uint32(decodeVarint(last.data)) != 0
+	}
+	return decodeVarint(last.data) != 0
+}
+
+// appendField appends the JSON value of the field.
+func appendField(buffer []byte, fd protoreflect.FieldDescriptor, values []value, depth int) ([]byte, error) {
+
+	switch {
+	case fd.IsMap():
+		return appendMap(buffer, fd, values, depth)
+	case fd.IsList():
+		buffer = append(buffer, '[')
+		first := true
+		for _, v := range values {
+			elements, err := scalars(fd, v)
+			if err != nil {
+				return nil, err
+			}
+			for _, element := range elements {
+				if !first {
+					buffer = append(buffer, ',')
+				}
+				first = false
+				buffer, err = appendValue(buffer, fd, element, depth)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return append(buffer, ']'), nil
+	case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+		return appendMessage(buffer, fd.Message(), segments(values), depth)
+	}
+	return appendValue(buffer, fd, values[len(values)-1], depth)
+}
+
+// scalars expands an occurrence of a repeated field into its elements, which
+// are more than one for packed values.
+func scalars(fd protoreflect.FieldDescriptor, v value) ([]value, error) {
+
+	expected := wireType(fd.Kind())
+	elements := []value{v}
+	if v.kind == protowire.BytesType && expected != protowire.BytesType {
+		elements = []value{}
+		for data := v.data; len(data) > 0; {
+			n := protowire.ConsumeFieldValue(1, expected, data)
+			if n < 0 {
+				return nil, errInvalid
+			}
+			elements = append(elements, value{kind: expected, data: data[:n]})
+			data = data[n:]
+		}
+	}
+	return elements, nil
+}
+
+// appendMap appends the JSON object of a map field, whose entries are sorted
+// by key, the last entry winning for duplicate keys.
+func appendMap(buffer []byte, fd protoreflect.FieldDescriptor, values []value, depth int) ([]byte, error) {
+
+	keyField := fd.MapKey()
+	valueField := fd.MapValue()
+
+	entries := map[string][]value{}
+	for _, v := range values {
+		occurrences := make([][]value, fd.Message().Fields().Len())
+		err := scan(fd.Message(), v.data, occurrences, depth)
+		if err != nil {
+			return nil, err
+		}
+		key := ""
+		if keys := occurrences[keyField.Index()]; len(keys) > 0 {
+			key, err = formatKey(keyField, keys[len(keys)-1])
+			if err != nil {
+				return nil, err
+			}
+		} else if keyField.Kind() == protoreflect.BoolKind {
+			key = "false"
+		} else if keyField.Kind() != protoreflect.StringKind {
+			key = "0"
+		}
+		if previous, isPresent := entries[key]; isPresent {
+			err = discard(valueField, previous, depth)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries[key] = occurrences[valueField.Index()]
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buffer = append(buffer, '{')
+	for i, key := range keys {
+		if i > 0 {
+			buffer = append(buffer, ',')
+		}
+		buffer = appendString(buffer, key)
+		buffer = append(buffer, ':')
+
+		var err error
+		occurrences := entries[key]
+		switch {
+		case valueField.Kind() == protoreflect.MessageKind:
+			buffer, err = appendMessage(buffer, valueField.Message(), segments(occurrences), depth)
+		case len(occurrences) == 0:
+			buffer, err = appendValue(buffer, valueField, value{kind: wireType(valueField.Kind()), data: zero(valueField.Kind())}, depth)
+		default:
+			buffer, err = appendValue(buffer, valueField, occurrences[len(occurrences)-1], depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(buffer, '}'), nil
+}
+
+// formatKey returns the JSON object key of a map key.
+func formatKey(fd protoreflect.FieldDescriptor, v value) (string, error) {
+
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if !utf8.Valid(v.data) {
+			return "", fmt.Errorf("proto: field %s contains invalid UTF-8", fd.FullName())
+		}
+		return string(v.data), nil
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(decodeVarint(v.data) != 0), nil
+	}
+	signed, unsigned, isSigned := integer(fd.Kind(), v)
+	if isSigned {
+		return strconv.FormatInt(signed, 10), nil
+	}
+	return strconv.FormatUint(unsigned, 10), nil
+}
+
+// appendValue appends the JSON value of a scalar, or of an element of a list.
+func appendValue(buffer []byte, fd protoreflect.FieldDescriptor, v value, depth int) ([]byte, error) {
+
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return appendMessage(buffer, fd.Message(), [][]byte{v.data}, depth)
+	case protoreflect.StringKind:
+		if !utf8.Valid(v.data) {
+			return nil, fmt.Errorf("proto: field %s contains invalid UTF-8", fd.FullName())
+		}
+		return appendString(buffer, string(v.data)), nil
+	case protoreflect.BytesKind:
+		buffer = append(buffer, '"')
+		buffer = append(buffer, base64.StdEncoding.EncodeToString(v.data)...)
+		return append(buffer, '"'), nil
+	case protoreflect.BoolKind:
+		return strconv.AppendBool(buffer, decodeVarint(v.data) != 0), nil
+	case protoreflect.EnumKind:
+		// unknown numbers are rendered as numbers, closed (proto2) enums
+		// included, since proto.Unmarshal keeps them in the field.
+		number := protoreflect.EnumNumber(int32(decodeVarint(v.data)))
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return append(buffer, "null"...), nil
+		}
+		if ev := fd.Enum().Values().ByNumber(number); ev != nil {
+			return appendString(buffer, string(ev.Name())), nil
+		}
+		return strconv.AppendInt(buffer, int64(number), 10), nil
+	case protoreflect.FloatKind:
+		f := float64(math.Float32frombits(decodeFixed32(v.data)))
+		// protojson formats the value as float32, which is read back
+		// as float64 when the JSON form is unmarshalled into a map.
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+		return appendFloat(buffer, f), nil
+	case protoreflect.DoubleKind:
+		return appendFloat(buffer, math.Float64frombits(decodeFixed64(v.data))), nil
+	}
+
+	signed, unsigned, isSigned := integer(fd.Kind(), v)
+	quoted := fd.Kind() == protoreflect.Int64Kind || fd.Kind() == protoreflect.Sint64Kind || fd.Kind() == protoreflect.Sfixed64Kind ||
+		fd.Kind() == protoreflect.Uint64Kind || fd.Kind() == protoreflect.Fixed64Kind
+	if quoted {
+		buffer = append(buffer, '"')
+	}
+	if isSigned {
+		buffer = strconv.AppendInt(buffer, signed, 10)
+	} else {
+		buffer = strconv.AppendUint(buffer, unsigned, 10)
+	}
+	if quoted {
+		buffer = append(buffer, '"')
+	}
+	return buffer, nil
+}
+
+// integer decodes an integer value, and returns it either as signed or as
+// unsigned integer according to its kind.
+func integer(kind protoreflect.Kind, v value) (int64, uint64, bool) {
+
+	switch kind {
+	case protoreflect.Int32Kind:
+		return int64(int32(decodeVarint(v.data))), 0, true
+	case protoreflect.Int64Kind:
+		return int64(decodeVarint(v.data)), 0, true
+	case protoreflect.Sint32Kind:
+		return int64(int32(protowire.DecodeZigZag(decodeVarint(v.data) & math.MaxUint32))), 0, true
+	case protoreflect.Sint64Kind:
+		return protowire.DecodeZigZag(decodeVarint(v.data)), 0, true
+	case protoreflect.Sfixed32Kind:
+		return int64(int32(decodeFixed32(v.data))), 0, true
+	case protoreflect.Sfixed64Kind:
+		return int64(decodeFixed64(v.data)), 0, true
+	case protoreflect.Uint32Kind:
+		return 0, uint64(uint32(decodeVarint(v.data))), false
+	case protoreflect.Fixed32Kind:
+		return 0, uint64(decodeFixed32(v.data)), false
+	case protoreflect.Fixed64Kind:
+		return 0, decodeFixed64(v.data), false
+	}
+	return 0, decodeVarint(v.data), false
+}
+
+// appendWellKnown appends the JSON form of a well known type, whose binary
+// is made of the given segments, rendered by protojson and normalised as done
+// by the parser. The depth has already been decreased for the message itself.
+func appendWellKnown(buffer []byte, md protoreflect.MessageDescriptor, segments [][]byte, depth int) ([]byte, error) {
+
+	msg := dynamicpb.NewMessage(md)
+	options := proto.UnmarshalOptions{Merge: true, RecursionLimit: depth + 1}
+	for _, segment := range segments {
+		err := options.Unmarshal(segment, msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rendered, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	err = json.Unmarshal(rendered, &generic)
+	if err != nil {
+		return nil, err
+	}
+	normalised, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	return append(buffer, normalised...), nil
+}
+
+// segments returns the binaries of the occurrences of a message field, which
+// are merged by scanning them in order. Scanning them separately, rather than
+// their concatenation, also rejects malformed occurrences whose concatenation
+// is well formed, as proto.Unmarshal does.
+func segments(values []value) [][]byte {
+
+	data := make([][]byte, len(values))
+	for i, v := range values {
+		data[i] = v.data
+	}
+	return data
+}
+
+// zero returns the encoding of the default value of the given kind.
+func zero(kind protoreflect.Kind) []byte {
+
+	switch wireType(kind) {
+	case protowire.Fixed32Type:
+		return make([]byte, 4)
+	case protowire.Fixed64Type:
+		return make([]byte, 8)
+	case protowire.BytesType:
+		return nil
+	}
+	return []byte{0}
+}
+
+// decodeVarint decodes a varint whose encoding has already been validated.
+func decodeVarint(data []byte) uint64 {
+
+	v, _ := protowire.ConsumeVarint(data)
+	return v
+}
+
+// decodeFixed32 decodes a fixed 32-bit value already validated.
+func decodeFixed32(data []byte) uint32 {
+
+	v, _ := protowire.ConsumeFixed32(data)
+	return v
+}
+
+// decodeFixed64 decodes a fixed 64-bit value already validated.
+func decodeFixed64(data []byte) uint64 {
+
+	v, _ := protowire.ConsumeFixed64(data)
+	return v
+}
+
+// appendFloat appends a floating point number formatted as done by the
+// encoding/json package, with NaN and infinities as the strings used by
+// protojson.
+func appendFloat(buffer []byte, f float64) []byte {
+
+	switch {
+	case math.IsNaN(f):
+		return append(buffer, `"NaN"`...)
+	case math.IsInf(f, 1):
+		return append(buffer, `"Infinity"`...)
+	case math.IsInf(f, -1):
+		return append(buffer, `"-Infinity"`...)
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	buffer = strconv.AppendFloat(buffer, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(buffer)
+		if n >= 4 && buffer[n-4] == 'e' && buffer[n-3] == '-' && buffer[n-2] == '0' {
+			buffer[n-2] = buffer[n-1]
+			buffer = buffer[:n-1]
+		}
+	}
+	return buffer
+}
+
+// hex holds the digits used to escape characters.
+const hex = "0123456789abcdef"
+
+// appendString appends the JSON string of the given text, escaped as done by
+// the encoding/json package (including the HTML characters).
+func appendString(buffer []byte, text string) []byte {
+
+	buffer = append(buffer, '"')
+	start := 0
+	for i := 0; i < len(text); {
+		if c := text[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			buffer = append(buffer, text[start:i]...)
+			switch c {
+			case '"', '\\':
+				buffer = append(buffer, '\\', c)
+			case '\b':
+				buffer = append(buffer, '\\', 'b')
+			case '\f':
+				buffer = append(buffer, '\\', 'f')
+			case '\n':
+				buffer = append(buffer, '\\', 'n')
+			case '\r':
+				buffer = append(buffer, '\\', 'r')
+			case '\t':
+				buffer = append(buffer, '\\', 't')
+			default:
+				buffer = append(buffer, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == utf8.RuneError && size == 1 {
+			buffer = append(buffer, text[start:i]...)
+			buffer = append(buffer, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			buffer = append(buffer, text[start:i]...)
+			buffer = append(buffer, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buffer = append(buffer, text[start:]...)
+	return append(buffer, '"')
+}
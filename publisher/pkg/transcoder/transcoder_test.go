@@ -0,0 +1,550 @@
+package transcoder_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	emitter "publisher/pkg/emitter"
+	events "publisher/pkg/events/v1"
+	"publisher/pkg/transcoder"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// render produces the reference JSON form of the binary, as the parser does:
+// the binary is unmarshalled into a dynamic message, which is rendered by
+// protojson with proto names, and the JSON is normalised by unmarshalling it
+// into a map and marshalling it back.
+func render(md protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+
+	msg := dynamicpb.NewMessage(md)
+	err := proto.Unmarshal(data, msg)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	err = json.Unmarshal(rendered, &generic)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// transcode produces the JSON form of the binary through the transcoder.
+func transcode(md protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+
+	buffer := &bytes.Buffer{}
+	err := transcoder.Transcode(buffer, md, data)
+	return buffer.Bytes(), err
+}
+
+// expectEquivalent fails the test if the transcoder and the reference do not
+// produce the same bytes, or do not both fail.
+func expectEquivalent(t *testing.T, name string, md protoreflect.MessageDescriptor, data []byte) {
+
+	t.Helper()
+	expected, expectedErr := render(md, data)
+	actual, err := transcode(md, data)
+	switch {
+	case expectedErr != nil && err == nil:
+		t.Errorf("%s: expected an error (%v), got: %s", name, expectedErr, actual)
+	case expectedErr == nil && err != nil:
+		t.Errorf("%s: unexpected error: %v", name, err)
+	case expectedErr == nil && !bytes.Equal(actual, expected):
+		t.Errorf("%s: unexpected JSON\nexpected: %s\nactual:   %s", name, expected, actual)
+	}
+}
+
+// sampleTypes returns the descriptors of the sample types.
+func sampleTypes() []protoreflect.MessageDescriptor {
+
+	types := []protoreflect.MessageDescriptor{}
+	for _, file := range []protoreflect.FileDescriptor{
+		(&events.SimpleMessage{}).ProtoReflect().Descriptor().ParentFile(),
+		(&events.SubMessage{}).ProtoReflect().Descriptor().ParentFile(),
+	} {
+		for i := 0; i < file.Messages().Len(); i++ {
+			md := file.Messages().Get(i)
+			types = append(types, md)
+			for j := 0; j < md.Messages().Len(); j++ {
+				if !md.Messages().Get(j).IsMapEntry() {
+					types = append(types, md.Messages().Get(j))
+				}
+			}
+		}
+	}
+	return types
+}
+
+// generate returns the binary of a message of the given type populated with
+// pseudo-random values.
+func generate(t testing.TB, md protoreflect.MessageDescriptor, seed int64) []byte {
+
+	data, err := proto.Marshal(emitter.NewGenerator(seed, 4).Generate(md))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// nodeSchema builds a recursive schema declaring:
+//
+//	message Node {
+//	  Node child = 1;
+//	  string name = 2;
+//	  repeated Node children = 3;
+//	  map<string, Node> nodes = 4;
+//	  oneof choice { Node left = 5; Node right = 6; }
+//	  repeated sint64 values = 7;
+//	}
+func nodeSchema(t testing.TB) protoreflect.MessageDescriptor {
+
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		fdp := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), JsonName: proto.String(name), Number: proto.Int32(number), Label: label.Enum(), Type: kind.Enum()}
+		if len(typeName) > 0 {
+			fdp.TypeName = proto.String(typeName)
+		}
+		return fdp
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	message, text := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_STRING
+
+	left, right := field("left", 5, optional, message, ".transcoder.test.Node"), field("right", 6, optional, message, ".transcoder.test.Node")
+	left.OneofIndex, right.OneofIndex = proto.Int32(0), proto.Int32(0)
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("transcoder/test.proto"),
+		Package: proto.String("transcoder.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Node"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("child", 1, optional, message, ".transcoder.test.Node"),
+				field("name", 2, optional, text, ""),
+				field("children", 3, repeated, message, ".transcoder.test.Node"),
+				field("nodes", 4, repeated, message, ".transcoder.test.Node.NodesEntry"),
+				left,
+				right,
+				field("values", 7, repeated, descriptorpb.FieldDescriptorProto_TYPE_SINT64, ""),
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("NodesEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, optional, text, ""),
+					field("value", 2, optional, message, ".transcoder.test.Node"),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return file.Messages().Get(0)
+}
+
+// appendMessageField appends a length-delimited field carrying the content.
+func appendMessageField(data []byte, number protowire.Number, content []byte) []byte {
+
+	data = protowire.AppendTag(data, number, protowire.BytesType)
+	return protowire.AppendBytes(data, content)
+}
+
+// appendName appends the name field of a node.
+func appendName(data []byte, name string) []byte {
+
+	data = protowire.AppendTag(data, 2, protowire.BytesType)
+	return protowire.AppendString(data, name)
+}
+
+// chain returns the binary of a chain of nodes nested through `child`, the
+// given number of messages deep. When `isSplit` is set, each child is carried
+// by two occurrences of the field, which are merged.
+func chain(depth int, isSplit bool) []byte {
+
+	data := appendName(nil, "leaf")
+	for i := 1; i < depth; i++ {
+		parent := []byte{}
+		if isSplit {
+			parent = appendMessageField(parent, 1, appendName(nil, "first"))
+		}
+		data = appendMessageField(parent, 1, data)
+	}
+	return data
+}
+
+func TestTranscodeSamples(t *testing.T) {
+
+	for _, md := range sampleTypes() {
+		expectEquivalent(t, string(md.FullName())+" (empty)", md, nil)
+		for seed := int64(1); seed <= 25; seed++ {
+			expectEquivalent(t, fmt.Sprintf("%s (seed: %d)", md.FullName(), seed), md, generate(t, md, seed))
+		}
+	}
+}
+
+func TestTranscodeSpecialValues(t *testing.T) {
+
+	md := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	for i, message := range []*events.SimpleMessage{
+		{Param_01: "<html> & \"quotes\"  \t\x01 ünïcödé", Param_03: []byte{0xff, 0x00}},
+		{Param_04: -1, Param_05: -1 << 63, Param_06: 1<<32 - 1, Param_07: 1<<64 - 1, Param_08: -1 << 31, Param_09: -1 << 63},
+		{Param_10: 1<<32 - 1, Param_11: 1<<64 - 1, Param_12: -1 << 31, Param_13: -1 << 63},
+		{Param_14: 3.4028235e38, Param_15: 1e21},
+		{Param_14: 1e-7, Param_15: -5e-324},
+		{Param_14: 0.1, Param_15: 0.1},
+	} {
+		data, err := proto.Marshal(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectEquivalent(t, fmt.Sprintf("special values %d", i+1), md, data)
+	}
+}
+
+// closedEnumSchema builds a proto2 schema declaring a closed enum:
+//
+//	enum Color { NONE = 0; RED = 1; GREEN = 2; }
+//	message Palette {
+//	  optional Color color = 1;
+//	  repeated Color colors = 2;
+//	  repeated Color packed = 3 [packed = true];
+//	  map<string, Color> named = 4;
+//	  oneof choice { Color chosen = 5; string other = 6; }
+//	}
+func closedEnumSchema(t testing.TB) protoreflect.MessageDescriptor {
+
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		fdp := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), JsonName: proto.String(name), Number: proto.Int32(number), Label: label.Enum(), Type: kind.Enum()}
+		if len(typeName) > 0 {
+			fdp.TypeName = proto.String(typeName)
+		}
+		return fdp
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	enum := descriptorpb.FieldDescriptorProto_TYPE_ENUM
+
+	packed := field("packed", 3, repeated, enum, ".transcoder.closed.Color")
+	packed.Options = &descriptorpb.FieldOptions{Packed: proto.Bool(true)}
+	chosen := field("chosen", 5, optional, enum, ".transcoder.closed.Color")
+	other := field("other", 6, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	chosen.OneofIndex, other.OneofIndex = proto.Int32(0), proto.Int32(0)
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("transcoder/closed.proto"),
+		Package: proto.String("transcoder.closed"),
+		Syntax:  proto.String("proto2"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("NONE"), Number: proto.Int32(0)},
+				{Name: proto.String("RED"), Number: proto.Int32(1)},
+				{Name: proto.String("GREEN"), Number: proto.Int32(2)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Palette"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("color", 1, optional, enum, ".transcoder.closed.Color"),
+				field("colors", 2, repeated, enum, ".transcoder.closed.Color"),
+				packed,
+				field("named", 4, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".transcoder.closed.Palette.NamedEntry"),
+				chosen,
+				other,
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("NamedEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("value", 2, optional, enum, ".transcoder.closed.Color"),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return file.Messages().Get(0)
+}
+
+func TestTranscodeClosedEnums(t *testing.T) {
+
+	md := closedEnumSchema(t)
+	varint := func(data []byte, number protowire.Number, v uint64) []byte {
+		data = protowire.AppendTag(data, number, protowire.VarintType)
+		return protowire.AppendVarint(data, v)
+	}
+	entry := func(key string, v uint64) []byte {
+		data := protowire.AppendTag(nil, 1, protowire.BytesType)
+		return varint(protowire.AppendString(data, key), 2, v)
+	}
+	packed := protowire.AppendVarint(protowire.AppendVarint(protowire.AppendVarint(nil, 1), 9), 2)
+
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"known", varint(nil, 1, 2), `{"color":"GREEN"}`},
+		// the protobuf runtime required by the module (v1.28) keeps the
+		// unknown numbers of closed enums rather than moving them to the
+		// unknown fields, and protojson renders them as numbers: the
+		// transcoder does the same, which the reference checks.
+		{"unknown", varint(nil, 1, 9), `{"color":9}`},
+		{"unknown after known", varint(varint(nil, 1, 1), 1, 9), `{"color":9}`},
+		{"negative", varint(nil, 1, uint64(1<<64-1)), `{"color":-1}`},
+		{"unpacked list", varint(varint(varint(nil, 2, 1), 2, 9), 2, 2), `{"colors":["RED",9,"GREEN"]}`},
+		{"packed list", appendMessageField(nil, 3, packed), `{"packed":["RED",9,"GREEN"]}`},
+		{"map", appendMessageField(appendMessageField(nil, 4, entry("a", 9)), 4, entry("b", 1)), `{"named":{"a":9,"b":"RED"}}`},
+		{"oneof", varint(nil, 5, 9), `{"chosen":9}`},
+	} {
+		expectEquivalent(t, test.name, md, test.data)
+		if actual, err := transcode(md, test.data); err != nil || string(actual) != test.expected {
+			t.Errorf("%s: unexpected JSON: %s (%v)", test.name, actual, err)
+		}
+	}
+}
+
+func TestTranscodeUnknownFields(t *testing.T) {
+
+	for _, md := range sampleTypes() {
+		data := generate(t, md, 7)
+		unknown := protowire.AppendTag(nil, 1000, protowire.VarintType)
+		unknown = protowire.AppendVarint(unknown, 150)
+		unknown = appendMessageField(unknown, 1001, []byte("unknown"))
+		unknown = protowire.AppendTag(unknown, 1002, protowire.Fixed32Type)
+		unknown = protowire.AppendFixed32(unknown, 7)
+		unknown = protowire.AppendTag(unknown, 1003, protowire.StartGroupType)
+		unknown = protowire.AppendTag(unknown, 1, protowire.VarintType)
+		unknown = protowire.AppendVarint(unknown, 1)
+		unknown = protowire.AppendTag(unknown, 1003, protowire.EndGroupType)
+		// a known field with a wire type that does not match its declaration.
+		mismatched := protowire.AppendTag(nil, 1, protowire.Fixed64Type)
+		mismatched = protowire.AppendFixed64(mismatched, 1)
+
+		expectEquivalent(t, string(md.FullName())+" (unknown first)", md, append(append([]byte{}, unknown...), data...))
+		expectEquivalent(t, string(md.FullName())+" (unknown last)", md, append(append([]byte{}, data...), unknown...))
+		expectEquivalent(t, string(md.FullName())+" (mismatched)", md, append(append([]byte{}, data...), mismatched...))
+	}
+}
+
+func TestTranscodeMalformed(t *testing.T) {
+
+	simple := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	complex := (&events.ComplexMessage{}).ProtoReflect().Descriptor()
+	node := nodeSchema(t)
+
+	for _, test := range []struct {
+		name string
+		md   protoreflect.MessageDescriptor
+		data []byte
+	}{
+		{"truncated tag", simple, []byte{0x80}},
+		{"field number zero", simple, []byte{0x00, 0x01}},
+		{"field number too large", simple, protowire.AppendVarint(nil, uint64(protowire.MaxValidNumber+1)<<3)},
+		{"truncated varint", simple, []byte{0x20, 0x80}},
+		{"length beyond the end", simple, []byte{0x0a, 0x05, 'a'}},
+		{"truncated fixed64", simple, []byte{0x59, 0x01, 0x02}},
+		{"unterminated group", simple, []byte{0x83, 0x7d}},
+		{"mismatched end group", simple, []byte{0x83, 0x7d, 0x8c, 0x7d}},
+		{"invalid wire type", simple, []byte{0x0f}},
+		{"invalid UTF-8", simple, []byte{0x0a, 0x02, 0xc3, 0x28}},
+		{"invalid UTF-8 in list", complex, []byte{0x0a, 0x01, 0xff}},
+		{"invalid UTF-8 in map key", complex, appendMessageField(nil, 2, []byte{0x0a, 0x01, 0xff})},
+		{"malformed map entry", complex, appendMessageField(nil, 2, []byte{0x0a, 0x05})},
+		{"malformed nested message", node, appendMessageField(nil, 1, []byte{0x12, 0x05})},
+		{"malformed list element", node, appendMessageField(nil, 3, []byte{0x80})},
+		{"malformed packed values", node, appendMessageField(nil, 7, []byte{0x80})},
+		// the occurrences are malformed, while their concatenation is not.
+		{"malformed occurrences", node, appendMessageField(appendMessageField(nil, 1, []byte{0x12}), 1, []byte{0x00})},
+		// a malformed oneof member overridden by another member.
+		{"malformed discarded oneof", node, appendMessageField(appendMessageField(nil, 5, []byte{0x12, 0x05}), 6, nil)},
+		// a malformed map value overridden by a later entry with the same key.
+		{"malformed discarded map value", node, appendMessageField(appendMessageField(nil, 4, appendMessageField(nil, 2, []byte{0x80})), 4, nil)},
+	} {
+		if _, err := render(test.md, test.data); err == nil {
+			t.Fatalf("%s: the reference accepts the binary", test.name)
+		}
+		expectEquivalent(t, test.name, test.md, test.data)
+	}
+}
+
+func TestTranscodeTruncated(t *testing.T) {
+
+	for _, md := range sampleTypes() {
+		data := generate(t, md, 3)
+		for size := 0; size < len(data); size++ {
+			expectEquivalent(t, fmt.Sprintf("%s (truncated to %d of %d bytes)", md.FullName(), size, len(data)), md, data[:size])
+		}
+	}
+}
+
+func TestTranscodeMergesOccurrences(t *testing.T) {
+
+	node := nodeSchema(t)
+	composed := (&events.ComposedMessage{}).ProtoReflect().Descriptor()
+
+	first, _ := proto.Marshal(&events.ComposedMessage{Param_01: &events.SimpleMessage{Param_01: "first", Param_04: 4}, Param_02: &events.ComplexMessage{Param_01: []string{"a"}, Param_02: map[string]string{"k": "v", "x": "y"}}})
+	second, _ := proto.Marshal(&events.ComposedMessage{Param_01: &events.SimpleMessage{Param_02: true}, Param_02: &events.ComplexMessage{Param_01: []string{"b"}, Param_02: map[string]string{"k": "w"}, Param_03: &events.ComplexMessage_Param_03String{Param_03String: "s"}}})
+	expectEquivalent(t, "merged sample", composed, append(append([]byte{}, first...), second...))
+
+	// oneof members replacing each other across occurrences.
+	leftChild := appendMessageField(nil, 5, appendName(nil, "left"))
+	rightChild := appendMessageField(nil, 6, appendName(nil, "right"))
+	expectEquivalent(t, "oneof across occurrences", node, appendMessageField(appendMessageField(nil, 1, leftChild), 1, rightChild))
+
+	// map values merged for duplicate keys are replaced, not merged.
+	entry := func(key string, value []byte) []byte {
+		data := protowire.AppendTag(nil, 1, protowire.BytesType)
+		data = protowire.AppendString(data, key)
+		return appendMessageField(data, 2, value)
+	}
+	maps := appendMessageField(nil, 4, entry("a", appendName(nil, "first")))
+	maps = appendMessageField(maps, 4, entry("a", protowire.AppendVarint(protowire.AppendTag(nil, 7, protowire.VarintType), 3)))
+	maps = appendMessageField(maps, 4, entry("b", nil))
+	expectEquivalent(t, "map entries", node, maps)
+
+	expectEquivalent(t, "split chain", node, chain(50, true))
+}
+
+func TestTranscodeDepthLimit(t *testing.T) {
+
+	node := nodeSchema(t)
+
+	// the deepest nesting accepted by proto.Unmarshal.
+	expectEquivalent(t, "chain at the limit", node, chain(protowire.DefaultRecursionLimit, false))
+	if _, err := transcode(node, chain(protowire.DefaultRecursionLimit, true)); err != nil {
+		t.Errorf("unexpected error at the limit: %v", err)
+	}
+
+	for _, data := range [][]byte{
+		chain(protowire.DefaultRecursionLimit+1, false),
+		chain(protowire.DefaultRecursionLimit+1, true),
+		// nested through lists, map values and oneof members.
+		nest(protowire.DefaultRecursionLimit+1, func(inner []byte) []byte { return appendMessageField(nil, 3, inner) }),
+		nest(protowire.DefaultRecursionLimit+1, func(inner []byte) []byte {
+			key := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "key")
+			return appendMessageField(nil, 4, appendMessageField(key, 2, inner))
+		}),
+		// the deep member is discarded, and validated, but not rendered.
+		nest(protowire.DefaultRecursionLimit+1, func(inner []byte) []byte {
+			return appendMessageField(appendMessageField(nil, 5, inner), 6, nil)
+		}),
+	} {
+		if _, err := render(node, data); err == nil {
+			t.Fatalf("the reference accepts a binary beyond the limit")
+		}
+		_, err := transcode(node, data)
+		if err == nil || !strings.Contains(err.Error(), "recursion depth") {
+			t.Errorf("expected the depth to be rejected, got: %v", err)
+		}
+	}
+}
+
+// nest wraps a node into the given number of messages with the function.
+func nest(depth int, wrap func(inner []byte) []byte) []byte {
+
+	data := appendName(nil, "leaf")
+	for i := 1; i < depth; i++ {
+		data = wrap(data)
+	}
+	return data
+}
+
+// benchmark measures the transcoder or the reference on the given binary.
+func benchmark(b *testing.B, md protoreflect.MessageDescriptor, data []byte, isReference bool) {
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if isReference {
+			_, err = render(md, data)
+		} else {
+			_, err = transcode(md, data)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// complexSample returns the binary of a large complex message.
+func complexSample(b *testing.B) []byte {
+
+	message := &events.ComplexMessage{Param_02: map[string]string{}}
+	for i := 0; i < 100; i++ {
+		message.Param_01 = append(message.Param_01, fmt.Sprintf("value %d", i))
+		message.Param_02[fmt.Sprintf("key %d", i)] = fmt.Sprintf("value %d", i)
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// nestedSample returns the binary of a nested message with many users.
+func nestedSample(b *testing.B) []byte {
+
+	message := &events.NestedMessage{}
+	for i := 0; i < 100; i++ {
+		message.Users = append(message.Users, &events.NestedMessage_ProfileMessage{Name: fmt.Sprintf("user %d", i), Age: int32(i), Interests: []string{"a", "b"}})
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+func BenchmarkTranscodeSimple(b *testing.B) {
+	md := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	benchmark(b, md, generate(b, md, 1), false)
+}
+
+func BenchmarkProtojsonSimple(b *testing.B) {
+	md := (&events.SimpleMessage{}).ProtoReflect().Descriptor()
+	benchmark(b, md, generate(b, md, 1), true)
+}
+
+func BenchmarkTranscodeComplex(b *testing.B) {
+	benchmark(b, (&events.ComplexMessage{}).ProtoReflect().Descriptor(), complexSample(b), false)
+}
+
+func BenchmarkProtojsonComplex(b *testing.B) {
+	benchmark(b, (&events.ComplexMessage{}).ProtoReflect().Descriptor(), complexSample(b), true)
+}
+
+func BenchmarkTranscodeNested(b *testing.B) {
+	benchmark(b, (&events.NestedMessage{}).ProtoReflect().Descriptor(), nestedSample(b), false)
+}
+
+func BenchmarkProtojsonNested(b *testing.B) {
+	benchmark(b, (&events.NestedMessage{}).ProtoReflect().Descriptor(), nestedSample(b), true)
+}
+
+func BenchmarkTranscodeSplitChain(b *testing.B) {
+	benchmark(b, nodeSchema(b), chain(1000, true), false)
+}
+
+func BenchmarkProtojsonSplitChain(b *testing.B) {
+	benchmark(b, nodeSchema(b), chain(1000, true), true)
+}